@@ -0,0 +1,516 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// AccessRequest: un utilisateur demande un rôle ou un groupe avec une justification; un approbateur
+// (permission "approve" sur roles/:id ou groups/:id) l'accepte, ce qui accorde le grant, ou la refuse.
+type AccessRequest struct {
+	ID              uint       `gorm:"primary_key" json:"id"`
+	OrganizationID  uint       `json:"organization_id"`
+	RequesterID     uint       `json:"requester_id"`
+	Kind            string     `json:"kind"`      // role ou group
+	TargetID        uint       `json:"target_id"` // ID du rôle ou du groupe
+	Justification   string     `json:"justification"`
+	ValidUntil      *time.Time `json:"valid_until"` // fin du grant demandé, permanent si vide
+	Status          string     `gorm:"default:'pending'" json:"status"`
+	DecidedByID     *uint      `json:"decided_by_id"`
+	DecisionComment string     `json:"decision_comment"`
+	DecidedAt       *time.Time `json:"decided_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	CanApprove      bool       `gorm:"-" json:"can_approve"` // l'appelant peut décider de cette demande
+}
+
+const (
+	accessPending   = "pending"
+	accessApproved  = "approved"
+	accessDenied    = "denied"
+	accessCancelled = "cancelled"
+)
+
+// accessKinds sont les grants qu'on peut demander
+var accessKinds = map[string]grantTable{roleGrants.kind: roleGrants, groupGrants.kind: groupGrants}
+
+var errAccessRequestDecided = errors.New("access request already decided")
+
+// resource est la ressource sur laquelle l'approbateur doit avoir la permission "approve" (roles/3, groups/5)
+func (r AccessRequest) resource() string {
+	return fmt.Sprintf("%ss/%d", r.Kind, r.TargetID)
+}
+
+// managerApproval: avec ACCESS_REQUEST_MANAGER_APPROVAL=true, le manager direct du demandeur approuve aussi ses demandes
+func managerApproval() bool {
+	return getenvDefault("ACCESS_REQUEST_MANAGER_APPROVAL", "false") == "true"
+}
+
+// accessApprover décide si un sujet peut approuver les demandes d'une organisation (politiques puis rôles)
+type accessApprover struct {
+	db         *gorm.DB
+	set        []compiledPolicy
+	subject    *authzSubject
+	requesters map[uint]map[string]interface{} // attributs des demandeurs déjà chargés
+}
+
+func newAccessApprover(db *gorm.DB, user User) (*accessApprover, error) {
+	set, err := policies.active()
+	if err != nil {
+		return nil, err
+	}
+	subject, err := loadAuthzSubject(db, user)
+	if err != nil {
+		return nil, err
+	}
+	return &accessApprover{db: db, set: set, subject: subject, requesters: map[uint]map[string]interface{}{}}, nil
+}
+
+// allows vérifie la permission "approve" sur la cible; on n'approuve jamais sa propre demande.
+// Les politiques voient le demandeur dans resource.requester (id, email, manager_id, manager_ids).
+func (a *accessApprover) allows(request AccessRequest) (authzDecision, error) {
+	if request.RequesterID == a.subject.User.ID {
+		return authzDecision{Action: "approve", Resource: request.resource(), Reason: "cannot approve your own request"}, nil
+	}
+	attributes, err := resourceAttributes(a.db, request.Kind+"s", request.TargetID)
+	if err != nil {
+		return authzDecision{}, err
+	}
+	requester, err := a.requester(request.RequesterID)
+	if err != nil {
+		return authzDecision{}, err
+	}
+	attributes["requester"] = requester
+	resource := request.resource()
+	decision := decide(a.set, a.subject, "approve", resource, checkInput(a.subject, attributes, "approve", resource, nil))
+	// une politique deny l'emporte aussi sur le manager
+	if !decision.Allowed && decision.Policy == "" && managerApproval() && requester["manager_id"] == int64(a.subject.User.ID) {
+		decision.Allowed = true
+		decision.Reason = "manager of the requester"
+	}
+	return decision, nil
+}
+
+// requester charge les attributs du demandeur; un demandeur supprimé n'a que son id
+func (a *accessApprover) requester(id uint) (map[string]interface{}, error) {
+	if attributes, ok := a.requesters[id]; ok {
+		return attributes, nil
+	}
+	attributes := map[string]interface{}{"id": int64(id), "email": "", "manager_id": int64(0), "manager_ids": []int64{}}
+	var user User
+	if err := a.db.Where("id = ?", id).First(&user).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return nil, err
+	} else if err == nil {
+		chain, err := managerChain(a.db, user.ManagerID)
+		if err != nil {
+			return nil, err
+		}
+		attributes["email"] = user.Email
+		attributes["manager_ids"] = managerIDs(chain)
+		if user.ManagerID != nil {
+			attributes["manager_id"] = int64(*user.ManagerID)
+		}
+	}
+	a.requesters[id] = attributes
+	return attributes, nil
+}
+
+// targetName donne le nom du rôle ou du groupe chargé par grantTable.target
+func targetName(target interface{}) string {
+	switch target := target.(type) {
+	case *Role:
+		return target.Name
+	case *Group:
+		return target.Name
+	}
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Notifications
+
+// approversOf retrouve les utilisateurs dont un rôle, direct ou reçu d'un groupe dont ils sont membres directs,
+// a une permission "approve" sur la cible, les propriétaires du groupe demandé et, si managerApproval, le manager
+// du demandeur. Les politiques et les sous-groupes ne sont pas pris en compte.
+func approversOf(db *gorm.DB, request AccessRequest) ([]User, error) {
+	var roles []Role
+	if err := db.Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	var roleIDs []uint
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if permissionMatches(permission, "approve", request.resource()) {
+				roleIDs = append(roleIDs, role.ID)
+				break
+			}
+		}
+	}
+	// les propriétaires du groupe demandé (ou d'un ancêtre) approuvent aussi, voir group_owners.go
+	owners := map[uint][]User{}
+	if request.Kind == "group" {
+		users, err := groupOwnersOf(db, request.TargetID)
+		if err != nil {
+			return nil, err
+		}
+		owners[request.TargetID] = users
+	}
+	managers := map[uint][]User{}
+	if managerApproval() {
+		var requester User
+		if err := db.Where("id = ?", request.RequesterID).First(&requester).Error; ignoreNotFound(err) != nil {
+			return nil, err
+		}
+		chain, err := managerChain(db, requester.ManagerID)
+		if err != nil {
+			return nil, err
+		}
+		if len(chain) > 0 {
+			managers[request.RequesterID] = chain[:1]
+		}
+	}
+
+	direct, err := loadRelated(db, "user_roles", "role_id", "user_id", roleIDs, func(u User) uint { return u.ID })
+	if err != nil {
+		return nil, err
+	}
+	groups, err := loadRelated(db, "group_roles", "role_id", "group_id", roleIDs, func(g Group) uint { return g.ID })
+	if err != nil {
+		return nil, err
+	}
+	var groupIDs []uint
+	for _, list := range groups {
+		for _, group := range list {
+			groupIDs = append(groupIDs, group.ID)
+		}
+	}
+	members, err := loadRelated(db, "user_groups", "group_id", "user_id", groupIDs, func(u User) uint { return u.ID })
+	if err != nil {
+		return nil, err
+	}
+
+	var approvers []User
+	seen := map[uint]bool{request.RequesterID: true}
+	for _, byTarget := range []map[uint][]User{direct, members, owners, managers} {
+		for _, users := range byTarget {
+			for _, user := range users {
+				if !seen[user.ID] && checkActive(user) == nil {
+					seen[user.ID] = true
+					approvers = append(approvers, user)
+				}
+			}
+		}
+	}
+	return approvers, nil
+}
+
+// notifyAccessRequest prévient par email les approbateurs d'une nouvelle demande; les erreurs sont loggées
+func notifyAccessRequest(db *gorm.DB, request AccessRequest, requester User, target string) {
+	approvers, err := approversOf(db, request)
+	if err != nil {
+		log.Printf("access requests: failed to find approvers of request %d: %v", request.ID, err)
+		return
+	}
+	for _, approver := range approvers {
+		err := mailer.Send(Mail{
+			To:      approver.Email,
+			Subject: fmt.Sprintf("Access request: %s %s for %s", request.Kind, target, requester.Email),
+			Body: fmt.Sprintf("Hello %s,\n\n%s (%s) requests the %s %s:\n\n%s\n\nApprove or deny it from the CLI:\n"+
+				"cli access approve %d\ncli access deny %d --comment <comment>\n",
+				approver.Name, requester.Name, requester.Email, request.Kind, target, request.Justification, request.ID, request.ID),
+		})
+		if err != nil {
+			log.Printf("access requests: failed to notify %s of request %d: %v", approver.Email, request.ID, err)
+		}
+	}
+}
+
+// notifyAccessDecision prévient le demandeur de la décision; les erreurs sont loggées
+func notifyAccessDecision(request AccessRequest, requester User, target string) {
+	body := fmt.Sprintf("Hello %s,\n\nYour request for the %s %s was %s.\n", requester.Name, request.Kind, target, request.Status)
+	if request.DecisionComment != "" {
+		body += "\nComment: " + request.DecisionComment + "\n"
+	}
+	err := mailer.Send(Mail{
+		To:      requester.Email,
+		Subject: fmt.Sprintf("Access request %s: %s %s", request.Status, request.Kind, target),
+		Body:    body,
+	})
+	if err != nil {
+		log.Printf("access requests: failed to notify %s of request %d: %v", requester.Email, request.ID, err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint access requests
+
+// getAccessRequestsList retourne les demandes de l'appelant et celles qu'il peut approuver, filtrées par ?status=
+func getAccessRequestsList(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		query := db.Order("id")
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		var requests []AccessRequest
+		if err := query.Find(&requests).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access requests"})
+			return
+		}
+		approver, err := newAccessApprover(db, caller)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+			return
+		}
+
+		visible := []AccessRequest{}
+		for _, request := range requests {
+			decision, err := approver.allows(request)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching resource"})
+				return
+			}
+			request.CanApprove = decision.Allowed && request.Status == accessPending
+			if decision.Allowed || request.RequesterID == caller.ID {
+				visible = append(visible, request)
+			}
+		}
+		c.JSON(http.StatusOK, visible)
+	}
+}
+
+// createAccessRequest enregistre la demande de l'appelant et prévient les approbateurs
+func createAccessRequest(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		var body struct {
+			Kind          string     `json:"kind"`
+			TargetID      uint       `json:"target_id"`
+			Justification string     `json:"justification"`
+			ValidUntil    *time.Time `json:"valid_until"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid access request"})
+			return
+		}
+		t, ok := accessKinds[body.Kind]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be role or group"})
+			return
+		}
+		if strings.TrimSpace(body.Justification) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "justification is required"})
+			return
+		}
+		if message := (grantOptions{ValidUntil: body.ValidUntil}).validate(); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		target := t.target()
+		if err := db.Where("id = ?", body.TargetID).First(target).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": t.label + " not found"})
+			return
+		}
+
+		var count int
+		if err := whereActiveGrant(db.Table(t.table), t.table).Where("user_id = ? AND "+t.column+" = ?", caller.ID, body.TargetID).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching grants"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "You already have this " + t.kind})
+			return
+		}
+		if err := db.Model(&AccessRequest{}).Where("requester_id = ? AND kind = ? AND target_id = ? AND status = ?", caller.ID, t.kind, body.TargetID, accessPending).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access requests"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A request for this " + t.kind + " is already pending"})
+			return
+		}
+
+		request := AccessRequest{
+			RequesterID:   caller.ID,
+			Kind:          t.kind,
+			TargetID:      body.TargetID,
+			Justification: body.Justification,
+			ValidUntil:    body.ValidUntil,
+			Status:        accessPending,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&request).Error; err != nil {
+				return err
+			}
+			return enqueueEvent(tx, "access_request.created", "access_request", request.ID, request)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating access request"})
+			return
+		}
+		recordAudit(db, c, "access_request.create", "access_request", request.ID, nil, request)
+		notifyAccessRequest(db, request, caller, targetName(target))
+		c.JSON(http.StatusCreated, request)
+	}
+}
+
+// approveAccessRequest accepte une demande en attente et accorde le grant demandé, dans la même transaction
+func approveAccessRequest(db *gorm.DB) gin.HandlerFunc {
+	return decideAccessRequest(db, accessApproved)
+}
+
+// denyAccessRequest refuse une demande en attente
+func denyAccessRequest(db *gorm.DB) gin.HandlerFunc {
+	return decideAccessRequest(db, accessDenied)
+}
+
+func decideAccessRequest(db *gorm.DB, status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		var request AccessRequest
+		if err := db.Where("id = ?", c.Param("id")).First(&request).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access request not found"})
+			return
+		}
+		var body struct {
+			Comment string `json:"comment"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid decision"})
+			return
+		}
+		if request.Status != accessPending {
+			c.JSON(http.StatusConflict, gin.H{"error": "Access request is " + request.Status})
+			return
+		}
+
+		approver, err := newAccessApprover(db, caller)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+			return
+		}
+		decision, err := approver.allows(request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching resource"})
+			return
+		}
+		if !decision.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "reason": decision.Reason})
+			return
+		}
+
+		t := accessKinds[request.Kind]
+		target := t.target()
+		if err := db.Where("id = ?", request.TargetID).First(target).Error; err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": t.label + " no longer exists"})
+			return
+		}
+		var requester User
+		if err := db.Where("id = ?", request.RequesterID).First(&requester).Error; err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Requester no longer exists"})
+			return
+		}
+		options := grantOptions{ValidUntil: request.ValidUntil, Reason: request.Justification, GrantedByID: &caller.ID}
+		if status == accessApproved && options.validate() != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "The requested period has ended"})
+			return
+		}
+
+		before := request
+		now := time.Now()
+		request.Status = status
+		request.DecidedByID = &caller.ID
+		request.DecisionComment = body.Comment
+		request.DecidedAt = &now
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// un autre approbateur a pu décider entre-temps
+			result := tx.Model(&AccessRequest{}).Where("id = ? AND status = ?", request.ID, accessPending).UpdateColumns(map[string]interface{}{
+				"status":           request.Status,
+				"decided_by_id":    request.DecidedByID,
+				"decision_comment": request.DecisionComment,
+				"decided_at":       request.DecidedAt,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errAccessRequestDecided
+			}
+			if status == accessApproved {
+				if err := t.grant(tx, request.RequesterID, request.TargetID, options); err != nil {
+					return err
+				}
+				if err := t.changed(tx, request.RequesterID, request.TargetID); err != nil {
+					return err
+				}
+			}
+			return enqueueEvent(tx, "access_request."+status, "access_request", request.ID, request)
+		})
+		if err == errAccessRequestDecided {
+			c.JSON(http.StatusConflict, gin.H{"error": "Access request already decided"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating access request"})
+			return
+		}
+
+		action := map[string]string{accessApproved: "access_request.approve", accessDenied: "access_request.deny"}[status]
+		recordAudit(db, c, action, "access_request", request.ID, before, request)
+		if status == accessApproved {
+			details := grantDetails(t.column, request.TargetID, options)
+			details["access_request_id"] = request.ID
+			recordAudit(db, c, t.actions[0], "user", request.RequesterID, nil, details)
+		}
+		notifyAccessDecision(request, requester, targetName(target))
+		c.JSON(http.StatusOK, request)
+	}
+}
+
+// cancelAccessRequest annule une demande en attente; seul le demandeur peut l'annuler
+func cancelAccessRequest(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		var request AccessRequest
+		if err := db.Where("id = ? AND requester_id = ?", c.Param("id"), caller.ID).First(&request).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access request not found"})
+			return
+		}
+		before := request
+		request.Status = accessCancelled
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&AccessRequest{}).Where("id = ? AND status = ?", request.ID, accessPending).UpdateColumn("status", accessCancelled)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errAccessRequestDecided
+			}
+			return enqueueEvent(tx, "access_request.cancelled", "access_request", request.ID, request)
+		})
+		if err == errAccessRequestDecided {
+			c.JSON(http.StatusConflict, gin.H{"error": "Access request is " + before.Status})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating access request"})
+			return
+		}
+		recordAudit(db, c, "access_request.cancel", "access_request", request.ID, before, request)
+		c.JSON(http.StatusOK, request)
+	}
+}
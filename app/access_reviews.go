@@ -0,0 +1,616 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// AccessReview est une campagne de certification: les grants du périmètre (rôles et groupes choisis, tous si
+// aucun) sont copiés à la création et répartis entre les relecteurs, qui certifient ou révoquent chacun;
+// les révocations sont appliquées à la clôture.
+type AccessReview struct {
+	ID             uint           `gorm:"primary_key" json:"id"`
+	OrganizationID uint           `json:"organization_id"`
+	Name           string         `json:"name"`
+	RoleIDs        pq.Int64Array  `gorm:"type:integer[]" json:"role_ids"`
+	GroupIDs       pq.Int64Array  `gorm:"type:integer[]" json:"group_ids"`
+	ReviewerIDs    pq.Int64Array  `gorm:"type:integer[]" json:"reviewer_ids"`
+	CreatedByID    uint           `json:"created_by_id"`
+	DueAt          *time.Time     `json:"due_at"`
+	ClosedAt       *time.Time     `json:"closed_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Status         string         `gorm:"-" json:"status"`   // open ou closed
+	Progress       map[string]int `gorm:"-" json:"progress"` // nombre d'éléments par décision
+}
+
+// AccessReviewItem est un grant copié dans la campagne, avec la décision de son relecteur
+type AccessReviewItem struct {
+	ID             uint       `gorm:"primary_key" json:"id"`
+	OrganizationID uint       `json:"organization_id"`
+	ReviewID       uint       `json:"review_id"`
+	Kind           string     `json:"kind"` // role ou group
+	UserID         uint       `json:"user_id"`
+	TargetID       uint       `json:"target_id"`
+	ValidFrom      time.Time  `json:"valid_from"`
+	ValidUntil     *time.Time `json:"valid_until"`
+	Reason         string     `json:"reason"`
+	ReviewerID     *uint      `json:"reviewer_id"` // vide: seul le créateur de la campagne décide
+	Decision       string     `gorm:"default:'pending'" json:"decision"`
+	Comment        string     `json:"comment"`
+	DecidedByID    *uint      `json:"decided_by_id"`
+	DecidedAt      *time.Time `json:"decided_at"`
+	AppliedAt      *time.Time `json:"applied_at"` // révocation appliquée à la clôture
+	UserEmail      string     `gorm:"-" json:"user_email"`
+	TargetName     string     `gorm:"-" json:"target_name"`
+}
+
+const (
+	reviewPending   = "pending"
+	reviewCertified = "certified"
+	reviewRevoked   = "revoked"
+)
+
+var errReviewClosed = errors.New("access review already closed")
+
+func (r *AccessReview) fill(db *gorm.DB) error {
+	r.Status = "open"
+	if r.ClosedAt != nil {
+		r.Status = "closed"
+	}
+	rows, err := db.Model(&AccessReviewItem{}).Select("decision, COUNT(*)").Where("review_id = ?", r.ID).Group("decision").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	r.Progress = map[string]int{reviewPending: 0, reviewCertified: 0, reviewRevoked: 0}
+	for rows.Next() {
+		var decision string
+		var count int
+		if err := rows.Scan(&decision, &count); err != nil {
+			return err
+		}
+		r.Progress[decision] = count
+	}
+	return rows.Err()
+}
+
+// snapshotGrants copie les grants du périmètre (expirés exclus) de l'organisation org, et les répartit
+// entre les relecteurs à tour de rôle; personne ne relit ses propres grants
+func snapshotGrants(db *gorm.DB, org uint, review AccessReview) ([]AccessReviewItem, error) {
+	scopes := []struct {
+		t   grantTable
+		ids pq.Int64Array
+	}{{roleGrants, review.RoleIDs}, {groupGrants, review.GroupIDs}}
+	all := len(review.RoleIDs) == 0 && len(review.GroupIDs) == 0
+
+	items := []AccessReviewItem{}
+	next := 0
+	for _, scope := range scopes {
+		if !all && len(scope.ids) == 0 {
+			continue
+		}
+		t, ids := scope.t, scope.ids
+		grants, err := t.find(db, func(query *gorm.DB) *gorm.DB {
+			query = query.Joins("JOIN users ON users.id = "+t.table+".user_id").
+				Where("users.organization_id = ? AND users.deleted_at IS NULL", org).
+				Where(t.table+".valid_until IS NULL OR "+t.table+".valid_until > ?", time.Now())
+			if t.derived {
+				// une appartenance dérivée suit la règle du groupe, elle ne se certifie pas
+				query = query.Where("NOT " + t.table + ".rule_derived")
+			}
+			if len(ids) > 0 {
+				query = query.Where(t.table+"."+t.column+" IN (?)", []int64(ids))
+			}
+			return query
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, grant := range grants {
+			item := AccessReviewItem{
+				Kind:       grant.Kind,
+				UserID:     grant.UserID,
+				TargetID:   grant.TargetID,
+				ValidFrom:  grant.ValidFrom,
+				ValidUntil: grant.ValidUntil,
+				Reason:     grant.Reason,
+				Decision:   reviewPending,
+			}
+			for i := range review.ReviewerIDs {
+				reviewerID := uint(review.ReviewerIDs[(next+i)%len(review.ReviewerIDs)])
+				if reviewerID != grant.UserID {
+					item.ReviewerID = &reviewerID
+					next += i + 1
+					break
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+// describeItems ajoute l'email de l'utilisateur et le nom du rôle ou du groupe de chaque élément
+func describeItems(db *gorm.DB, items []AccessReviewItem) error {
+	ids := map[string][]uint{}
+	for _, item := range items {
+		ids["user"] = append(ids["user"], item.UserID)
+		ids[item.Kind] = append(ids[item.Kind], item.TargetID)
+	}
+	var users []User
+	var roles []Role
+	var groups []Group
+	for _, load := range []struct {
+		ids   []uint
+		model interface{}
+	}{{ids["user"], &users}, {ids["role"], &roles}, {ids["group"], &groups}} {
+		if len(load.ids) > 0 {
+			if err := db.Unscoped().Where("id IN (?)", load.ids).Find(load.model).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	names := map[string]map[uint]string{"user": {}, "role": {}, "group": {}}
+	for _, user := range users {
+		names["user"][user.ID] = user.Email
+	}
+	for _, role := range roles {
+		names["role"][role.ID] = role.Name
+	}
+	for _, group := range groups {
+		names["group"][group.ID] = group.Name
+	}
+	for i := range items {
+		items[i].UserEmail = names["user"][items[i].UserID]
+		items[i].TargetName = names[items[i].Kind][items[i].TargetID]
+	}
+	return nil
+}
+
+// notifyReviewers prévient chaque relecteur du nombre de grants qu'il doit relire; les erreurs sont loggées
+func notifyReviewers(db *gorm.DB, review AccessReview, items []AccessReviewItem) {
+	counts := map[uint]int{}
+	for _, item := range items {
+		if item.ReviewerID != nil {
+			counts[*item.ReviewerID]++
+		}
+	}
+	for reviewerID, count := range counts {
+		var reviewer User
+		if err := db.First(&reviewer, reviewerID).Error; err != nil {
+			log.Printf("access reviews: failed to load reviewer %d: %v", reviewerID, err)
+			continue
+		}
+		due := ""
+		if review.DueAt != nil {
+			due = " before " + review.DueAt.Format(time.RFC1123)
+		}
+		err := mailer.Send(Mail{
+			To:      reviewer.Email,
+			Subject: "Access review: " + review.Name,
+			Body: fmt.Sprintf("Hello %s,\n\nYou have %d grants to certify or revoke in the access review %q%s.\n\n"+
+				"Run the review from the CLI:\ncli reviews run %d\n", reviewer.Name, count, review.Name, due, review.ID),
+		})
+		if err != nil {
+			log.Printf("access reviews: failed to notify %s of review %d: %v", reviewer.Email, review.ID, err)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint access reviews
+
+// getAccessReviewsList retourne les campagnes avec leur avancement
+func getAccessReviewsList(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		reviews := []AccessReview{}
+		if err := db.Order("id").Find(&reviews).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access reviews"})
+			return
+		}
+		for i := range reviews {
+			if err := reviews[i].fill(db); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access reviews"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, reviews)
+	}
+}
+
+// getAssignedAccessReviews retourne les campagnes ouvertes où l'appelant a des grants à relire
+func getAssignedAccessReviews(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		reviews := []AccessReview{}
+		err := db.Where("closed_at IS NULL AND id IN (?)",
+			db.Model(&AccessReviewItem{}).Select("review_id").Where("reviewer_id = ? AND decision = ?", caller.ID, reviewPending).SubQuery()).
+			Order("id").Find(&reviews).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access reviews"})
+			return
+		}
+		for i := range reviews {
+			if err := reviews[i].fill(db); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access reviews"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, reviews)
+	}
+}
+
+// getAccessReview retourne une campagne avec son avancement
+func getAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var review AccessReview
+		if err := db.Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access review not found"})
+			return
+		}
+		if err := review.fill(db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review"})
+			return
+		}
+		c.JSON(http.StatusOK, review)
+	}
+}
+
+// createAccessReview ouvre une campagne: copie des grants du périmètre et répartition entre les relecteurs
+func createAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		var body struct {
+			Name        string     `json:"name"`
+			RoleIDs     []int64    `json:"role_ids"`
+			GroupIDs    []int64    `json:"group_ids"`
+			ReviewerIDs []int64    `json:"reviewer_ids"`
+			DueAt       *time.Time `json:"due_at"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid access review data"})
+			return
+		}
+		if strings.TrimSpace(body.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+			return
+		}
+		if len(body.ReviewerIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reviewer_ids is required"})
+			return
+		}
+		for _, check := range []struct {
+			model   interface{}
+			ids     []int64
+			message string
+		}{
+			{&Role{}, body.RoleIDs, "Role not found"},
+			{&Group{}, body.GroupIDs, "Group not found"},
+			{&User{}, body.ReviewerIDs, "Reviewer not found"},
+		} {
+			found, err := countExisting(db, check.model, check.ids)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating access review"})
+				return
+			}
+			if !found {
+				c.JSON(http.StatusBadRequest, gin.H{"error": check.message})
+				return
+			}
+		}
+
+		review := AccessReview{
+			Name:        body.Name,
+			RoleIDs:     body.RoleIDs,
+			GroupIDs:    body.GroupIDs,
+			ReviewerIDs: body.ReviewerIDs,
+			CreatedByID: caller.ID,
+			DueAt:       body.DueAt,
+		}
+		items, err := snapshotGrants(db, c.MustGet("org").(uint), review)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching grants"})
+			return
+		}
+		if len(items) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No grants to review in this scope"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&review).Error; err != nil {
+				return err
+			}
+			for i := range items {
+				items[i].ReviewID = review.ID
+				if err := tx.Create(&items[i]).Error; err != nil {
+					return err
+				}
+			}
+			return enqueueEvent(tx, "access_review.created", "access_review", review.ID, review)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating access review"})
+			return
+		}
+		if err := review.fill(db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review"})
+			return
+		}
+		recordAudit(db, c, "access_review.create", "access_review", review.ID, nil, review)
+		notifyReviewers(db, review, items)
+		c.JSON(http.StatusCreated, review)
+	}
+}
+
+// getAccessReviewItems retourne les éléments que l'appelant relit (tous pour le créateur), filtrés par ?decision=
+func getAccessReviewItems(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		var review AccessReview
+		if err := db.Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access review not found"})
+			return
+		}
+		query := db.Where("review_id = ?", review.ID).Order("id")
+		if review.CreatedByID != caller.ID {
+			query = query.Where("reviewer_id = ?", caller.ID)
+		}
+		if decision := c.Query("decision"); decision != "" {
+			query = query.Where("decision = ?", decision)
+		}
+		items := []AccessReviewItem{}
+		if err := query.Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review items"})
+			return
+		}
+		if err := describeItems(db, items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review items"})
+			return
+		}
+		c.JSON(http.StatusOK, items)
+	}
+}
+
+// decideAccessReviewItem certifie ou révoque un élément tant que la campagne est ouverte; la décision peut être
+// changée jusqu'à la clôture. Seul le relecteur de l'élément (ou le créateur de la campagne) décide, jamais l'utilisateur concerné.
+func decideAccessReviewItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		var review AccessReview
+		if err := db.Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access review not found"})
+			return
+		}
+		var item AccessReviewItem
+		if err := db.Where("id = ? AND review_id = ?", c.Param("item_id"), review.ID).First(&item).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access review item not found"})
+			return
+		}
+		var body struct {
+			Decision string `json:"decision"`
+			Comment  string `json:"comment"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid decision"})
+			return
+		}
+		decision := map[string]string{"certify": reviewCertified, "revoke": reviewRevoked}[body.Decision]
+		if decision == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be certify or revoke"})
+			return
+		}
+		if review.ClosedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Access review is closed"})
+			return
+		}
+		isReviewer := item.ReviewerID != nil && *item.ReviewerID == caller.ID
+		if item.UserID == caller.ID || (!isReviewer && review.CreatedByID != caller.ID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not the reviewer of this grant"})
+			return
+		}
+
+		before := item
+		now := time.Now()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// verrouille la campagne: une clôture en cours attend la décision, ou la décision voit la clôture
+			var open []uint
+			if err := tx.Raw("SELECT id FROM access_reviews WHERE id = ? AND closed_at IS NULL FOR UPDATE", review.ID).Pluck("id", &open).Error; err != nil {
+				return err
+			}
+			if len(open) == 0 {
+				return errReviewClosed
+			}
+			return tx.Model(&item).UpdateColumns(map[string]interface{}{
+				"decision":      decision,
+				"comment":       body.Comment,
+				"decided_by_id": caller.ID,
+				"decided_at":    now,
+			}).Error
+		})
+		if err == errReviewClosed {
+			c.JSON(http.StatusConflict, gin.H{"error": "Access review is closed"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating access review item"})
+			return
+		}
+		item.Decision, item.Comment, item.DecidedByID, item.DecidedAt = decision, body.Comment, &caller.ID, &now
+		recordAudit(db, c, "access_review."+body.Decision, "access_review", review.ID, before, item)
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// closeAccessReview clôt une campagne et révoque les grants refusés; avec {"revoke_unreviewed": true}
+// les éléments sans décision sont révoqués aussi
+func closeAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var review AccessReview
+		if err := db.Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access review not found"})
+			return
+		}
+		var body struct {
+			RevokeUnreviewed bool `json:"revoke_unreviewed"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid close request"})
+			return
+		}
+
+		var revoked []AccessReviewItem
+		skipped := 0
+		now := time.Now()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&AccessReview{}).Where("id = ? AND closed_at IS NULL", review.ID).UpdateColumn("closed_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errReviewClosed
+			}
+			review.ClosedAt = &now
+
+			if body.RevokeUnreviewed {
+				err := tx.Model(&AccessReviewItem{}).Where("review_id = ? AND decision = ?", review.ID, reviewPending).
+					UpdateColumns(map[string]interface{}{"decision": reviewRevoked, "comment": "Not reviewed before close", "decided_at": now}).Error
+				if err != nil {
+					return err
+				}
+			}
+			var decided []AccessReviewItem
+			if err := tx.Where("review_id = ? AND decision = ?", review.ID, reviewRevoked).Order("id").Find(&decided).Error; err != nil {
+				return err
+			}
+			// seul le grant relevé par la campagne est retiré: un grant réattribué ou dérivé d'une règle depuis
+			// reste, et son élément n'a pas de applied_at
+			var applied []uint
+			for _, item := range decided {
+				t := accessKinds[item.Kind]
+				ok, err := t.revokeSnapshot(tx, item.UserID, item.TargetID, item.ValidFrom)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					skipped++
+					continue
+				}
+				if err := t.changed(tx, item.UserID, item.TargetID); err != nil {
+					return err
+				}
+				revoked = append(revoked, item)
+				applied = append(applied, item.ID)
+			}
+			if len(applied) > 0 {
+				if err := tx.Model(&AccessReviewItem{}).Where("id IN (?)", applied).UpdateColumn("applied_at", now).Error; err != nil {
+					return err
+				}
+			}
+			return enqueueEvent(tx, "access_review.closed", "access_review", review.ID, review)
+		})
+		if err == errReviewClosed {
+			c.JSON(http.StatusConflict, gin.H{"error": "Access review is closed"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error closing access review"})
+			return
+		}
+
+		for _, item := range revoked {
+			t := accessKinds[item.Kind]
+			recordAudit(db, c, t.actions[1], "user", item.UserID, gin.H{t.column: item.TargetID, "access_review_id": review.ID}, nil)
+		}
+		if err := review.fill(db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review"})
+			return
+		}
+		recordAudit(db, c, "access_review.close", "access_review", review.ID, nil, gin.H{"revoked": len(revoked), "skipped": skipped, "progress": review.Progress})
+		c.JSON(http.StatusOK, review)
+	}
+}
+
+// exportAccessReview retourne le rapport de la campagne: JSON (campagne et éléments) ou ?format=csv (un élément par ligne)
+func exportAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var review AccessReview
+		if err := db.Where("id = ?", c.Param("id")).First(&review).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Access review not found"})
+			return
+		}
+		items := []AccessReviewItem{}
+		if err := db.Where("review_id = ?", review.ID).Order("id").Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review items"})
+			return
+		}
+		if err := review.fill(db); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review"})
+			return
+		}
+		if err := describeItems(db, items); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching access review items"})
+			return
+		}
+
+		filename := fmt.Sprintf("access-review-%d", review.ID)
+		if c.Query("format") != "csv" {
+			c.Header("Content-Disposition", "attachment; filename="+filename+".json")
+			c.JSON(http.StatusOK, gin.H{"review": review, "items": items})
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"item_id", "kind", "user_id", "user_email", "target_id", "target_name", "valid_from", "valid_until",
+			"reason", "reviewer_id", "decision", "comment", "decided_by_id", "decided_at", "applied_at"})
+		for _, item := range items {
+			w.Write([]string{
+				strconv.FormatUint(uint64(item.ID), 10), item.Kind,
+				strconv.FormatUint(uint64(item.UserID), 10), item.UserEmail,
+				strconv.FormatUint(uint64(item.TargetID), 10), item.TargetName,
+				item.ValidFrom.Format(time.RFC3339), formatOptionalTime(item.ValidUntil), item.Reason,
+				formatOptionalID(item.ReviewerID), item.Decision, item.Comment,
+				formatOptionalID(item.DecidedByID), formatOptionalTime(item.DecidedAt), formatOptionalTime(item.AppliedAt),
+			})
+		}
+		w.Flush()
+	}
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func formatOptionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Attributs personnalisés: les administrateurs définissent les attributs des utilisateurs de leur organisation
+// (département, matricule, téléphone...). Les valeurs sont stockées dans users.attributes (jsonb) et vérifiées
+// contre les définitions par validateUserAttributes, à chaque création d'utilisateur (REST, GraphQL, gRPC, SCIM,
+// synchronisation, invitations, signup) et à chaque modification par /users.
+
+// AttributeDefinition décrit un attribut: son type, s'il est obligatoire ou unique dans l'organisation,
+// l'expression régulière que doivent respecter ses valeurs string, et sa valeur par défaut (donnée aux utilisateurs
+// qui n'en ont pas, ceux créés sans attributs par SCIM ou la synchronisation par exemple)
+type AttributeDefinition struct {
+	ID             uint      `gorm:"primary_key" json:"id"`
+	OrganizationID uint      `json:"organization_id"`
+	Key            string    `json:"key"`
+	Label          string    `json:"label"`
+	Type           string    `json:"type"` // string, number, boolean ou date (YYYY-MM-DD)
+	Required       bool      `json:"required"`
+	Unique         bool      `json:"unique"`
+	Pattern        string    `json:"pattern"`
+	Default        JSONB     `gorm:"column:default_value;type:jsonb" json:"default"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+const (
+	attributeString  = "string"
+	attributeNumber  = "number"
+	attributeBoolean = "boolean"
+	attributeDate    = "date"
+)
+
+var (
+	attributeTypes  = map[string]bool{attributeString: true, attributeNumber: true, attributeBoolean: true, attributeDate: true}
+	attributeKeyRe  = regexp.MustCompile(`^[a-z][a-z0-9_]{0,62}$`)
+	attributeFilter = "attr." // préfixe des filtres de GET /users (?attr.department=Sales)
+)
+
+// attributeError est une erreur de validation à renvoyer au client avec son statut
+type attributeError struct {
+	status  int
+	message string
+}
+
+func (e *attributeError) Error() string { return e.message }
+
+func invalidAttributes(format string, args ...interface{}) error {
+	return &attributeError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+// respondAttributeError renvoie une attributeError telle quelle, toute autre erreur en 500
+func respondAttributeError(c *gin.Context, err error) {
+	if invalid, ok := err.(*attributeError); ok {
+		c.JSON(invalid.status, gin.H{"error": invalid.message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating attributes"})
+}
+
+// validate vérifie une définition
+func (d AttributeDefinition) validate() string {
+	if !attributeKeyRe.MatchString(d.Key) {
+		return "key must be lowercase letters, digits and underscores, starting with a letter"
+	}
+	if !attributeTypes[d.Type] {
+		return "type must be string, number, boolean or date"
+	}
+	if d.Pattern != "" {
+		if d.Type != attributeString {
+			return "pattern is only allowed on string attributes"
+		}
+		if _, err := regexp.Compile(d.Pattern); err != nil {
+			return fmt.Sprintf("invalid pattern: %v", err)
+		}
+	}
+	if value, ok := d.defaultValue(); ok {
+		if d.Unique {
+			return "a unique attribute cannot have a default"
+		}
+		if _, err := d.coerce(value); err != nil {
+			return "default: " + err.Error()
+		}
+	}
+	return ""
+}
+
+// defaultValue retourne la valeur par défaut, false s'il n'y en a pas
+func (d AttributeDefinition) defaultValue() (interface{}, bool) {
+	var value interface{}
+	if len(d.Default) == 0 || json.Unmarshal(d.Default, &value) != nil || value == nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// coerce vérifie le type d'une valeur; les chaînes sont acceptées pour les nombres et les booléens ("42", "true")
+func (d AttributeDefinition) coerce(value interface{}) (interface{}, error) {
+	switch d.Type {
+	case attributeNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			if number, err := strconv.ParseFloat(v, 64); err == nil {
+				return number, nil
+			}
+		}
+		return nil, invalidAttributes("attribute %q must be a number", d.Key)
+	case attributeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, invalidAttributes("attribute %q must be a boolean", d.Key)
+	case attributeDate:
+		if v, ok := value.(string); ok {
+			if _, err := time.Parse("2006-01-02", v); err == nil {
+				return v, nil
+			}
+		}
+		return nil, invalidAttributes("attribute %q must be a date (YYYY-MM-DD)", d.Key)
+	default:
+		v, ok := value.(string)
+		if !ok {
+			return nil, invalidAttributes("attribute %q must be a string", d.Key)
+		}
+		if d.Pattern != "" && !regexp.MustCompile(d.Pattern).MatchString(v) {
+			return nil, invalidAttributes("attribute %q does not match %s", d.Key, d.Pattern)
+		}
+		return v, nil
+	}
+}
+
+// attributeMatch est le document {clé: valeur} des recherches par containment (attributes @> ...),
+// qui utilisent l'index GIN de users.attributes
+func attributeMatch(key string, value interface{}) string {
+	return string(toJSONB(map[string]interface{}{key: value}))
+}
+
+// attributeValues décode les attributs de l'utilisateur ({} s'il n'en a pas)
+func (u User) attributeValues() map[string]interface{} {
+	values := map[string]interface{}{}
+	if len(u.Attributes) > 0 {
+		json.Unmarshal(u.Attributes, &values)
+	}
+	return values
+}
+
+// mergeAttributes applique les attributs envoyés à ceux de l'utilisateur: une valeur null retire l'attribut
+func mergeAttributes(current, changes JSONB) (JSONB, error) {
+	values := User{Attributes: current}.attributeValues()
+	var sent map[string]interface{}
+	if err := json.Unmarshal(changes, &sent); err != nil {
+		return nil, invalidAttributes("attributes must be an object")
+	}
+	for key, value := range sent {
+		values[key] = value
+	}
+	return toJSONB(values), nil
+}
+
+// validateUserAttributes vérifie les attributs de l'utilisateur contre les définitions de son organisation
+// (db limité à l'organisation) et les normalise: valeurs converties, null retirés, {} si vide
+func validateUserAttributes(db *gorm.DB, user *User) error {
+	var definitions []AttributeDefinition
+	if err := db.Find(&definitions).Error; err != nil {
+		return err
+	}
+	byKey := make(map[string]AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byKey[definition.Key] = definition
+	}
+
+	values := map[string]interface{}{}
+	if len(user.Attributes) > 0 && string(user.Attributes) != "null" {
+		if err := json.Unmarshal(user.Attributes, &values); err != nil {
+			return invalidAttributes("attributes must be an object")
+		}
+	}
+	for key, value := range values {
+		if value == nil {
+			delete(values, key)
+			continue
+		}
+		definition, ok := byKey[key]
+		if !ok {
+			return invalidAttributes("unknown attribute %q", key)
+		}
+		coerced, err := definition.coerce(value)
+		if err != nil {
+			return err
+		}
+		values[key] = coerced
+	}
+
+	for _, definition := range definitions {
+		value, ok := values[definition.Key]
+		if !ok {
+			if value, ok = definition.defaultValue(); ok {
+				values[definition.Key], _ = definition.coerce(value)
+				continue
+			}
+			if definition.Required {
+				return invalidAttributes("attribute %q is required", definition.Key)
+			}
+			continue
+		}
+		if definition.Unique {
+			var count int
+			err := db.Model(&User{}).Where("attributes @> CAST(? AS jsonb) AND id <> ?", attributeMatch(definition.Key, value), user.ID).Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return &attributeError{status: http.StatusConflict, message: fmt.Sprintf("attribute %q is already used by another user", definition.Key)}
+			}
+		}
+	}
+	user.Attributes = toJSONB(values)
+	return nil
+}
+
+// filterAttributes applique à query les filtres ?attr.<clé>=<valeur> de la requête (égalité sur la valeur convertie)
+func filterAttributes(db *gorm.DB, c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	var keys []string
+	for param := range c.Request.URL.Query() {
+		if strings.HasPrefix(param, attributeFilter) {
+			keys = append(keys, strings.TrimPrefix(param, attributeFilter))
+		}
+	}
+	if len(keys) == 0 {
+		return query, nil
+	}
+	sort.Strings(keys)
+
+	var definitions []AttributeDefinition
+	if err := db.Where("key IN (?)", keys).Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byKey[definition.Key] = definition
+	}
+	for _, key := range keys {
+		definition, ok := byKey[key]
+		if !ok {
+			return nil, invalidAttributes("unknown attribute %q", key)
+		}
+		value, err := definition.coerce(c.Query(attributeFilter + key))
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("users.attributes @> CAST(? AS jsonb)", attributeMatch(key, value))
+	}
+	return query, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint attributes
+
+// getAttributeDefinitions liste les attributs définis dans l'organisation
+func getAttributeDefinitions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		definitions := []AttributeDefinition{}
+		if err := db.Order("key").Find(&definitions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching attributes"})
+			return
+		}
+		c.JSON(http.StatusOK, definitions)
+	}
+}
+
+// createAttributeDefinition définit un nouvel attribut
+func createAttributeDefinition(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var definition AttributeDefinition
+		if err := c.BindJSON(&definition); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attribute data"})
+			return
+		}
+		definition.ID = 0
+		if message := definition.validate(); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		if !db.Where("key = ?", definition.Key).First(&AttributeDefinition{}).RecordNotFound() {
+			c.JSON(http.StatusConflict, gin.H{"error": "Attribute already defined"})
+			return
+		}
+		if err := checkAttributeValues(db, c.MustGet("org").(uint), definition); err != nil {
+			respondAttributeError(c, err)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&definition).Error; err != nil {
+				return err
+			}
+			return backfillAttribute(tx, c.MustGet("org").(uint), definition)
+		})
+		if err != nil {
+			respondAttributeError(c, err)
+			return
+		}
+		recordAudit(db, c, "attribute.create", "attribute", definition.ID, nil, definition)
+		c.JSON(http.StatusCreated, definition)
+	}
+}
+
+// updateAttributeDefinition modifie un attribut; la clé et le type ne changent pas
+func updateAttributeDefinition(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var definition AttributeDefinition
+		if err := db.Where("id = ?", c.Param("id")).First(&definition).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attribute not found"})
+			return
+		}
+		before := definition
+
+		if err := c.BindJSON(&definition); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attribute data"})
+			return
+		}
+		definition.ID = before.ID
+		if definition.Key != before.Key || definition.Type != before.Type {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "key and type cannot be changed"})
+			return
+		}
+		if message := definition.validate(); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		if err := checkAttributeValues(db, c.MustGet("org").(uint), definition); err != nil {
+			respondAttributeError(c, err)
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&definition).Error; err != nil {
+				return err
+			}
+			return backfillAttribute(tx, c.MustGet("org").(uint), definition)
+		})
+		if err != nil {
+			respondAttributeError(c, err)
+			return
+		}
+		recordAudit(db, c, "attribute.update", "attribute", definition.ID, before, definition)
+		c.JSON(http.StatusOK, definition)
+	}
+}
+
+// deleteAttributeDefinition supprime un attribut et ses valeurs
+func deleteAttributeDefinition(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var definition AttributeDefinition
+		if err := db.Where("id = ?", c.Param("id")).First(&definition).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attribute not found"})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&definition).Error; err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE users SET attributes = attributes - CAST(? AS text) WHERE organization_id = ? AND attributes ->> CAST(? AS text) IS NOT NULL",
+				definition.Key, definition.OrganizationID, definition.Key).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting attribute"})
+			return
+		}
+		recordAudit(db, c, "attribute.delete", "attribute", definition.ID, definition, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Attribute deleted"})
+	}
+}
+
+// checkAttributeValues vérifie qu'une définition unique n'a pas déjà de doublons dans l'organisation org
+func checkAttributeValues(db *gorm.DB, org uint, definition AttributeDefinition) error {
+	if !definition.Unique {
+		return nil
+	}
+	var duplicates int
+	err := db.Raw("SELECT COUNT(*) FROM (SELECT attributes ->> CAST(? AS text) FROM users WHERE organization_id = ? AND deleted_at IS NULL "+
+		"AND attributes ->> CAST(? AS text) IS NOT NULL GROUP BY 1 HAVING COUNT(*) > 1) AS duplicates",
+		definition.Key, org, definition.Key).Row().Scan(&duplicates)
+	if err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return &attributeError{status: http.StatusConflict, message: fmt.Sprintf("attribute %q already has duplicate values", definition.Key)}
+	}
+	return nil
+}
+
+// backfillAttribute donne la valeur par défaut aux utilisateurs de l'organisation org qui n'ont pas l'attribut;
+// sans valeur par défaut, un attribut obligatoire est refusé (409) tant que des utilisateurs n'en ont pas
+func backfillAttribute(tx *gorm.DB, org uint, definition AttributeDefinition) error {
+	value, ok := definition.defaultValue()
+	if ok {
+		value, _ = definition.coerce(value)
+		return tx.Exec("UPDATE users SET attributes = COALESCE(attributes, '{}') || CAST(? AS jsonb) WHERE organization_id = ? "+
+			"AND deleted_at IS NULL AND attributes ->> CAST(? AS text) IS NULL",
+			attributeMatch(definition.Key, value), org, definition.Key).Error
+	}
+	if !definition.Required {
+		return nil
+	}
+	var missing int
+	err := tx.Model(&User{}).Where("organization_id = ? AND attributes ->> CAST(? AS text) IS NULL", org, definition.Key).Count(&missing).Error
+	if err != nil {
+		return err
+	}
+	if missing > 0 {
+		return &attributeError{status: http.StatusConflict,
+			message: fmt.Sprintf("%d users have no value for attribute %q: give it a default to fill them", missing, definition.Key)}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// AuditEvent est une entrée du journal d'audit (table append-only, voir setup.sql).
+// Chaque événement contient le hash du précédent, voir audit_chain.go.
+type AuditEvent struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	ActorID    *uint     `json:"actor_id"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	Diff       JSONB     `gorm:"type:jsonb" json:"diff"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	RequestID  string    `json:"request_id"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// champs ignorés dans les diffs d'audit
+var auditIgnoredFields = map[string]bool{"created_at": true, "updated_at": true, "auth_tokens": true, "meta": true}
+
+// requestID attribue un identifiant à chaque requête (X-Request-ID) pour corréler logs et audit
+func requestID(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if id == "" {
+		buf := make([]byte, 16)
+		rand.Read(buf)
+		id = hex.EncodeToString(buf)
+	}
+	c.Set("request_id", id)
+	c.Header("X-Request-ID", id)
+	c.Next()
+}
+
+// newAuditEvent prépare un événement à partir du contexte de la requête (acteur, IP, user agent)
+func newAuditEvent(c *gin.Context, action, targetType string, targetID interface{}, before, after interface{}) AuditEvent {
+	event := AuditEvent{
+		Actor:      "anonymous",
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		Diff:       toJSONB(auditDiff(before, after)),
+	}
+	if c == nil {
+		event.Actor = "system"
+		return event
+	}
+
+	if value, ok := c.Get("user"); ok {
+		if user, ok := value.(User); ok && user.ID != 0 {
+			event.ActorID = &user.ID
+			event.Actor = user.Email
+		}
+		// sous impersonation l'acteur est l'administrateur, l'utilisateur reste visible dans actor
+		if value, ok := c.Get("impersonator"); ok {
+			impersonator := value.(User)
+			event.Actor = fmt.Sprintf("%s (as %s)", impersonator.Email, event.Actor)
+			event.ActorID = &impersonator.ID
+		}
+	} else if actor := c.GetString("actor"); actor != "" {
+		event.Actor = actor
+	}
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	event.RequestID = c.GetString("request_id")
+	return event
+}
+
+// recordAudit enregistre un événement; une erreur d'écriture est loggée sans faire échouer la requête
+func recordAudit(db *gorm.DB, c *gin.Context, action, targetType string, targetID interface{}, before, after interface{}) {
+	saveAudit(db, newAuditEvent(c, action, targetType, targetID, before, after))
+}
+
+func saveAudit(db *gorm.DB, event AuditEvent) {
+	if err := appendAuditEvent(db, &event); err != nil {
+		log.Printf("audit: failed to record %s on %s %s: %v", event.Action, event.TargetType, event.TargetID, err)
+	}
+}
+
+// auditDiff retourne {champ: {before, after}} pour les champs modifiés
+func auditDiff(before, after interface{}) map[string]map[string]interface{} {
+	b, a := auditFields(before), auditFields(after)
+	diff := make(map[string]map[string]interface{})
+	for key, value := range b {
+		if !auditEqual(value, a[key]) {
+			diff[key] = map[string]interface{}{"before": value, "after": a[key]}
+		}
+	}
+	for key, value := range a {
+		if _, ok := b[key]; !ok && value != nil {
+			diff[key] = map[string]interface{}{"before": nil, "after": value}
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+func auditFields(v interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if v == nil {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	for key := range auditIgnoredFields {
+		delete(fields, key)
+	}
+	return fields
+}
+
+func auditEqual(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint audit
+
+// getAuditEvents liste le journal d'audit, filtré et paginé (page, per_page, total dans X-Total-Count)
+func getAuditEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&AuditEvent{})
+		for _, column := range []string{"actor_id", "actor", "action", "target_type", "target_id", "request_id", "ip"} {
+			if value := c.Query(column); value != "" {
+				query = query.Where(column+" = ?", value)
+			}
+		}
+		if afterID := c.Query("after_id"); afterID != "" {
+			query = query.Where("id > ?", afterID)
+		}
+		for param, operator := range map[string]string{"since": ">=", "until": "<"} {
+			if value := c.Query(param); value != "" {
+				t, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " date, expected RFC3339"})
+					return
+				}
+				query = query.Where("created_at "+operator+" ?", t)
+			}
+		}
+
+		var total int
+		if err := query.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching audit events"})
+			return
+		}
+
+		page, perPage := pagination(c)
+		order := "id desc"
+		if c.Query("order") == "asc" {
+			order = "id asc"
+		}
+
+		var events []AuditEvent
+		if err := query.Order(order).Offset((page - 1) * perPage).Limit(perPage).Find(&events).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching audit events"})
+			return
+		}
+		c.Header("X-Total-Count", strconv.Itoa(total))
+		c.JSON(http.StatusOK, events)
+	}
+}
+
+// pagination lit page (à partir de 1) et per_page (50 par défaut, 500 maximum)
+func pagination(c *gin.Context) (page, perPage int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err = strconv.Atoi(c.DefaultQuery("per_page", "50"))
+	if err != nil || perPage < 1 {
+		perPage = 50
+	}
+	if perPage > 500 {
+		perPage = 500
+	}
+	return page, perPage
+}
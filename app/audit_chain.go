@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// clé du verrou advisory qui sérialise l'ajout d'événements à la chaîne
+const auditChainLock = 7283001
+
+const auditExportFormat = "audit-export/v1"
+
+// AuditCheckpoint est une signature ed25519 du hash d'un événement, l'ensemble de la chaîne
+// jusqu'à cet événement ne peut plus être réécrit sans la clé privée
+type AuditCheckpoint struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	EventID   uint      `json:"event_id"`
+	Hash      string    `json:"hash"`
+	Signature string    `json:"signature"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type auditBreak struct {
+	EventID      uint   `json:"event_id"`
+	CheckpointID uint   `json:"checkpoint_id,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+type auditVerification struct {
+	Valid       bool        `json:"valid"`
+	Events      int         `json:"events"`
+	Checkpoints int         `json:"checkpoints"`
+	FirstBreak  *auditBreak `json:"first_break,omitempty"`
+}
+
+// auditExport est le format téléchargé par GET /audit/export et vérifié hors ligne par la CLI
+type auditExport struct {
+	Format      string            `json:"format"`
+	ExportedAt  time.Time         `json:"exported_at"`
+	PublicKey   string            `json:"public_key"`
+	Events      []AuditEvent      `json:"events"`
+	Checkpoints []AuditCheckpoint `json:"checkpoints"`
+}
+
+// auditHash calcule sha256(prev_hash + "\n" + JSON canonique de l'événement).
+// L'ID n'en fait pas partie puisqu'il est attribué par la base; la CLI utilise le même calcul.
+func auditHash(event AuditEvent) string {
+	var diff interface{}
+	if len(event.Diff) > 0 {
+		// jsonb ne conserve ni l'ordre des clés ni les espaces: on re-sérialise
+		json.Unmarshal(event.Diff, &diff)
+	}
+	canonical, _ := json.Marshal(struct {
+		ActorID    *uint       `json:"actor_id"`
+		Actor      string      `json:"actor"`
+		Action     string      `json:"action"`
+		TargetType string      `json:"target_type"`
+		TargetID   string      `json:"target_id"`
+		Diff       interface{} `json:"diff"`
+		IP         string      `json:"ip"`
+		UserAgent  string      `json:"user_agent"`
+		RequestID  string      `json:"request_id"`
+		CreatedAt  string      `json:"created_at"`
+	}{
+		event.ActorID, event.Actor, event.Action, event.TargetType, event.TargetID, diff,
+		event.IP, event.UserAgent, event.RequestID, event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(append([]byte(event.PrevHash+"\n"), canonical...))
+	return hex.EncodeToString(sum[:])
+}
+
+// appendAuditEvent ajoute l'événement au bout de la chaîne
+func appendAuditEvent(db *gorm.DB, event *AuditEvent) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock).Error; err != nil {
+			return err
+		}
+
+		var last AuditEvent
+		if err := tx.Order("id desc").First(&last).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+
+		// la colonne est un TIMESTAMP à la microseconde
+		event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		event.PrevHash = last.Hash
+		event.Hash = auditHash(*event)
+		return tx.Create(event).Error
+	})
+}
+
+// auditChainVerifier vérifie les événements un par un, dans l'ordre des IDs
+type auditChainVerifier struct {
+	prevHash string
+	hashes   map[uint]string
+	result   auditVerification
+}
+
+func newAuditChainVerifier() *auditChainVerifier {
+	return &auditChainVerifier{hashes: map[uint]string{}, result: auditVerification{Valid: true}}
+}
+
+func (v *auditChainVerifier) fail(b auditBreak) {
+	if v.result.FirstBreak == nil {
+		v.result.Valid = false
+		v.result.FirstBreak = &b
+	}
+}
+
+func (v *auditChainVerifier) checkEvent(event AuditEvent) {
+	v.result.Events++
+	switch {
+	case event.PrevHash != v.prevHash:
+		v.fail(auditBreak{EventID: event.ID, Reason: "prev_hash does not match the previous event (missing or reordered event)"})
+	case auditHash(event) != event.Hash:
+		v.fail(auditBreak{EventID: event.ID, Reason: "hash does not match the event content (event altered)"})
+	}
+	v.prevHash = event.Hash
+	v.hashes[event.ID] = event.Hash
+}
+
+func (v *auditChainVerifier) checkCheckpoint(checkpoint AuditCheckpoint, publicKey ed25519.PublicKey) {
+	v.result.Checkpoints++
+	hash, ok := v.hashes[checkpoint.EventID]
+	switch {
+	case !ok:
+		v.fail(auditBreak{EventID: checkpoint.EventID, CheckpointID: checkpoint.ID, Reason: "checkpointed event is missing"})
+	case hash != checkpoint.Hash:
+		v.fail(auditBreak{EventID: checkpoint.EventID, CheckpointID: checkpoint.ID, Reason: "checkpoint hash does not match the event"})
+	case publicKey != nil && !verifyAuditCheckpoint(checkpoint, publicKey):
+		v.fail(auditBreak{EventID: checkpoint.EventID, CheckpointID: checkpoint.ID, Reason: "invalid checkpoint signature"})
+	}
+}
+
+// verifyAuditLog parcourt toute la chaîne par lots puis vérifie les checkpoints
+func verifyAuditLog(db *gorm.DB) (auditVerification, error) {
+	v := newAuditChainVerifier()
+	var lastID uint
+	for {
+		var events []AuditEvent
+		if err := db.Where("id > ?", lastID).Order("id").Limit(1000).Find(&events).Error; err != nil {
+			return v.result, err
+		}
+		if len(events) == 0 {
+			break
+		}
+		for _, event := range events {
+			v.checkEvent(event)
+		}
+		lastID = events[len(events)-1].ID
+	}
+
+	var checkpoints []AuditCheckpoint
+	if err := db.Order("id").Find(&checkpoints).Error; err != nil {
+		return v.result, err
+	}
+	publicKey := auditPublicKey()
+	for _, checkpoint := range checkpoints {
+		v.checkCheckpoint(checkpoint, publicKey)
+	}
+	return v.result, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Checkpoints signés
+
+// auditSigningKey lit AUDIT_SIGNING_KEY (graine ed25519 de 32 octets en base64, voir app audit keygen)
+func auditSigningKey() (ed25519.PrivateKey, error) {
+	encoded := os.Getenv("AUDIT_SIGNING_KEY")
+	if encoded == "" {
+		return nil, errors.New("AUDIT_SIGNING_KEY is not set")
+	}
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("AUDIT_SIGNING_KEY must be a base64 encoded 32 byte seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func auditPublicKey() ed25519.PublicKey {
+	key, err := auditSigningKey()
+	if err != nil {
+		return nil
+	}
+	return key.Public().(ed25519.PublicKey)
+}
+
+func auditCheckpointMessage(checkpoint AuditCheckpoint) []byte {
+	return []byte(fmt.Sprintf("%d:%s", checkpoint.EventID, checkpoint.Hash))
+}
+
+func verifyAuditCheckpoint(checkpoint AuditCheckpoint, publicKey ed25519.PublicKey) bool {
+	signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(publicKey, auditCheckpointMessage(checkpoint), signature)
+}
+
+// createAuditCheckpoint signe le dernier événement s'il n'a pas déjà de checkpoint
+func createAuditCheckpoint(db *gorm.DB) (*AuditCheckpoint, error) {
+	key, err := auditSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var last AuditEvent
+	if err := db.Order("id desc").First(&last).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var previous AuditCheckpoint
+	if db.Order("id desc").First(&previous).Error == nil && previous.EventID == last.ID {
+		return nil, nil
+	}
+
+	checkpoint := AuditCheckpoint{EventID: last.ID, Hash: last.Hash}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, auditCheckpointMessage(checkpoint)))
+	if err := db.Create(&checkpoint).Error; err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// runAuditCheckpoints crée un checkpoint à intervalle régulier (AUDIT_CHECKPOINT_INTERVAL, 1h par défaut)
+func runAuditCheckpoints(db *gorm.DB) {
+	if _, err := auditSigningKey(); err != nil {
+		log.Printf("audit: checkpoints disabled: %v", err)
+		return
+	}
+	interval, err := time.ParseDuration(getenvDefault("AUDIT_CHECKPOINT_INTERVAL", "1h"))
+	if err != nil {
+		log.Printf("audit: invalid AUDIT_CHECKPOINT_INTERVAL: %v", err)
+		return
+	}
+
+	for range time.Tick(interval) {
+		if _, err := createAuditCheckpoint(db); err != nil {
+			log.Printf("audit: failed to create checkpoint: %v", err)
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint audit verify/export
+
+// verifyAudit parcourt la chaîne et retourne la première rupture trouvée
+func verifyAudit(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := verifyAuditLog(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying audit log"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// exportAudit retourne la chaîne et les checkpoints, vérifiables hors ligne avec cli audit verify
+func exportAudit(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		export := auditExport{Format: auditExportFormat, ExportedAt: time.Now().UTC()}
+		if publicKey := auditPublicKey(); publicKey != nil {
+			export.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+		}
+
+		if err := db.Order("id").Find(&export.Events).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting audit log"})
+			return
+		}
+		if err := db.Order("id").Find(&export.Checkpoints).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting audit log"})
+			return
+		}
+		c.Header("Content-Disposition", "attachment; filename=audit-export.json")
+		c.JSON(http.StatusOK, export)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Commande app audit
+
+func runAuditCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: app audit verify|checkpoint|keygen")
+	}
+
+	switch args[0] {
+	case "verify":
+		result, err := verifyAuditLog(db)
+		if err != nil {
+			return err
+		}
+		if result.Valid {
+			fmt.Printf("audit log OK: %d events, %d checkpoints verified\n", result.Events, result.Checkpoints)
+			return nil
+		}
+		b := result.FirstBreak
+		return fmt.Errorf("audit log broken at event %d (checkpoint %d): %s", b.EventID, b.CheckpointID, b.Reason)
+	case "checkpoint":
+		checkpoint, err := createAuditCheckpoint(db)
+		if err != nil {
+			return err
+		}
+		if checkpoint == nil {
+			fmt.Println("no new audit events since the last checkpoint")
+			return nil
+		}
+		fmt.Printf("checkpoint %d created for event %d\n", checkpoint.ID, checkpoint.EventID)
+		return nil
+	case "keygen":
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return err
+		}
+		key := ed25519.NewKeyFromSeed(seed)
+		fmt.Printf("AUDIT_SIGNING_KEY=%s\n", base64.StdEncoding.EncodeToString(seed))
+		fmt.Printf("public key: %s\n", base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+		return nil
+	}
+	return fmt.Errorf("unknown audit command %q", args[0])
+}
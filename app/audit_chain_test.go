@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+// auditChain construit une chaîne valide de n événements, comme appendAuditEvent
+func auditChain(n int) []AuditEvent {
+	events := make([]AuditEvent, n)
+	prev := ""
+	for i := range events {
+		events[i] = AuditEvent{
+			ID:         uint(i + 1),
+			Actor:      "alice@example.com",
+			Action:     "user.update",
+			TargetType: "user",
+			TargetID:   "2",
+			Diff:       JSONB(`{"name": {"before": "Bob", "after": "Robert"}}`),
+			CreatedAt:  time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC),
+			PrevHash:   prev,
+		}
+		events[i].Hash = auditHash(events[i])
+		prev = events[i].Hash
+	}
+	return events
+}
+
+func verifyChain(events []AuditEvent) auditVerification {
+	v := newAuditChainVerifier()
+	for _, event := range events {
+		v.checkEvent(event)
+	}
+	return v.result
+}
+
+func TestAuditChainValid(t *testing.T) {
+	result := verifyChain(auditChain(3))
+	if !result.Valid || result.Events != 3 || result.FirstBreak != nil {
+		t.Fatalf("valid chain reported as %+v", result)
+	}
+}
+
+func TestAuditHashIgnoresJSONLayout(t *testing.T) {
+	event := auditChain(1)[0]
+	event.Diff = JSONB(`{"name":{"after":"Robert","before":"Bob"}}`)
+	if auditHash(event) != event.Hash {
+		t.Fatal("jsonb key order or spacing changed the hash")
+	}
+}
+
+func TestAuditChainAlteredEvent(t *testing.T) {
+	events := auditChain(3)
+	events[1].Actor = "mallory@example.com"
+	result := verifyChain(events)
+	if result.Valid || result.FirstBreak == nil || result.FirstBreak.EventID != 2 {
+		t.Fatalf("altered event not reported: %+v", result)
+	}
+}
+
+func TestAuditChainMissingEvent(t *testing.T) {
+	events := auditChain(3)
+	result := verifyChain([]AuditEvent{events[0], events[2]})
+	if result.Valid || result.FirstBreak == nil || result.FirstBreak.EventID != 3 {
+		t.Fatalf("missing event not reported: %+v", result)
+	}
+}
+
+func TestAuditChainRewrittenHashes(t *testing.T) {
+	// réécrire un événement et recalculer les hashes suivants garde une chaîne cohérente: seul le checkpoint
+	// signé le détecte
+	publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	events := auditChain(3)
+	checkpoint := AuditCheckpoint{ID: 1, EventID: 3, Hash: events[2].Hash}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, auditCheckpointMessage(checkpoint)))
+
+	v := newAuditChainVerifier()
+	for _, event := range events {
+		v.checkEvent(event)
+	}
+	v.checkCheckpoint(checkpoint, publicKey)
+	if !v.result.Valid {
+		t.Fatalf("untouched chain with checkpoint reported as %+v", v.result)
+	}
+
+	events[1].Actor = "mallory@example.com"
+	events[1].Hash = auditHash(events[1])
+	events[2].PrevHash = events[1].Hash
+	events[2].Hash = auditHash(events[2])
+	v = newAuditChainVerifier()
+	for _, event := range events {
+		v.checkEvent(event)
+	}
+	if !v.result.Valid {
+		t.Fatalf("rehashed chain should look consistent before checkpoints: %+v", v.result)
+	}
+	v.checkCheckpoint(checkpoint, publicKey)
+	if v.result.Valid || v.result.FirstBreak.CheckpointID != 1 {
+		t.Fatalf("rewritten chain not caught by the checkpoint: %+v", v.result)
+	}
+}
+
+func TestAuditCheckpointForgedSignature(t *testing.T) {
+	publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	events := auditChain(1)
+	checkpoint := AuditCheckpoint{ID: 1, EventID: 1, Hash: events[0].Hash}
+	checkpoint.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(otherKey, auditCheckpointMessage(checkpoint)))
+
+	v := newAuditChainVerifier()
+	v.checkEvent(events[0])
+	v.checkCheckpoint(checkpoint, publicKey)
+	if v.result.Valid || v.result.FirstBreak.Reason != "invalid checkpoint signature" {
+		t.Fatalf("forged signature not reported: %+v", v.result)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// grantedRole est un rôle de l'utilisateur, direct ou hérité d'un groupe (Via)
+type grantedRole struct {
+	Role Role
+	Via  *Group
+}
+
+// authzSubject est un utilisateur avec ses groupes (ancêtres compris), ses rôles effectifs,
+// les groupes qu'il administre comme propriétaire (sous-groupes compris) et sa chaîne hiérarchique
+type authzSubject struct {
+	User        User
+	Groups      []Group
+	Roles       []grantedRole
+	OwnedGroups map[uint]Group  // groupe administré -> groupe possédé qui donne ce droit
+	OwnedRoles  map[uint][]Role // groupe administré -> rôles que ses membres reçoivent (group_roles, ancêtres compris)
+	Managers    []User          // du manager direct au sommet (voir managers.go)
+}
+
+// authzDecision est le résultat d'une vérification, avec la raison de la décision
+type authzDecision struct {
+	UserID     uint   `json:"user_id,omitempty"`
+	Action     string `json:"action"`
+	Resource   string `json:"resource"`
+	Allowed    bool   `json:"allowed"`
+	Reason     string `json:"reason"`
+	Role       string `json:"role,omitempty"`
+	Permission string `json:"permission,omitempty"`
+	Group      string `json:"group,omitempty"`
+	Policy     string `json:"policy,omitempty"`
+}
+
+// loadAuthzSubject charge les rôles directs de l'utilisateur et ceux de ses groupes et de leurs parents
+func loadAuthzSubject(db *gorm.DB, user User) (*authzSubject, error) {
+	subject := &authzSubject{User: user}
+	roleID := func(r Role) uint { return r.ID }
+
+	direct, err := loadRelated(db, "user_roles", "user_id", "role_id", []uint{user.ID}, roleID)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range direct[user.ID] {
+		subject.Roles = append(subject.Roles, grantedRole{Role: role})
+	}
+
+	memberships, err := loadRelated(db, "user_groups", "user_id", "group_id", []uint{user.ID}, func(g Group) uint { return g.ID })
+	if err != nil {
+		return nil, err
+	}
+	if subject.Groups, err = withAncestors(db, memberships[user.ID]); err != nil {
+		return nil, err
+	}
+
+	if len(subject.Groups) > 0 {
+		groupIDs := make([]uint, len(subject.Groups))
+		for i, group := range subject.Groups {
+			groupIDs[i] = group.ID
+		}
+		inherited, err := loadRelated(db, "group_roles", "group_id", "role_id", groupIDs, roleID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range subject.Groups {
+			for _, role := range inherited[subject.Groups[i].ID] {
+				subject.Roles = append(subject.Roles, grantedRole{Role: role, Via: &subject.Groups[i]})
+			}
+		}
+	}
+
+	if subject.OwnedGroups, err = loadOwnedGroups(db, user.ID); err != nil {
+		return nil, err
+	}
+	if subject.OwnedRoles, err = loadGroupRoleChains(db, subject.OwnedGroups); err != nil {
+		return nil, err
+	}
+	if subject.Managers, err = managerChain(db, user.ManagerID); err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+// withAncestors ajoute aux groupes leurs parents, grands-parents..., un niveau (une requête) à la fois
+func withAncestors(db *gorm.DB, groups []Group) ([]Group, error) {
+	seen := map[uint]bool{}
+	for _, group := range groups {
+		seen[group.ID] = true
+	}
+	for level := groups; len(level) > 0; {
+		var parentIDs []uint
+		for _, group := range level {
+			if group.ParentGroupID != nil && !seen[*group.ParentGroupID] {
+				seen[*group.ParentGroupID] = true
+				parentIDs = append(parentIDs, *group.ParentGroupID)
+			}
+		}
+		level = nil
+		if len(parentIDs) > 0 {
+			if err := db.Where("id IN (?)", parentIDs).Find(&level).Error; err != nil {
+				return nil, err
+			}
+			groups = append(groups, level...)
+		}
+	}
+	return groups, nil
+}
+
+// check cherche un rôle dont une permission couvre action sur resource; les rôles directs passent en premier
+func (s *authzSubject) check(action, resource string) authzDecision {
+	decision := authzDecision{UserID: s.User.ID, Action: action, Resource: resource}
+	for _, granted := range s.Roles {
+		for _, permission := range granted.Role.Permissions {
+			if !permissionMatches(permission, action, resource) {
+				continue
+			}
+			decision.Allowed = true
+			decision.Role = granted.Role.Name
+			decision.Permission = permission
+			decision.Reason = fmt.Sprintf("permission %q of role %q", permission, granted.Role.Name)
+			if granted.Via != nil {
+				decision.Group = granted.Via.Name
+				decision.Reason += fmt.Sprintf(" granted through group %q", granted.Via.Name)
+			}
+			return decision
+		}
+	}
+
+	if len(s.Roles) == 0 {
+		decision.Reason = "user has no role"
+	} else {
+		decision.Reason = fmt.Sprintf("no permission of roles %s allows %s on %s", strings.Join(s.roleNames(), ", "), action, resource)
+	}
+	return decision
+}
+
+// roleNames donne les noms des rôles effectifs, sans doublon
+func (s *authzSubject) roleNames() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, granted := range s.Roles {
+		if !seen[granted.Role.Name] {
+			seen[granted.Role.Name] = true
+			names = append(names, granted.Role.Name)
+		}
+	}
+	return names
+}
+
+func (s *authzSubject) groupNames() []string {
+	names := make([]string, len(s.Groups))
+	for i, group := range s.Groups {
+		names[i] = group.Name
+	}
+	return names
+}
+
+// permissionMatches compare "action:ressource" à une demande; chaque partie accepte "*" ou un préfixe "groups/*"
+func permissionMatches(permission, action, resource string) bool {
+	parts := strings.SplitN(permission, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	return globMatches(parts[0], action) && globMatches(parts[1], resource)
+}
+
+func globMatches(pattern, value string) bool {
+	if pattern == "*" || pattern == value {
+		return true
+	}
+	return strings.HasSuffix(pattern, "*") && strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+}
+
+// findUserByRef retrouve un utilisateur par son ID ou son email
+func findUserByRef(db *gorm.DB, ref string) (User, error) {
+	var user User
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		return user, db.First(&user, id).Error
+	}
+	return user, db.Where("email = ?", ref).First(&user).Error
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint authz
+
+type authzCheck struct {
+	User     interface{} `json:"user"` // ID ou email, l'appelant par défaut
+	Action   string      `json:"action"`
+	Resource string      `json:"resource"`
+}
+
+// checkAuthz répond à "l'utilisateur peut-il faire action sur resource ?" (politiques puis rôles), pour une vérification
+// ({"user", "action", "resource"}) ou un lot ({"checks": [...]}, 100 maximum)
+func checkAuthz(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var body struct {
+			authzCheck
+			Checks []authzCheck `json:"checks"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authorization check"})
+			return
+		}
+		batch := body.Checks != nil
+		checks := body.Checks
+		if !batch {
+			checks = []authzCheck{body.authzCheck}
+		}
+		if len(checks) == 0 || len(checks) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Between 1 and 100 checks are accepted"})
+			return
+		}
+
+		set, err := policies.active()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading policies"})
+			return
+		}
+
+		caller, _ := c.Get("user")
+		subjects := map[string]*authzSubject{}
+		results := make([]authzDecision, len(checks))
+		for i, check := range checks {
+			if check.Action == "" || check.Resource == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "action and resource are required"})
+				return
+			}
+			ref := ""
+			switch value := check.User.(type) {
+			case float64:
+				ref = strconv.FormatFloat(value, 'f', -1, 64)
+			case string:
+				ref = value
+			}
+
+			// un sujet n'est chargé qu'une fois par lot
+			subject, ok := subjects[ref]
+			if !ok {
+				user, isUser := caller.(User)
+				var err error
+				if ref != "" {
+					user, err = findUserByRef(db, ref)
+				}
+				if err != nil && !gorm.IsRecordNotFoundError(err) {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+					return
+				}
+				if err == nil && (ref != "" || isUser) {
+					if subject, err = loadAuthzSubject(db, user); err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+						return
+					}
+				}
+				subjects[ref] = subject
+			}
+
+			if subject == nil {
+				results[i] = authzDecision{Action: check.Action, Resource: check.Resource, Reason: "unknown user"}
+				continue
+			}
+			resourceType, id := parseResourceRef(check.Resource)
+			attributes, err := resourceAttributes(db, resourceType, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching resource"})
+				return
+			}
+			results[i] = decide(set, subject, check.Action, check.Resource, checkInput(subject, attributes, check.Action, check.Resource, nil))
+		}
+
+		if batch {
+			c.JSON(http.StatusOK, gin.H{"results": results})
+			return
+		}
+		c.JSON(http.StatusOK, results[0])
+	}
+}
+
+// introspectToken implémente l'introspection OAuth 2.0 (RFC 7662): token en form-urlencoded,
+// {"active": false} pour tout token invalide, expiré, de session révoquée ou dont l'utilisateur n'existe plus
+func introspectToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString := c.PostForm("token")
+		if tokenString == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+
+		claims, err := parseToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+		user, session, err := sessionFromToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"active": false})
+			return
+		}
+		subject, err := loadAuthzSubject(scopeTenant(db, session.OrganizationID), user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		response := gin.H{
+			"active":     true,
+			"token_type": "Bearer",
+			"sub":        strconv.FormatUint(uint64(user.ID), 10),
+			"username":   user.Name,
+			"email":      user.Email,
+			"exp":        int64(claims["exp"].(float64)),
+			"sid":        strconv.FormatUint(uint64(session.ID), 10),
+			"org":        strconv.FormatUint(uint64(session.OrganizationID), 10),
+			"roles":      subject.roleNames(),
+			"groups":     subject.groupNames(),
+		}
+		if session.ImpersonatorID != nil {
+			response["act"] = gin.H{"sub": strconv.FormatUint(uint64(*session.ImpersonatorID), 10)}
+		}
+		if iat, ok := claims["iat"].(float64); ok {
+			response["iat"] = int64(iat)
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// verifyForwardAuth sert d'auth_request à nginx et de ForwardAuth à Traefik: 200 avec les headers
+// X-User-* (et X-Impersonator-* sous impersonation) si le token est valide (401 sinon, via requireAuth), 403 si les exigences de la route
+// passées en query (roles=Admin,Editor ou groups=Sales: l'un d'eux suffit) ne sont pas remplies
+func verifyForwardAuth(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		c.Header("Cache-Control", "no-store")
+		user := c.MustGet("user").(User)
+		subject, err := loadAuthzSubject(db, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+			return
+		}
+
+		roles, groups := subject.roleNames(), subject.groupNames()
+		if required := c.Query("roles"); required != "" && !containsAny(roles, strings.Split(required, ",")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing required role"})
+			return
+		}
+		if required := c.Query("groups"); required != "" && !containsAny(groups, strings.Split(required, ",")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing required group"})
+			return
+		}
+
+		c.Header("X-User-Id", strconv.FormatUint(uint64(user.ID), 10))
+		c.Header("X-User-Email", user.Email)
+		c.Header("X-User-Roles", strings.Join(roles, ","))
+		c.Header("X-User-Groups", strings.Join(groups, ","))
+		c.Header("X-User-Org", strconv.FormatUint(uint64(c.MustGet("org").(uint)), 10))
+		if value, ok := c.Get("impersonator"); ok {
+			impersonator := value.(User)
+			c.Header("X-Impersonator-Id", strconv.FormatUint(uint64(impersonator.ID), 10))
+			c.Header("X-Impersonator-Email", impersonator.Email)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, value := range values {
+		for _, w := range wanted {
+			if strings.TrimSpace(w) == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+// runCommand exécute une sous-commande du binaire (ex: app sync run) au lieu de démarrer le serveur
+func runCommand(args []string) error {
+	switch args[0] {
+	case "sync":
+		return runSyncCommand(args[1:])
+	case "audit":
+		return runAuditCommand(args[1:])
+	}
+	return fmt.Errorf("unknown command %q", args[0])
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/cel-go/cel"
+	"github.com/jinzhu/gorm"
+)
+
+// Groupes dynamiques: un groupe peut avoir une MembershipRule, expression CEL sur la variable user
+// (ex: user.email.endsWith("@sales.example.com"), "Editor" in user.roles). Les utilisateurs qui la vérifient
+// en deviennent membres: leurs lignes de user_groups sont marquées rule_derived et ne se retirent pas à la main.
+// La règle est évaluée à la création et à la modification d'un utilisateur, à l'enregistrement du groupe, et par
+// runRuleReconciler pour ce qui n'y passe pas (grants de rôles qui commencent, gRPC, synchronisation d'annuaire).
+
+// ruleReason est la raison des appartenances dérivées d'une règle
+const ruleReason = "membership rule"
+
+var errRuleDerived = errors.New("membership is derived from the group's membership rule")
+
+var ruleEnv = mustRuleEnv()
+
+// rulePrograms garde les règles des groupes déjà compilées (une règle est évaluée pour chaque utilisateur); seules les
+// règles enregistrées sur un groupe y entrent, et le cache est vidé quand il atteint ruleCacheSize (anciennes règles)
+var rulePrograms = struct {
+	sync.Mutex
+	programs map[string]cel.Program
+}{programs: map[string]cel.Program{}}
+
+const ruleCacheSize = 512
+
+func mustRuleEnv() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}
+
+// watchGroupRules vide le cache des règles sur un message cache_invalidate "group_rules" (reconnexion du bus)
+func watchGroupRules() {
+	invalidations, _ := bus.Subscribe(topicCacheInvalidate)
+	for name := range invalidations {
+		if name == "group_rules" {
+			rulePrograms.Lock()
+			rulePrograms.programs = map[string]cel.Program{}
+			rulePrograms.Unlock()
+		}
+	}
+}
+
+// compileMembershipRule compile une règle sans la garder (validation, aperçu); une règle vide donne un programme
+// nil (groupe statique)
+func compileMembershipRule(rule string) (cel.Program, error) {
+	if strings.TrimSpace(rule) == "" {
+		return nil, nil
+	}
+	ast, issues := ruleEnv.Compile(rule)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid membership rule: %v", issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, errors.New("membership rule must be a boolean expression")
+	}
+	program, err := ruleEnv.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid membership rule: %v", err)
+	}
+	return program, nil
+}
+
+// groupRuleProgram compile la règle enregistrée d'un groupe, depuis le cache si elle y est
+func groupRuleProgram(group Group) (cel.Program, error) {
+	rulePrograms.Lock()
+	program, ok := rulePrograms.programs[group.MembershipRule]
+	rulePrograms.Unlock()
+	if ok {
+		return program, nil
+	}
+	program, err := compileMembershipRule(group.MembershipRule)
+	if err != nil || program == nil {
+		return program, err
+	}
+	rulePrograms.Lock()
+	if len(rulePrograms.programs) >= ruleCacheSize {
+		rulePrograms.programs = map[string]cel.Program{}
+	}
+	rulePrograms.programs[group.MembershipRule] = program
+	rulePrograms.Unlock()
+	return program, nil
+}
+
+// ruleAttributes construit la variable user de chaque utilisateur: id, name, email, status, organization_id,
+// roles, role_ids, attributes (attributs personnalisés) et manager_id. Seuls les rôles accordés directement comptent: ceux reçus d'un groupe dépendraient
+// eux-mêmes des règles.
+func ruleAttributes(db *gorm.DB, users []User) (map[uint]map[string]interface{}, error) {
+	ids := make([]uint, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	roles, err := loadRelated(db, "user_roles", "user_id", "role_id", ids, func(r Role) uint { return r.ID })
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make(map[uint]map[string]interface{}, len(users))
+	for _, user := range users {
+		names, roleIDs := []string{}, []int64{}
+		for _, role := range roles[user.ID] {
+			names = append(names, role.Name)
+			roleIDs = append(roleIDs, int64(role.ID))
+		}
+		var managerID uint
+		if user.ManagerID != nil {
+			managerID = *user.ManagerID
+		}
+		attributes[user.ID] = map[string]interface{}{
+			"id":              int64(user.ID),
+			"name":            user.Name,
+			"email":           user.Email,
+			"status":          user.currentStatus(),
+			"organization_id": int64(user.OrganizationID),
+			"roles":           names,
+			"role_ids":        roleIDs,
+			"attributes":      user.attributeValues(),
+			"manager_id":      int64(managerID),
+		}
+	}
+	return attributes, nil
+}
+
+// ruleMatches évalue la règle pour un utilisateur
+func ruleMatches(program cel.Program, user map[string]interface{}) (bool, error) {
+	out, _, err := program.Eval(map[string]interface{}{"user": user})
+	if err != nil {
+		return false, err
+	}
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, errors.New("membership rule did not return a boolean")
+	}
+	return matched, nil
+}
+
+// matchingUsers retourne les utilisateurs de l'organisation de db qui vérifient la règle; une évaluation
+// en erreur (attribut absent...) compte comme non vérifiée et est comptée dans errs
+func matchingUsers(db *gorm.DB, program cel.Program) (matched []User, errs int, err error) {
+	var users []User
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	attributes, err := ruleAttributes(db, users)
+	if err != nil {
+		return nil, 0, err
+	}
+	matched = []User{}
+	for _, user := range users {
+		ok, err := ruleMatches(program, attributes[user.ID])
+		if err != nil {
+			errs++
+			continue
+		}
+		if ok {
+			matched = append(matched, user)
+		}
+	}
+	return matched, errs, nil
+}
+
+// ruleSync est l'écart entre les membres d'un groupe et sa règle: utilisateurs à ajouter et à retirer
+type ruleSync struct {
+	Added   []uint `json:"added"`
+	Removed []uint `json:"removed"`
+}
+
+// planRuleSync compare les utilisateurs qui vérifient la règle aux membres du groupe; les membres ajoutés
+// à la main restent, seules les appartenances dérivées sont retirées
+func planRuleSync(db *gorm.DB, groupID uint, matched []User) (ruleSync, error) {
+	rows, err := db.Table("user_groups").Select("user_id, rule_derived").Where("group_id = ?", groupID).Rows()
+	if err != nil {
+		return ruleSync{}, err
+	}
+	defer rows.Close()
+	members := map[uint]bool{} // user_id -> rule_derived
+	for rows.Next() {
+		var userID uint
+		var derived bool
+		if err := rows.Scan(&userID, &derived); err != nil {
+			return ruleSync{}, err
+		}
+		members[userID] = derived
+	}
+	if err := rows.Err(); err != nil {
+		return ruleSync{}, err
+	}
+
+	plan := ruleSync{Added: []uint{}, Removed: []uint{}}
+	keep := map[uint]bool{}
+	for _, user := range matched {
+		keep[user.ID] = true
+		if _, member := members[user.ID]; !member {
+			plan.Added = append(plan.Added, user.ID)
+		}
+	}
+	for userID, derived := range members {
+		if derived && !keep[userID] {
+			plan.Removed = append(plan.Removed, userID)
+		}
+	}
+	sort.Slice(plan.Removed, func(i, j int) bool { return plan.Removed[i] < plan.Removed[j] })
+	return plan, nil
+}
+
+// addDerivedMember ajoute une appartenance dérivée; un membre ajouté à la main le reste
+func addDerivedMember(tx *gorm.DB, userID, groupID uint) error {
+	return tx.Exec("INSERT INTO user_groups (user_id, group_id, valid_from, reason, rule_derived) VALUES (?, ?, ?, ?, TRUE) ON CONFLICT DO NOTHING",
+		userID, groupID, time.Now(), ruleReason).Error
+}
+
+// reconcileGroup aligne les appartenances dérivées d'un groupe sur sa règle (toutes retirées si la règle est vide)
+func reconcileGroup(db *gorm.DB, group Group) (ruleSync, error) {
+	db = scopeTenant(db, group.OrganizationID)
+	program, err := groupRuleProgram(group)
+	if err != nil {
+		return ruleSync{}, err
+	}
+	matched := []User{}
+	if program != nil {
+		var errs int
+		if matched, errs, err = matchingUsers(db, program); err != nil {
+			return ruleSync{}, err
+		}
+		if errs > 0 {
+			log.Printf("groups: membership rule of group %d failed for %d users", group.ID, errs)
+		}
+	}
+	plan, err := planRuleSync(db, group.ID, matched)
+	if err != nil || len(plan.Added)+len(plan.Removed) == 0 {
+		return plan, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, userID := range plan.Added {
+			if err := addDerivedMember(tx, userID, group.ID); err != nil {
+				return err
+			}
+		}
+		if len(plan.Removed) > 0 {
+			if err := tx.Exec("DELETE FROM user_groups WHERE group_id = ? AND user_id IN (?) AND rule_derived", group.ID, plan.Removed).Error; err != nil {
+				return err
+			}
+		}
+		return enqueueMembershipEvent(tx, group.ID)
+	})
+	if err != nil {
+		return ruleSync{}, err
+	}
+	for _, userID := range plan.Added {
+		recordAudit(db, nil, groupGrants.actions[0], "group", group.ID, nil, gin.H{"user_id": userID, "reason": ruleReason})
+	}
+	for _, userID := range plan.Removed {
+		recordAudit(db, nil, groupGrants.actions[1], "group", group.ID, gin.H{"user_id": userID, "reason": ruleReason}, nil)
+	}
+	return plan, nil
+}
+
+// applyMembershipRules évalue les règles des groupes dynamiques pour un utilisateur créé ou modifié,
+// dans la transaction de l'écriture; les appartenances d'un utilisateur supprimé sont retirées par la réconciliation
+func applyMembershipRules(tx *gorm.DB, user User) error {
+	if user.DeletedAt != nil {
+		return nil
+	}
+	tx = scopeTenant(tx, user.OrganizationID)
+	var groups []Group
+	if err := tx.Where("membership_rule <> ''").Find(&groups).Error; err != nil || len(groups) == 0 {
+		return err
+	}
+	attributes, err := ruleAttributes(tx, []User{user})
+	if err != nil {
+		return err
+	}
+	derived := map[uint]bool{} // group_id -> rule_derived
+	rows, err := tx.Table("user_groups").Select("group_id, rule_derived").Where("user_id = ?", user.ID).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var groupID uint
+		var isDerived bool
+		if err := rows.Scan(&groupID, &isDerived); err != nil {
+			return err
+		}
+		derived[groupID] = isDerived
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		program, err := groupRuleProgram(group)
+		if err != nil {
+			log.Printf("groups: %v (group %d)", err, group.ID)
+			continue
+		}
+		matched, _ := ruleMatches(program, attributes[user.ID])
+		isDerived, member := derived[group.ID]
+		switch {
+		case matched && !member:
+			err = addDerivedMember(tx, user.ID, group.ID)
+		case !matched && isDerived:
+			err = tx.Exec("DELETE FROM user_groups WHERE group_id = ? AND user_id = ? AND rule_derived", group.ID, user.ID).Error
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := enqueueMembershipEvent(tx, group.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncGroupRule réconcilie un groupe qui vient d'être enregistré; les erreurs sont loggées,
+// runRuleReconciler repassera
+func syncGroupRule(db *gorm.DB, group Group) {
+	if _, err := reconcileGroup(db, group); err != nil {
+		log.Printf("groups: failed to apply the membership rule of group %d: %v", group.ID, err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Réconciliation périodique
+
+// runRuleReconciler réconcilie les groupes dynamiques toutes les GROUP_RULE_INTERVAL (5 minutes par défaut)
+func runRuleReconciler(db *gorm.DB) {
+	interval, err := time.ParseDuration(getenvDefault("GROUP_RULE_INTERVAL", "5m"))
+	if err != nil || interval <= 0 {
+		log.Printf("groups: invalid GROUP_RULE_INTERVAL, using 5m")
+		interval = 5 * time.Minute
+	}
+	for range time.Tick(interval) {
+		if err := reconcileRuleGroups(db); err != nil {
+			log.Printf("groups: failed to reconcile membership rules: %v", err)
+		}
+	}
+}
+
+// reconcileRuleGroups réconcilie les groupes dynamiques de toutes les organisations
+func reconcileRuleGroups(db *gorm.DB) error {
+	var groups []Group
+	if err := db.Where("membership_rule <> ''").Order("id").Find(&groups).Error; err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if _, err := reconcileGroup(db, group); err != nil {
+			// une règle invalide ne bloque pas les autres groupes
+			log.Printf("groups: failed to reconcile group %d: %v", group.ID, err)
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint membership rules
+
+// previewMembershipRule montre qui vérifierait une règle avant de l'enregistrer:
+// {"membership_rule": "...", "group_id": 3}; avec group_id, la réponse donne aussi les ajouts et retraits
+func previewMembershipRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var body struct {
+			MembershipRule string `json:"membership_rule"`
+			GroupID        uint   `json:"group_id"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preview data"})
+			return
+		}
+		program, err := compileMembershipRule(body.MembershipRule)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if program == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "membership_rule is required"})
+			return
+		}
+		matched, errs, err := matchingUsers(db, program)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error evaluating the rule"})
+			return
+		}
+
+		response := gin.H{"count": len(matched), "users": matched, "errors": errs}
+		if body.GroupID != 0 {
+			if err := db.First(&Group{}, body.GroupID).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+				return
+			}
+			plan, err := planRuleSync(db, body.GroupID, matched)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching members"})
+				return
+			}
+			response["added"], response["removed"] = plan.Added, plan.Removed
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// EmailChange: un utilisateur qui change son email par PATCH /me garde l'ancien jusqu'à ce qu'il confirme le
+// nouveau avec le lien reçu à cette adresse. Les règles des groupes dynamiques lisent l'email: sans confirmation,
+// n'importe qui pourrait prendre un email @sales.example.com et entrer dans le groupe Sales.
+type EmailChange struct {
+	ID             uint       `gorm:"primary_key" json:"id"`
+	OrganizationID uint       `json:"organization_id"`
+	UserID         uint       `json:"user_id"`
+	Email          string     `json:"email"`
+	TokenHash      string     `json:"-"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+var errEmailChangeUsed = errors.New("email change already confirmed")
+
+// emailChangeTTL est la validité du lien de confirmation (EMAIL_CHANGE_TTL, 24 heures par défaut)
+func emailChangeTTL() time.Duration {
+	ttl, err := time.ParseDuration(getenvDefault("EMAIL_CHANGE_TTL", "24h"))
+	if err != nil || ttl <= 0 {
+		return 24 * time.Hour
+	}
+	return ttl
+}
+
+// emailChangeMail construit l'email de confirmation; EMAIL_CHANGE_URL est le lien envoyé, {token} y est remplacé
+func emailChangeMail(user User, change EmailChange, token string) Mail {
+	link := strings.Replace(getenvDefault("EMAIL_CHANGE_URL", "http://localhost:8080/email-changes/{token}/confirm"), "{token}", token, 1)
+	return Mail{
+		To:      change.Email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hello %s,\n\nConfirm that %s is your new email address here:\n\n%s\n\n"+
+			"Your email stays %s until then. This link expires on %s.\n",
+			user.Name, change.Email, link, user.Email, change.ExpiresAt.Format(time.RFC1123)),
+	}
+}
+
+// pendingEmail retourne le nouvel email en attente de confirmation de l'utilisateur, "" s'il n'y en a pas
+func pendingEmail(db *gorm.DB, userID uint) (string, error) {
+	var change EmailChange
+	err := db.Where("user_id = ? AND confirmed_at IS NULL AND expires_at > ?", userID, time.Now()).Order("id desc").First(&change).Error
+	return change.Email, ignoreNotFound(err)
+}
+
+// startEmailChange remplace la demande en attente de l'utilisateur et envoie le lien, après le commit;
+// si l'envoi échoue la demande est supprimée
+func startEmailChange(db *gorm.DB, user User, email string) error {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	change := EmailChange{OrganizationID: user.OrganizationID, UserID: user.ID, Email: email, TokenHash: hashInvitationToken(token), ExpiresAt: time.Now().Add(emailChangeTTL())}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND confirmed_at IS NULL", user.ID).Delete(&EmailChange{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&change).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := mailer.Send(emailChangeMail(user, change, token)); err != nil {
+		db.Delete(&change)
+		return err
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint email changes
+
+// confirmEmailChange applique le nouvel email (sans authentification: le token du lien fait foi);
+// 410 si le lien a expiré ou déjà servi
+func confirmEmailChange(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var change EmailChange
+		if err := db.Where("token_hash = ?", hashInvitationToken(c.Param("token"))).First(&change).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Email change not found"})
+			return
+		}
+		if change.ConfirmedAt != nil || time.Now().After(change.ExpiresAt) {
+			c.JSON(http.StatusGone, gin.H{"error": "Email change link has expired"})
+			return
+		}
+
+		db := scopeTenant(db, change.OrganizationID)
+		var user User
+		if err := db.Where("id = ?", change.UserID).First(&user).Error; err != nil {
+			c.JSON(http.StatusGone, gin.H{"error": "User no longer exists"})
+			return
+		}
+		// les emails sont uniques sur tout le déploiement: la vérification n'est pas limitée à l'organisation
+		var taken int
+		if err := db.Model(&User{}).Unscoped().Where("email = ? AND id <> ?", change.Email, user.ID).Count(&taken).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming email change"})
+			return
+		}
+		if taken > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+			return
+		}
+
+		before := user
+		user.Email = change.Email
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// le lien n'est utilisable qu'une fois
+			used := tx.Model(&change).Where("confirmed_at IS NULL").UpdateColumn("confirmed_at", time.Now())
+			if used.Error != nil {
+				return used.Error
+			}
+			if used.RowsAffected != 1 {
+				return errEmailChangeUsed
+			}
+			if err := tx.Model(&user).UpdateColumn("email", user.Email).Error; err != nil {
+				return err
+			}
+			if err := enqueueEvent(tx, "user.updated", "user", user.ID, user); err != nil {
+				return err
+			}
+			return applyMembershipRules(tx, user)
+		})
+		if err == errEmailChangeUsed {
+			c.JSON(http.StatusGone, gin.H{"error": "Email change link has expired"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirming email change"})
+			return
+		}
+		recordAudit(db, c, "user.email_change", "user", user.ID, gin.H{"email": before.Email}, gin.H{"email": user.Email})
+		c.JSON(http.StatusOK, gin.H{"message": "Email updated"})
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// eventHub diffuse les événements de l'outbox aux flux SSE ouverts sur ce processus
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan OutboxEvent]struct{}
+}
+
+var changeHub = newEventHub()
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: map[chan OutboxEvent]struct{}{}}
+}
+
+func (h *eventHub) subscribe() chan OutboxEvent {
+	ch := make(chan OutboxEvent, 256)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan OutboxEvent) {
+	h.mu.Lock()
+	if _, ok := h.subscribers[ch]; ok {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+// publish n'attend jamais un abonné lent: son canal est fermé, le client se reconnecte avec Last-Event-ID
+func (h *eventHub) publish(event OutboxEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// relay alimente le hub avec les événements distribués par n'importe quel réplica (topic changes du bus)
+func (h *eventHub) relay(db *gorm.DB) {
+	ids, _ := bus.Subscribe(topicChanges)
+	for id := range ids {
+		var event OutboxEvent
+		if err := db.First(&event, id).Error; err != nil {
+			log.Printf("events: cannot load event %s: %v", id, err)
+			continue
+		}
+		h.publish(event)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint events
+
+// streamEvents envoie les modifications en Server-Sent Events. L'ID de chaque événement est son dispatch_seq
+// (ordre de distribution), un client reconnecté avec Last-Event-ID reçoit d'abord ce qu'il a manqué.
+func streamEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entityTypes := map[string]bool{}
+		for _, entityType := range strings.Split(c.Query("entity_types"), ",") {
+			if entityType = strings.TrimSpace(entityType); entityType != "" {
+				entityTypes[entityType] = true
+			}
+		}
+		wanted := func(event OutboxEvent) bool {
+			return len(entityTypes) == 0 || entityTypes[event.EntityType]
+		}
+
+		lastID, _ := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+		if lastID == 0 {
+			lastID, _ = strconv.ParseUint(c.Query("last_event_id"), 10, 64)
+		}
+
+		// abonnement avant le rattrapage pour ne rien perdre entre les deux
+		ch := changeHub.subscribe()
+		defer changeHub.unsubscribe(ch)
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		sent := uint(lastID)
+		// catchUp envoie depuis l'outbox les événements distribués après sent, jusqu'à upTo (0: tous)
+		catchUp := func(upTo uint) error {
+			for {
+				query := db.Where("dispatch_seq > ?", sent)
+				if upTo > 0 {
+					query = query.Where("dispatch_seq <= ?", upTo)
+				}
+				var events []OutboxEvent
+				if err := query.Order("dispatch_seq").Limit(500).Find(&events).Error; err != nil {
+					return err
+				}
+				if len(events) == 0 {
+					return nil
+				}
+				for _, event := range events {
+					if wanted(event) {
+						if err := writeSSE(c, event); err != nil {
+							return err
+						}
+					}
+					sent = *event.DispatchSeq
+				}
+			}
+		}
+		if lastID > 0 {
+			if catchUp(0) != nil {
+				return
+			}
+		} else {
+			// sans Last-Event-ID le flux commence après le dernier événement distribué
+			if err := db.Model(&OutboxEvent{}).Select("COALESCE(MAX(dispatch_seq), 0)").Row().Scan(&sent); err != nil {
+				return
+			}
+		}
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-c.Request.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+					return
+				}
+				c.Writer.Flush()
+			case event, ok := <-ch:
+				if !ok {
+					return
+				}
+				if event.DispatchSeq == nil || *event.DispatchSeq <= sent {
+					continue
+				}
+				// les réplicas publient sur le bus dans le désordre: ce qui précède l'événement est relu dans l'outbox
+				if *event.DispatchSeq != sent+1 {
+					if catchUp(*event.DispatchSeq) != nil {
+						return
+					}
+					continue
+				}
+				if wanted(event) && writeSSE(c, event) != nil {
+					return
+				}
+				sent = *event.DispatchSeq
+			}
+		}
+	}
+}
+
+func writeSSE(c *gin.Context, event OutboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", *event.DispatchSeq, event.EventType, data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
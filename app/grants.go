@@ -0,0 +1,387 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Grants: les lignes de user_roles et user_groups portent une période de validité (valid_from,
+// valid_until), une raison et l'administrateur qui les a accordées. Les rôles effectifs ignorent
+// les grants inactifs; runGrantSweeper supprime les grants expirés et publie leur révocation.
+
+// Grant est une ligne de user_roles (Role) ou de user_groups (Group)
+type Grant struct {
+	Kind        string     `json:"kind"` // role ou group
+	UserID      uint       `json:"user_id"`
+	TargetID    uint       `json:"target_id"` // ID du rôle ou du groupe
+	ValidFrom   time.Time  `json:"valid_from"`
+	ValidUntil  *time.Time `json:"valid_until"`
+	Reason      string     `json:"reason"`
+	GrantedByID *uint      `json:"granted_by_id"`
+	RuleDerived bool       `json:"rule_derived"` // appartenance venue de la règle du groupe (voir dynamic_groups.go)
+	Active      bool       `json:"active"`
+}
+
+// activeAt dit si le grant est valide à l'instant donné, comme activeGrantCondition
+func (g Grant) activeAt(now time.Time) bool {
+	return !g.ValidFrom.After(now) && (g.ValidUntil == nil || g.ValidUntil.After(now))
+}
+
+// grantTable décrit une table de grants
+type grantTable struct {
+	kind    string
+	label   string
+	table   string
+	column  string             // colonne de la cible (role_id, group_id)
+	target  func() interface{} // modèle de la cible, pour vérifier qu'elle existe dans l'organisation
+	policy  [2]string          // ressource et action exigées sur la cible (roles/assign, groups/manage_members)
+	actions [3]string          // actions d'audit: attribution, retrait, expiration (mêmes noms qu'en gRPC)
+	derived bool               // la table a la colonne rule_derived (groupes dynamiques)
+}
+
+var (
+	roleGrants = grantTable{kind: "role", label: "Role", table: "user_roles", column: "role_id",
+		target:  func() interface{} { return &Role{} },
+		policy:  [2]string{"roles", "assign"},
+		actions: [3]string{"role.assign", "role.revoke", "role.expire"}}
+	groupGrants = grantTable{kind: "group", label: "Group", table: "user_groups", column: "group_id",
+		target:  func() interface{} { return &Group{} },
+		policy:  [2]string{"groups", "manage_members"},
+		actions: [3]string{"group.member_add", "group.member_remove", "group.member_expire"},
+		derived: true}
+)
+
+// grantTables sont les tables de liaison filtrées par whereActiveGrant dans loadRelated
+var grantTables = map[string]bool{roleGrants.table: true, groupGrants.table: true}
+
+// activeGrantCondition est la condition SQL d'un grant de table valide à l'instant donné (deux fois)
+func activeGrantCondition(table string) string {
+	return table + ".valid_from <= ? AND (" + table + ".valid_until IS NULL OR " + table + ".valid_until > ?)"
+}
+
+// whereActiveGrant ne garde que les grants de table valides maintenant
+func whereActiveGrant(db *gorm.DB, table string) *gorm.DB {
+	now := time.Now()
+	return db.Where(activeGrantCondition(table), now, now)
+}
+
+// grantOptions sont les champs d'un grant donnés à l'attribution
+type grantOptions struct {
+	ValidFrom   *time.Time `json:"valid_from"`
+	ValidUntil  *time.Time `json:"valid_until"`
+	Reason      string     `json:"reason"`
+	GrantedByID *uint      `json:"-"`
+}
+
+// grant accorde (ou remplace) un grant; sans valid_from il commence tout de suite, sans valid_until il est permanent
+func (t grantTable) grant(tx *gorm.DB, userID, targetID uint, options grantOptions) error {
+	validFrom := time.Now()
+	if options.ValidFrom != nil {
+		validFrom = *options.ValidFrom
+	}
+	update := "valid_from = EXCLUDED.valid_from, valid_until = EXCLUDED.valid_until, reason = EXCLUDED.reason, granted_by_id = EXCLUDED.granted_by_id"
+	if t.derived {
+		// accordée à la main, une appartenance dérivée d'une règle devient manuelle
+		update += ", rule_derived = FALSE"
+	}
+	return tx.Exec("INSERT INTO "+t.table+" (user_id, "+t.column+", valid_from, valid_until, reason, granted_by_id) VALUES (?, ?, ?, ?, ?, ?) "+
+		"ON CONFLICT (user_id, "+t.column+") DO UPDATE SET "+update,
+		userID, targetID, validFrom, options.ValidUntil, options.Reason, options.GrantedByID).Error
+}
+
+// revoke supprime un grant; une appartenance dérivée d'une règle ne se retire pas (errRuleDerived)
+func (t grantTable) revoke(tx *gorm.DB, userID, targetID uint) error {
+	if t.derived {
+		var count int
+		if err := tx.Table(t.table).Where("user_id = ? AND "+t.column+" = ? AND rule_derived", userID, targetID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errRuleDerived
+		}
+	}
+	return tx.Exec("DELETE FROM "+t.table+" WHERE user_id = ? AND "+t.column+" = ?", userID, targetID).Error
+}
+
+// revokeSnapshot supprime le grant tel qu'il a été relevé (même valid_from, pas dérivé d'une règle); false si le
+// grant a été retiré, réattribué ou repris par une règle depuis
+func (t grantTable) revokeSnapshot(tx *gorm.DB, userID, targetID uint, validFrom time.Time) (bool, error) {
+	query := "DELETE FROM " + t.table + " WHERE user_id = ? AND " + t.column + " = ? AND valid_from = ?"
+	if t.derived {
+		query += " AND NOT rule_derived"
+	}
+	result := tx.Exec(query, userID, targetID, validFrom)
+	return result.RowsAffected > 0, result.Error
+}
+
+// changed publie l'événement de changement (user.roles_changed ou group.members_changed); un changement
+// de rôle réévalue aussi les groupes dynamiques de l'utilisateur, dont les règles lisent les rôles directs
+func (t grantTable) changed(tx *gorm.DB, userID, targetID uint) error {
+	if t.kind == roleGrants.kind {
+		if err := enqueueUserRolesEvent(tx, userID); err != nil {
+			return err
+		}
+		var user User
+		if err := tx.First(&user, userID).Error; err != nil {
+			return ignoreNotFound(err)
+		}
+		return applyMembershipRules(tx, user)
+	}
+	return enqueueMembershipEvent(tx, targetID)
+}
+
+// grantDetails sont les détails d'audit d'une attribution
+func grantDetails(column string, targetID uint, options grantOptions) map[string]interface{} {
+	return map[string]interface{}{
+		column:        targetID,
+		"valid_from":  options.ValidFrom,
+		"valid_until": options.ValidUntil,
+		"reason":      options.Reason,
+	}
+}
+
+// validate vérifie la période d'un grant
+func (o grantOptions) validate() string {
+	if o.ValidUntil != nil {
+		if !o.ValidUntil.After(time.Now()) {
+			return "valid_until must be in the future"
+		}
+		if o.ValidFrom != nil && !o.ValidUntil.After(*o.ValidFrom) {
+			return "valid_until must be after valid_from"
+		}
+	}
+	return ""
+}
+
+// find charge les grants de la table sélectionnés par scope (conditions sur la table)
+func (t grantTable) find(db *gorm.DB, scope func(query *gorm.DB) *gorm.DB) ([]Grant, error) {
+	derived := "FALSE"
+	if t.derived {
+		derived = t.table + ".rule_derived"
+	}
+	query := db.Table(t.table).Select(t.table + ".user_id, " + t.table + "." + t.column + ", " + t.table + ".valid_from, " +
+		t.table + ".valid_until, " + t.table + ".reason, " + t.table + ".granted_by_id, " + derived)
+	rows, err := scope(query).Order(t.table + ".user_id, " + t.table + "." + t.column).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []Grant{}
+	now := time.Now()
+	for rows.Next() {
+		grant := Grant{Kind: t.kind}
+		if err := rows.Scan(&grant.UserID, &grant.TargetID, &grant.ValidFrom, &grant.ValidUntil, &grant.Reason, &grant.GrantedByID, &grant.RuleDerived); err != nil {
+			return nil, err
+		}
+		grant.Active = grant.activeAt(now)
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// userGrants liste les grants d'un utilisateur, actifs ou non (à venir, expirés pas encore balayés)
+func userGrants(db *gorm.DB, userID uint) ([]Grant, error) {
+	grants := []Grant{}
+	for _, t := range []grantTable{roleGrants, groupGrants} {
+		found, err := t.find(db, func(query *gorm.DB) *gorm.DB {
+			return query.Where("user_id = ?", userID)
+		})
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, found...)
+	}
+	return grants, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Balayage des grants expirés
+
+// runGrantSweeper révoque les grants expirés toutes les GRANT_SWEEP_INTERVAL (1 minute par défaut)
+func runGrantSweeper(db *gorm.DB) {
+	interval, err := time.ParseDuration(getenvDefault("GRANT_SWEEP_INTERVAL", "1m"))
+	if err != nil || interval <= 0 {
+		log.Printf("grants: invalid GRANT_SWEEP_INTERVAL, using 1m")
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		if _, err := sweepExpiredGrants(db); err != nil {
+			log.Printf("grants: failed to sweep expired grants: %v", err)
+		}
+	}
+}
+
+// sweepExpiredGrants supprime les grants expirés, chacun dans sa transaction avec ses événements
+// (grant.expired, puis user.roles_changed ou group.members_changed), et retourne leur nombre
+func sweepExpiredGrants(db *gorm.DB) (int, error) {
+	swept := 0
+	for _, t := range []grantTable{roleGrants, groupGrants} {
+		expired, err := t.find(db, func(query *gorm.DB) *gorm.DB {
+			return query.Where("valid_until <= ?", time.Now())
+		})
+		if err != nil {
+			return swept, err
+		}
+
+		for _, grant := range expired {
+			deleted := false
+			err := db.Transaction(func(tx *gorm.DB) error {
+				// un autre réplica a pu le supprimer, ou le grant a été prolongé entre-temps
+				result := tx.Exec("DELETE FROM "+t.table+" WHERE user_id = ? AND "+t.column+" = ? AND valid_until <= ?",
+					grant.UserID, grant.TargetID, time.Now())
+				if result.Error != nil || result.RowsAffected == 0 {
+					return result.Error
+				}
+				deleted = true
+				if err := enqueueEvent(tx, "grant.expired", "user", grant.UserID, grant); err != nil {
+					return err
+				}
+				return t.changed(tx, grant.UserID, grant.TargetID)
+			})
+			if err != nil {
+				return swept, err
+			}
+			if deleted {
+				recordAudit(db, nil, t.actions[2], "user", grant.UserID, grant, nil)
+				swept++
+			}
+		}
+	}
+	return swept, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint grants
+
+// getUserGrants liste les rôles et groupes accordés directement à un utilisateur, avec leur période de validité
+func getUserGrants(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		grants, err := userGrants(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching grants"})
+			return
+		}
+		c.JSON(http.StatusOK, grants)
+	}
+}
+
+// grantToUser accorde le rôle ou le groupe à l'utilisateur, avec une période de validité optionnelle;
+// params donne les paramètres de route de l'utilisateur et de la cible
+func grantToUser(db *gorm.DB, t grantTable, params grantParams) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user, targetID, ok := loadGrantParties(db, c, t, params)
+		if !ok || !authorizeGrantTarget(db, c, t, targetID) {
+			return
+		}
+		var options grantOptions
+		if err := c.ShouldBindJSON(&options); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid grant data"})
+			return
+		}
+		if message := options.validate(); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		caller := c.MustGet("user").(User)
+		options.GrantedByID = &caller.ID
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := t.grant(tx, user.ID, targetID, options); err != nil {
+				return err
+			}
+			return t.changed(tx, user.ID, targetID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error granting " + t.kind})
+			return
+		}
+		recordAudit(db, c, t.actions[0], "user", user.ID, nil, grantDetails(t.column, targetID, options))
+		c.JSON(http.StatusOK, gin.H{"message": "Granted"})
+	}
+}
+
+// revokeFromUser retire le rôle ou le groupe à l'utilisateur
+func revokeFromUser(db *gorm.DB, t grantTable, params grantParams) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user, targetID, ok := loadGrantParties(db, c, t, params)
+		if !ok || !authorizeGrantTarget(db, c, t, targetID) {
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := t.revoke(tx, user.ID, targetID); err != nil {
+				return err
+			}
+			return t.changed(tx, user.ID, targetID)
+		})
+		if errors.Is(err, errRuleDerived) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Membership comes from the group's membership rule"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking " + t.kind})
+			return
+		}
+		recordAudit(db, c, t.actions[1], "user", user.ID, gin.H{t.column: targetID}, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Revoked"})
+	}
+}
+
+// grantParams sont les paramètres de route de l'utilisateur et de la cible
+// (/users/:id/roles/:target_id, ou /groups/:id/members/:user_id)
+type grantParams struct {
+	user, target string
+}
+
+var (
+	userGrantParams   = grantParams{user: "id", target: "target_id"}
+	memberGrantParams = grantParams{user: "user_id", target: "id"}
+)
+
+// authorizeGrantTarget exige assign sur le rôle ou manage_members sur le groupe: update sur l'utilisateur
+// ne suffit pas, sinon un Editor (update:*) pourrait se donner le rôle Admin
+func authorizeGrantTarget(db *gorm.DB, c *gin.Context, t grantTable, targetID uint) bool {
+	caller := c.MustGet("user").(User)
+	decision, err := authorize(db, caller, t.policy[0], targetID, t.policy[1], requestAttributes(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
+		return false
+	}
+	if !decision.Allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "reason": decision.Reason})
+		return false
+	}
+	return true
+}
+
+// loadGrantParties charge l'utilisateur et vérifie que la cible existe dans l'organisation
+func loadGrantParties(db *gorm.DB, c *gin.Context, t grantTable, params grantParams) (User, uint, bool) {
+	var user User
+	if err := db.Where("id = ?", c.Param(params.user)).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return user, 0, false
+	}
+	targetID, _ := strconv.ParseUint(c.Param(params.target), 10, 64)
+	if err := db.Where("id = ?", targetID).First(t.target()).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": t.label + " not found"})
+		return user, 0, false
+	}
+	return user, uint(targetID), true
+}
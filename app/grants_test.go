@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGrantActiveAt(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	hour := time.Hour
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tests := []struct {
+		name       string
+		validFrom  time.Time
+		validUntil *time.Time
+		want       bool
+	}{
+		{"permanent", now.Add(-hour), nil, true},
+		{"starts now", now, nil, true},
+		{"starts later", now.Add(hour), nil, false},
+		{"not expired yet", now.Add(-hour), at(hour), true},
+		{"expires now", now.Add(-hour), at(0), false},
+		{"expired", now.Add(-2 * hour), at(-hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grant := Grant{ValidFrom: tt.validFrom, ValidUntil: tt.validUntil}
+			if got := grant.activeAt(now); got != tt.want {
+				t.Errorf("activeAt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGrantOptionsValidate(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	soon := time.Now().Add(time.Hour)
+	later := time.Now().Add(2 * time.Hour)
+
+	tests := []struct {
+		name    string
+		options grantOptions
+		want    string
+	}{
+		{"permanent", grantOptions{}, ""},
+		{"until later", grantOptions{ValidUntil: &soon}, ""},
+		{"from then until later", grantOptions{ValidFrom: &soon, ValidUntil: &later}, ""},
+		{"already expired", grantOptions{ValidUntil: &past}, "valid_until must be in the future"},
+		{"ends before it starts", grantOptions{ValidFrom: &later, ValidUntil: &soon}, "valid_until must be after valid_from"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.validate(); got != tt.want {
+				t.Errorf("validate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,943 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/jinzhu/gorm"
+)
+
+const graphqlSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+	me: User
+	user(id: ID!): User
+	users(limit: Int, offset: Int): [User!]!
+	role(id: ID!): Role
+	roles: [Role!]!
+	group(id: ID!): Group
+	groups: [Group!]!
+}
+
+type Mutation {
+	createUser(input: UserInput!): User!
+	updateUser(id: ID!, input: UserInput!): User!
+	deleteUser(id: ID!): Boolean!
+	createRole(input: RoleInput!): Role!
+	updateRole(id: ID!, input: RoleInput!): Role!
+	deleteRole(id: ID!): Boolean!
+	createGroup(input: GroupInput!): Group!
+	updateGroup(id: ID!, input: GroupInput!): Group!
+	deleteGroup(id: ID!): Boolean!
+}
+
+type User {
+	id: ID!
+	name: String!
+	email: String!
+	createdAt: Time!
+	updatedAt: Time!
+	roles: [Role!]!
+	groups: [Group!]!
+}
+
+type Role {
+	id: ID!
+	name: String!
+	description: String!
+	createdAt: Time!
+	updatedAt: Time!
+	users: [User!]!
+}
+
+type Group {
+	id: ID!
+	name: String!
+	parentGroupId: ID
+	createdAt: Time!
+	updatedAt: Time!
+	parent: Group
+	# parent, grand-parent... jusqu'à la racine
+	ancestors: [Group!]!
+	children: [Group!]!
+	members: [User!]!
+}
+
+input UserInput {
+	name: String
+	email: String
+}
+
+input RoleInput {
+	name: String
+	description: String
+}
+
+input GroupInput {
+	name: String
+	# null détache le groupe de son parent
+	parentGroupId: ID
+}
+`
+
+// graphqlRequest est le contexte d'une requête GraphQL: la requête gin (auth, audit) et ses loaders
+type graphqlRequest struct {
+	c             *gin.Context
+	db            *gorm.DB // limité à l'organisation de la requête
+	loaders       *graphqlLoaders
+	impersonating bool // token d'impersonation: les mutations sont refusées, comme forbidImpersonation
+
+	mu       sync.Mutex
+	readable map[string]bool // décisions read déjà prises pour les relations (type/id)
+}
+
+type graphqlContextKey struct{}
+
+func graphqlFrom(ctx context.Context) *graphqlRequest {
+	return ctx.Value(graphqlContextKey{}).(*graphqlRequest)
+}
+
+// authorize vérifie une opération comme enforcePolicies pour la route REST équivalente (users, roles, groups);
+// input est exposé aux conditions comme request.body
+func (r *graphqlRequest) authorize(resourceType string, id uint, action string, input interface{}) error {
+	if r.impersonating && action != "read" {
+		return errors.New("Not allowed while impersonating")
+	}
+	body := map[string]interface{}{}
+	if input != nil {
+		data, _ := json.Marshal(input)
+		json.Unmarshal(data, &body)
+	}
+	request := map[string]interface{}{"method": r.c.Request.Method, "path": r.c.Request.URL.Path, "body": body}
+	decision, err := authorize(r.db, r.c.MustGet("user").(User), resourceType, id, action, request)
+	if err != nil {
+		return errors.New("Error checking permissions")
+	}
+	if !decision.Allowed {
+		return errors.New("Forbidden: " + decision.Reason)
+	}
+	return nil
+}
+
+// canRead décide read sur resourceType/id pour les relations (user.roles, group.members...), une fois par objet
+// et par requête: une relation ne donne pas accès à ce que la requête de premier niveau refuserait
+func (r *graphqlRequest) canRead(resourceType string, id uint) (bool, error) {
+	key := resourceType + "/" + strconv.FormatUint(uint64(id), 10)
+	r.mu.Lock()
+	allowed, ok := r.readable[key]
+	r.mu.Unlock()
+	if ok {
+		return allowed, nil
+	}
+	request := map[string]interface{}{"method": r.c.Request.Method, "path": r.c.Request.URL.Path, "body": map[string]interface{}{}}
+	decision, err := authorize(r.db, r.c.MustGet("user").(User), resourceType, id, "read", request)
+	if err != nil {
+		return false, errors.New("Error checking permissions")
+	}
+	r.mu.Lock()
+	r.readable[key] = decision.Allowed
+	r.mu.Unlock()
+	return decision.Allowed, nil
+}
+
+// readableOnly retire d'une relation les objets que l'appelant ne peut pas lire
+func readableOnly[T any](ctx context.Context, resourceType string, items []T, idOf func(T) uint) ([]T, error) {
+	kept := make([]T, 0, len(items))
+	for _, item := range items {
+		allowed, err := graphqlFrom(ctx).canRead(resourceType, idOf(item))
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			kept = append(kept, item)
+		}
+	}
+	return kept, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint graphql
+
+// serveGraphQL exécute une requête GraphQL ({"query", "operationName", "variables"})
+func serveGraphQL(db *gorm.DB) gin.HandlerFunc {
+	schema := graphql.MustParseSchema(graphqlSchema, &graphqlResolver{}, graphql.MaxDepth(15))
+	return func(c *gin.Context) {
+		var params struct {
+			Query         string                 `json:"query"`
+			OperationName string                 `json:"operationName"`
+			Variables     map[string]interface{} `json:"variables"`
+		}
+		if err := c.BindJSON(&params); err != nil || params.Query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid GraphQL request"})
+			return
+		}
+
+		db := tenantDB(c, db)
+		_, impersonating := c.Get("impersonator")
+		request := &graphqlRequest{c: c, db: db, loaders: newGraphqlLoaders(db), impersonating: impersonating, readable: map[string]bool{}}
+		ctx := context.WithValue(c.Request.Context(), graphqlContextKey{}, request)
+		c.JSON(http.StatusOK, schema.Exec(ctx, params.Query, params.OperationName, params.Variables))
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// DataLoader
+
+// batchLoader regroupe les chargements par clé: les clés annoncées avec prime (ex: tous les
+// utilisateurs d'une liste) sont chargées en une requête au premier load, puis gardées pour la requête
+type batchLoader[T any] struct {
+	mu      sync.Mutex
+	fetch   func(ids []uint) (map[uint]T, error)
+	pending map[uint]bool
+	results map[uint]T
+}
+
+func newBatchLoader[T any](fetch func(ids []uint) (map[uint]T, error)) *batchLoader[T] {
+	return &batchLoader[T]{fetch: fetch, pending: map[uint]bool{}, results: map[uint]T{}}
+}
+
+func (l *batchLoader[T]) prime(ids ...uint) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, id := range ids {
+		if _, ok := l.results[id]; !ok {
+			l.pending[id] = true
+		}
+	}
+}
+
+// add enregistre une valeur déjà chargée par ailleurs
+func (l *batchLoader[T]) add(id uint, value T) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.results[id] = value
+	delete(l.pending, id)
+}
+
+func (l *batchLoader[T]) load(id uint) (T, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if value, ok := l.results[id]; ok {
+		return value, nil
+	}
+
+	l.pending[id] = true
+	ids := make([]uint, 0, len(l.pending))
+	for pendingID := range l.pending {
+		ids = append(ids, pendingID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	found, err := l.fetch(ids)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	for _, pendingID := range ids {
+		l.results[pendingID] = found[pendingID]
+		delete(l.pending, pendingID)
+	}
+	return l.results[id], nil
+}
+
+type graphqlLoaders struct {
+	groups        *batchLoader[*Group]
+	userRoles     *batchLoader[[]Role]
+	userGroups    *batchLoader[[]Group]
+	roleUsers     *batchLoader[[]User]
+	groupMembers  *batchLoader[[]User]
+	groupChildren *batchLoader[[]Group]
+}
+
+func newGraphqlLoaders(db *gorm.DB) *graphqlLoaders {
+	return &graphqlLoaders{
+		groups: newBatchLoader(func(ids []uint) (map[uint]*Group, error) {
+			var groups []Group
+			if err := db.Where("id IN (?)", ids).Find(&groups).Error; err != nil {
+				return nil, err
+			}
+			result := map[uint]*Group{}
+			for i := range groups {
+				result[groups[i].ID] = &groups[i]
+			}
+			return result, nil
+		}),
+		userRoles: newBatchLoader(func(ids []uint) (map[uint][]Role, error) {
+			return loadRelated(db, "user_roles", "user_id", "role_id", ids, func(r Role) uint { return r.ID })
+		}),
+		userGroups: newBatchLoader(func(ids []uint) (map[uint][]Group, error) {
+			return loadRelated(db, "user_groups", "user_id", "group_id", ids, func(g Group) uint { return g.ID })
+		}),
+		roleUsers: newBatchLoader(func(ids []uint) (map[uint][]User, error) {
+			return loadRelated(db, "user_roles", "role_id", "user_id", ids, func(u User) uint { return u.ID })
+		}),
+		groupMembers: newBatchLoader(func(ids []uint) (map[uint][]User, error) {
+			return loadRelated(db, "user_groups", "group_id", "user_id", ids, func(u User) uint { return u.ID })
+		}),
+		groupChildren: newBatchLoader(func(ids []uint) (map[uint][]Group, error) {
+			var groups []Group
+			if err := db.Where("parent_group_id IN (?)", ids).Order("id").Find(&groups).Error; err != nil {
+				return nil, err
+			}
+			result := map[uint][]Group{}
+			for _, group := range groups {
+				result[*group.ParentGroupID] = append(result[*group.ParentGroupID], group)
+			}
+			return result, nil
+		}),
+	}
+}
+
+// loadRelated suit une table de liaison (ex: user_roles) depuis ids, en deux requêtes quel que soit le nombre d'ids
+func loadRelated[T any](db *gorm.DB, table, fromColumn, toColumn string, ids []uint, idOf func(T) uint) (map[uint][]T, error) {
+	query := db.Table(table).Select(fromColumn+", "+toColumn).Where(fromColumn+" IN (?)", ids)
+	if grantTables[table] {
+		// user_roles et user_groups: seuls les grants valides maintenant comptent (voir grants.go)
+		query = whereActiveGrant(query, table)
+	}
+	rows, err := query.Order(toColumn).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edges := map[uint][]uint{}
+	var targetIDs []uint
+	for rows.Next() {
+		var from, to uint
+		if err := rows.Scan(&from, &to); err != nil {
+			return nil, err
+		}
+		edges[from] = append(edges[from], to)
+		targetIDs = append(targetIDs, to)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := map[uint][]T{}
+	if len(targetIDs) == 0 {
+		return result, nil
+	}
+	var targets []T
+	if err := db.Where("id IN (?)", targetIDs).Find(&targets).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uint]T{}
+	for _, target := range targets {
+		byID[idOf(target)] = target
+	}
+	for from, tos := range edges {
+		for _, to := range tos {
+			// les cibles supprimées (soft delete) sont ignorées
+			if target, ok := byID[to]; ok {
+				result[from] = append(result[from], target)
+			}
+		}
+	}
+	return result, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Resolvers des types
+
+type userResolver struct {
+	l    *graphqlLoaders
+	user User
+}
+
+type roleResolver struct {
+	l    *graphqlLoaders
+	role Role
+}
+
+type groupResolver struct {
+	l     *graphqlLoaders
+	group Group
+}
+
+// newUserResolvers annonce les utilisateurs aux loaders pour que leurs relations soient chargées ensemble
+func newUserResolvers(l *graphqlLoaders, users []User) []*userResolver {
+	resolvers := make([]*userResolver, len(users))
+	for i, user := range users {
+		l.userRoles.prime(user.ID)
+		l.userGroups.prime(user.ID)
+		resolvers[i] = &userResolver{l: l, user: user}
+	}
+	return resolvers
+}
+
+func newRoleResolvers(l *graphqlLoaders, roles []Role) []*roleResolver {
+	resolvers := make([]*roleResolver, len(roles))
+	for i, role := range roles {
+		l.roleUsers.prime(role.ID)
+		resolvers[i] = &roleResolver{l: l, role: role}
+	}
+	return resolvers
+}
+
+func newGroupResolvers(l *graphqlLoaders, groups []Group) []*groupResolver {
+	resolvers := make([]*groupResolver, len(groups))
+	for i := range groups {
+		group := groups[i]
+		l.groups.add(group.ID, &group)
+		l.groupMembers.prime(group.ID)
+		l.groupChildren.prime(group.ID)
+		if group.ParentGroupID != nil {
+			l.groups.prime(*group.ParentGroupID)
+		}
+		resolvers[i] = &groupResolver{l: l, group: group}
+	}
+	return resolvers
+}
+
+func (r *userResolver) ID() graphql.ID           { return graphqlID(r.user.ID) }
+func (r *userResolver) Name() string             { return r.user.Name }
+func (r *userResolver) Email() string            { return r.user.Email }
+func (r *userResolver) CreatedAt() graphql.Time  { return graphql.Time{Time: r.user.CreatedAt} }
+func (r *userResolver) UpdatedAt() graphql.Time  { return graphql.Time{Time: r.user.UpdatedAt} }
+func (r *roleResolver) ID() graphql.ID           { return graphqlID(r.role.ID) }
+func (r *roleResolver) Name() string             { return r.role.Name }
+func (r *roleResolver) Description() string      { return r.role.Description }
+func (r *roleResolver) CreatedAt() graphql.Time  { return graphql.Time{Time: r.role.CreatedAt} }
+func (r *roleResolver) UpdatedAt() graphql.Time  { return graphql.Time{Time: r.role.UpdatedAt} }
+func (r *groupResolver) ID() graphql.ID          { return graphqlID(r.group.ID) }
+func (r *groupResolver) Name() string            { return r.group.Name }
+func (r *groupResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.group.CreatedAt} }
+func (r *groupResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.group.UpdatedAt} }
+func (r *groupResolver) ParentGroupID() *graphql.ID {
+	if r.group.ParentGroupID == nil {
+		return nil
+	}
+	id := graphqlID(*r.group.ParentGroupID)
+	return &id
+}
+
+// les relations ne gardent que les objets lisibles par l'appelant (voir canRead)
+
+func (r *userResolver) Roles(ctx context.Context) ([]*roleResolver, error) {
+	roles, err := r.l.userRoles.load(r.user.ID)
+	if err == nil {
+		roles, err = readableOnly(ctx, "roles", roles, func(r Role) uint { return r.ID })
+	}
+	return newRoleResolvers(r.l, roles), err
+}
+
+func (r *userResolver) Groups(ctx context.Context) ([]*groupResolver, error) {
+	groups, err := r.l.userGroups.load(r.user.ID)
+	if err == nil {
+		groups, err = readableOnly(ctx, "groups", groups, func(g Group) uint { return g.ID })
+	}
+	return newGroupResolvers(r.l, groups), err
+}
+
+func (r *roleResolver) Users(ctx context.Context) ([]*userResolver, error) {
+	users, err := r.l.roleUsers.load(r.role.ID)
+	if err == nil {
+		users, err = readableOnly(ctx, "users", users, func(u User) uint { return u.ID })
+	}
+	return newUserResolvers(r.l, users), err
+}
+
+func (r *groupResolver) Members(ctx context.Context) ([]*userResolver, error) {
+	users, err := r.l.groupMembers.load(r.group.ID)
+	if err == nil {
+		users, err = readableOnly(ctx, "users", users, func(u User) uint { return u.ID })
+	}
+	return newUserResolvers(r.l, users), err
+}
+
+func (r *groupResolver) Children(ctx context.Context) ([]*groupResolver, error) {
+	groups, err := r.l.groupChildren.load(r.group.ID)
+	if err == nil {
+		groups, err = readableOnly(ctx, "groups", groups, func(g Group) uint { return g.ID })
+	}
+	return newGroupResolvers(r.l, groups), err
+}
+
+func (r *groupResolver) Parent(ctx context.Context) (*groupResolver, error) {
+	if r.group.ParentGroupID == nil {
+		return nil, nil
+	}
+	parent, err := r.l.groups.load(*r.group.ParentGroupID)
+	if err != nil || parent == nil {
+		return nil, err
+	}
+	if allowed, err := graphqlFrom(ctx).canRead("groups", parent.ID); err != nil || !allowed {
+		return nil, err
+	}
+	return newGroupResolvers(r.l, []Group{*parent})[0], nil
+}
+
+// Ancestors remonte la hiérarchie; les groupes frères partagent la même requête à chaque niveau
+func (r *groupResolver) Ancestors(ctx context.Context) ([]*groupResolver, error) {
+	var ancestors []Group
+	seen := map[uint]bool{r.group.ID: true}
+	for parentID := r.group.ParentGroupID; parentID != nil && !seen[*parentID]; {
+		seen[*parentID] = true
+		parent, err := r.l.groups.load(*parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			break
+		}
+		ancestors = append(ancestors, *parent)
+		if parent.ParentGroupID != nil {
+			r.l.groups.prime(*parent.ParentGroupID)
+		}
+		parentID = parent.ParentGroupID
+	}
+	ancestors, err := readableOnly(ctx, "groups", ancestors, func(g Group) uint { return g.ID })
+	return newGroupResolvers(r.l, ancestors), err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Resolvers des requêtes
+
+type graphqlResolver struct{}
+
+type idArgs struct {
+	ID graphql.ID
+}
+
+func (r *graphqlResolver) Me(ctx context.Context) *userResolver {
+	value, ok := graphqlFrom(ctx).c.Get("user")
+	user, isUser := value.(User)
+	if !ok || !isUser || user.ID == 0 {
+		return nil
+	}
+	return newUserResolvers(graphqlFrom(ctx).loaders, []User{user})[0]
+}
+
+func (r *graphqlResolver) User(ctx context.Context, args idArgs) (*userResolver, error) {
+	if err := graphqlFrom(ctx).authorize("users", parseGraphqlID(args.ID), "read", nil); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var user User
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&user).Error; err != nil {
+		return nil, notFoundOr(err, "User not found", "Error fetching user")
+	}
+	return newUserResolvers(graphqlFrom(ctx).loaders, []User{user})[0], nil
+}
+
+func (r *graphqlResolver) Users(ctx context.Context, args struct {
+	Limit  *int32
+	Offset *int32
+}) ([]*userResolver, error) {
+	if err := graphqlFrom(ctx).authorize("users", 0, "read", nil); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	query := db.Order("id")
+	if args.Limit != nil {
+		query = query.Limit(*args.Limit)
+	}
+	if args.Offset != nil {
+		query = query.Offset(*args.Offset)
+	}
+	var users []User
+	if err := query.Find(&users).Error; err != nil {
+		return nil, errors.New("Error fetching users")
+	}
+	return newUserResolvers(graphqlFrom(ctx).loaders, users), nil
+}
+
+func (r *graphqlResolver) Role(ctx context.Context, args idArgs) (*roleResolver, error) {
+	if err := graphqlFrom(ctx).authorize("roles", parseGraphqlID(args.ID), "read", nil); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var role Role
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&role).Error; err != nil {
+		return nil, notFoundOr(err, "Role not found", "Error fetching role")
+	}
+	return newRoleResolvers(graphqlFrom(ctx).loaders, []Role{role})[0], nil
+}
+
+func (r *graphqlResolver) Roles(ctx context.Context) ([]*roleResolver, error) {
+	if err := graphqlFrom(ctx).authorize("roles", 0, "read", nil); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var roles []Role
+	if err := db.Order("id").Find(&roles).Error; err != nil {
+		return nil, errors.New("Error fetching roles")
+	}
+	return newRoleResolvers(graphqlFrom(ctx).loaders, roles), nil
+}
+
+func (r *graphqlResolver) Group(ctx context.Context, args idArgs) (*groupResolver, error) {
+	if err := graphqlFrom(ctx).authorize("groups", parseGraphqlID(args.ID), "read", nil); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var group Group
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&group).Error; err != nil {
+		return nil, notFoundOr(err, "Group not found", "Error fetching group")
+	}
+	return newGroupResolvers(graphqlFrom(ctx).loaders, []Group{group})[0], nil
+}
+
+func (r *graphqlResolver) Groups(ctx context.Context) ([]*groupResolver, error) {
+	if err := graphqlFrom(ctx).authorize("groups", 0, "read", nil); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var groups []Group
+	if err := db.Order("id").Find(&groups).Error; err != nil {
+		return nil, errors.New("Error fetching groups")
+	}
+	return newGroupResolvers(graphqlFrom(ctx).loaders, groups), nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Resolvers des mutations (mêmes effets que les handlers REST: outbox et audit)
+
+type userInput struct {
+	Name  *string `json:"name,omitempty"`
+	Email *string `json:"email,omitempty"`
+}
+
+type roleInput struct {
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+type groupInput struct {
+	Name          *string `json:"name,omitempty"`
+	ParentGroupID nullID  `json:"parent_group_id"`
+}
+
+func (r *graphqlResolver) CreateUser(ctx context.Context, args struct{ Input userInput }) (*userResolver, error) {
+	if err := graphqlFrom(ctx).authorize("users", 0, "create", args.Input); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var user User
+	args.Input.apply(&user)
+	if err := validateUserAttributes(db, &user); err != nil {
+		if invalid, ok := err.(*attributeError); ok {
+			return nil, errors.New(invalid.message)
+		}
+		return nil, errors.New("Error creating user")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := enqueueEvent(tx, "user.created", "user", user.ID, user); err != nil {
+			return err
+		}
+		return applyMembershipRules(tx, user)
+	})
+	if err != nil {
+		return nil, errors.New("Error creating user")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "user.create", "user", user.ID, nil, user)
+	return newUserResolvers(graphqlFrom(ctx).loaders, []User{user})[0], nil
+}
+
+func (r *graphqlResolver) UpdateUser(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input userInput
+}) (*userResolver, error) {
+	if err := graphqlFrom(ctx).authorize("users", parseGraphqlID(args.ID), "update", args.Input); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var user User
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&user).Error; err != nil {
+		return nil, notFoundOr(err, "User not found", "Error fetching user")
+	}
+	before := user
+	args.Input.apply(&user)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if err := enqueueEvent(tx, "user.updated", "user", user.ID, user); err != nil {
+			return err
+		}
+		return applyMembershipRules(tx, user)
+	})
+	if err != nil {
+		return nil, errors.New("Error updating user")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "user.update", "user", user.ID, before, user)
+	return newUserResolvers(graphqlFrom(ctx).loaders, []User{user})[0], nil
+}
+
+func (r *graphqlResolver) DeleteUser(ctx context.Context, args idArgs) (bool, error) {
+	if err := graphqlFrom(ctx).authorize("users", parseGraphqlID(args.ID), "delete", nil); err != nil {
+		return false, err
+	}
+	db := graphqlFrom(ctx).db
+	var user User
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&user).Error; err != nil {
+		return false, notFoundOr(err, "User not found", "Error fetching user")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return softDeleteUser(tx, user)
+	})
+	if err != nil {
+		return false, errors.New("Error deleting user")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "user.delete", "user", user.ID, user, nil)
+	return true, nil
+}
+
+func (r *graphqlResolver) CreateRole(ctx context.Context, args struct{ Input roleInput }) (*roleResolver, error) {
+	if err := graphqlFrom(ctx).authorize("roles", 0, "create", args.Input); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var role Role
+	args.Input.apply(&role)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "role.created", "role", role.ID, role)
+	})
+	if err != nil {
+		return nil, errors.New("Error creating role")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "role.create", "role", role.ID, nil, role)
+	return newRoleResolvers(graphqlFrom(ctx).loaders, []Role{role})[0], nil
+}
+
+func (r *graphqlResolver) UpdateRole(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input roleInput
+}) (*roleResolver, error) {
+	if err := graphqlFrom(ctx).authorize("roles", parseGraphqlID(args.ID), "update", args.Input); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var role Role
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&role).Error; err != nil {
+		return nil, notFoundOr(err, "Role not found", "Error fetching role")
+	}
+	before := role
+	args.Input.apply(&role)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "role.updated", "role", role.ID, role)
+	})
+	if err != nil {
+		return nil, errors.New("Error updating role")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "role.update", "role", role.ID, before, role)
+	return newRoleResolvers(graphqlFrom(ctx).loaders, []Role{role})[0], nil
+}
+
+func (r *graphqlResolver) DeleteRole(ctx context.Context, args idArgs) (bool, error) {
+	if err := graphqlFrom(ctx).authorize("roles", parseGraphqlID(args.ID), "delete", nil); err != nil {
+		return false, err
+	}
+	db := graphqlFrom(ctx).db
+	var role Role
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&role).Error; err != nil {
+		return false, notFoundOr(err, "Role not found", "Error fetching role")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&role).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "role.deleted", "role", role.ID, role)
+	})
+	if err != nil {
+		return false, errors.New("Error deleting role")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "role.delete", "role", role.ID, role, nil)
+	return true, nil
+}
+
+func (r *graphqlResolver) CreateGroup(ctx context.Context, args struct{ Input groupInput }) (*groupResolver, error) {
+	if err := graphqlFrom(ctx).authorize("groups", 0, "create", args.Input); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var group Group
+	args.Input.apply(&group)
+	if message := checkGroupParent(db, 0, group.ParentGroupID); message != "" {
+		return nil, errors.New(message)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "group.created", "group", group.ID, group)
+	})
+	if err != nil {
+		return nil, errors.New("Error creating group")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "group.create", "group", group.ID, nil, group)
+	return newGroupResolvers(graphqlFrom(ctx).loaders, []Group{group})[0], nil
+}
+
+func (r *graphqlResolver) UpdateGroup(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input groupInput
+}) (*groupResolver, error) {
+	if err := graphqlFrom(ctx).authorize("groups", parseGraphqlID(args.ID), "update", args.Input); err != nil {
+		return nil, err
+	}
+	db := graphqlFrom(ctx).db
+	var group Group
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&group).Error; err != nil {
+		return nil, notFoundOr(err, "Group not found", "Error fetching group")
+	}
+	before := group
+	args.Input.apply(&group)
+	if message := checkGroupParent(db, group.ID, group.ParentGroupID); message != "" {
+		return nil, errors.New(message)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&group).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "group.updated", "group", group.ID, group)
+	})
+	if err != nil {
+		return nil, errors.New("Error updating group")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "group.update", "group", group.ID, before, group)
+	return newGroupResolvers(graphqlFrom(ctx).loaders, []Group{group})[0], nil
+}
+
+func (r *graphqlResolver) DeleteGroup(ctx context.Context, args idArgs) (bool, error) {
+	if err := graphqlFrom(ctx).authorize("groups", parseGraphqlID(args.ID), "delete", nil); err != nil {
+		return false, err
+	}
+	db := graphqlFrom(ctx).db
+	var group Group
+	if err := db.Where("id = ?", parseGraphqlID(args.ID)).First(&group).Error; err != nil {
+		return false, notFoundOr(err, "Group not found", "Error fetching group")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&group).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "group.deleted", "group", group.ID, group)
+	})
+	if err != nil {
+		return false, errors.New("Error deleting group")
+	}
+	recordAudit(db, graphqlFrom(ctx).c, "group.delete", "group", group.ID, group, nil)
+	return true, nil
+}
+
+func (in userInput) apply(user *User) {
+	if in.Name != nil {
+		user.Name = *in.Name
+	}
+	if in.Email != nil {
+		user.Email = *in.Email
+	}
+}
+
+func (in roleInput) apply(role *Role) {
+	if in.Name != nil {
+		role.Name = *in.Name
+	}
+	if in.Description != nil {
+		role.Description = *in.Description
+	}
+}
+
+func (in groupInput) apply(group *Group) {
+	if in.Name != nil {
+		group.Name = *in.Name
+	}
+	if in.ParentGroupID.Set {
+		group.ParentGroupID = nil
+		if in.ParentGroupID.Value != nil {
+			id := parseGraphqlID(*in.ParentGroupID.Value)
+			group.ParentGroupID = &id
+		}
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// nullID distingue un ID explicitement null d'un ID absent (comme graphql.NullString)
+type nullID struct {
+	Value *graphql.ID
+	Set   bool
+}
+
+func (nullID) ImplementsGraphQLType(name string) bool {
+	return name == "ID"
+}
+
+func (n *nullID) UnmarshalGraphQL(input interface{}) error {
+	n.Set = true
+	if input == nil {
+		return nil
+	}
+	var id graphql.ID
+	if err := id.UnmarshalGraphQL(input); err != nil {
+		return err
+	}
+	n.Value = &id
+	return nil
+}
+
+func (n *nullID) Nullable() {}
+
+// MarshalJSON donne l'ID en nombre, null s'il est absent ou null (request.body des politiques)
+func (n nullID) MarshalJSON() ([]byte, error) {
+	if n.Value == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(parseGraphqlID(*n.Value))
+}
+
+func graphqlID(id uint) graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(id), 10))
+}
+
+// parseGraphqlID retourne 0 (aucun enregistrement) pour un ID invalide
+func parseGraphqlID(id graphql.ID) uint {
+	value, _ := strconv.ParseUint(string(id), 10, 64)
+	return uint(value)
+}
+
+func notFoundOr(err error, notFound, message string) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return errors.New(notFound)
+	}
+	return errors.New(message)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Propriétaires de groupe: un propriétaire administre son groupe et tous ses sous-groupes sans droits globaux.
+// decide lui accorde les ownerActions sur groups/:id dans ce sous-arbre; seul un administrateur
+// (action manage_owners sur le groupe) nomme ou retire les propriétaires.
+
+// ownerActions sont les actions déléguées aux propriétaires
+var ownerActions = map[string]bool{
+	"read":            true,
+	"manage_members":  true, // /groups/:id/members
+	"create_subgroup": true, // POST /groups/:id/subgroups
+	"approve":         true, // demandes d'accès au groupe
+}
+
+// loadOwnedGroups charge les groupes dont userID est propriétaire et leurs descendants, un niveau (une requête)
+// à la fois; chaque groupe est associé au groupe possédé qui donne le droit
+func loadOwnedGroups(db *gorm.DB, userID uint) (map[uint]Group, error) {
+	owned, err := loadRelated(db, "group_owners", "user_id", "group_id", []uint{userID}, func(g Group) uint { return g.ID })
+	if err != nil {
+		return nil, err
+	}
+	result := map[uint]Group{}
+	level := owned[userID]
+	for _, group := range level {
+		result[group.ID] = group
+	}
+	for len(level) > 0 {
+		parentIDs := make([]uint, len(level))
+		for i, group := range level {
+			parentIDs[i] = group.ID
+		}
+		var children []Group
+		if err := db.Where("parent_group_id IN (?)", parentIDs).Find(&children).Error; err != nil {
+			return nil, err
+		}
+		level = nil
+		for _, child := range children {
+			if _, seen := result[child.ID]; !seen {
+				result[child.ID] = result[*child.ParentGroupID]
+				level = append(level, child)
+			}
+		}
+	}
+	return result, nil
+}
+
+// loadGroupRoleChains donne pour chaque groupe les rôles qu'il confère à ses membres: ses group_roles et
+// ceux de ses ancêtres, comme loadAuthzSubject
+func loadGroupRoleChains(db *gorm.DB, groups map[uint]Group) (map[uint][]Role, error) {
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	var list []Group
+	if err := db.Where("id IN (?)", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	lineage, err := withAncestors(db, list)
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[uint]uint, len(lineage))
+	lineageIDs := make([]uint, len(lineage))
+	for i, group := range lineage {
+		lineageIDs[i] = group.ID
+		if group.ParentGroupID != nil {
+			parents[group.ID] = *group.ParentGroupID
+		}
+	}
+	granted, err := loadRelated(db, "group_roles", "group_id", "role_id", lineageIDs, func(r Role) uint { return r.ID })
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint][]Role, len(groups))
+	for _, id := range ids {
+		seen := map[uint]bool{}
+		for next := id; next != 0 && !seen[next]; next = parents[next] {
+			seen[next] = true
+			result[id] = append(result[id], granted[next]...)
+		}
+	}
+	return result, nil
+}
+
+// escalatingRole retourne un rôle conféré par le groupe que le sujet n'a pas déjà: ajouter des membres (ou
+// approuver une demande) reviendrait alors à distribuer ce rôle
+func (s *authzSubject) escalatingRole(groupID uint) (Role, bool) {
+	held := map[uint]bool{}
+	for _, granted := range s.Roles {
+		held[granted.Role.ID] = true
+	}
+	for _, role := range s.OwnedRoles[groupID] {
+		if !held[role.ID] {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
+
+// checkOwnership autorise une ownerAction sur un groupe du sous-arbre possédé; manage_members et approve sont
+// refusés si le groupe (ou un ancêtre) donne un rôle que le propriétaire n'a pas
+func (s *authzSubject) checkOwnership(action, resource string) (authzDecision, bool) {
+	resourceType, id := parseResourceRef(resource)
+	if !ownerActions[action] || resourceType != "groups" {
+		return authzDecision{}, false
+	}
+	owned, ok := s.OwnedGroups[id]
+	if !ok {
+		return authzDecision{}, false
+	}
+	if action == "manage_members" || action == "approve" {
+		if role, escalates := s.escalatingRole(id); escalates {
+			return authzDecision{
+				UserID:   s.User.ID,
+				Action:   action,
+				Resource: resource,
+				Group:    owned.Name,
+				Reason:   fmt.Sprintf("group grants role %q, which the owner does not hold", role.Name),
+			}, true
+		}
+	}
+	return authzDecision{
+		UserID:   s.User.ID,
+		Action:   action,
+		Resource: resource,
+		Allowed:  true,
+		Group:    owned.Name,
+		Reason:   fmt.Sprintf("owner of group %q", owned.Name),
+	}, true
+}
+
+// ownedGroupIDs donne les IDs des groupes administrés, pour les politiques (subject.owned_group_ids)
+func (s *authzSubject) ownedGroupIDs() []int64 {
+	ids := make([]int64, 0, len(s.OwnedGroups))
+	for id := range s.OwnedGroups {
+		ids = append(ids, int64(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// groupOwnersOf retrouve les propriétaires d'un groupe et de ses ancêtres
+func groupOwnersOf(db *gorm.DB, groupID uint) ([]User, error) {
+	var group Group
+	if err := db.First(&group, groupID).Error; err != nil {
+		return nil, ignoreNotFound(err)
+	}
+	lineage, err := withAncestors(db, []Group{group})
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(lineage))
+	for i, g := range lineage {
+		ids[i] = g.ID
+	}
+	owners, err := loadRelated(db, "group_owners", "group_id", "user_id", ids, func(u User) uint { return u.ID })
+	if err != nil {
+		return nil, err
+	}
+	var users []User
+	seen := map[uint]bool{}
+	for _, id := range ids {
+		for _, user := range owners[id] {
+			if !seen[user.ID] {
+				seen[user.ID] = true
+				users = append(users, user)
+			}
+		}
+	}
+	return users, nil
+}
+
+// enqueueOwnersEvent publie la liste à jour des propriétaires d'un groupe (group.owners_changed)
+func enqueueOwnersEvent(tx *gorm.DB, groupID uint) error {
+	ownerIDs := []uint{}
+	if err := tx.Table("group_owners").Where("group_id = ?", groupID).Order("user_id").Pluck("user_id", &ownerIDs).Error; err != nil {
+		return err
+	}
+	return enqueueEvent(tx, "group.owners_changed", "group", groupID, map[string]interface{}{
+		"group_id":  groupID,
+		"owner_ids": ownerIDs,
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint group owners and members
+
+// getGroupOwners liste les propriétaires directs d'un groupe
+func getGroupOwners(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var group Group
+		if err := db.Where("id = ?", c.Param("id")).First(&group).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		owners, err := loadRelated(db, "group_owners", "group_id", "user_id", []uint{group.ID}, func(u User) uint { return u.ID })
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching owners"})
+			return
+		}
+		c.JSON(http.StatusOK, append([]User{}, owners[group.ID]...))
+	}
+}
+
+// setGroupOwner nomme (owner=true) ou retire l'utilisateur :user_id comme propriétaire du groupe :id
+func setGroupOwner(db *gorm.DB, owner bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var group Group
+		if err := db.Where("id = ?", c.Param("id")).First(&group).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		var user User
+		if err := db.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		caller := c.MustGet("user").(User)
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if owner {
+				err = tx.Exec("INSERT INTO group_owners (group_id, user_id, granted_by_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+					group.ID, user.ID, caller.ID).Error
+			} else {
+				err = tx.Exec("DELETE FROM group_owners WHERE group_id = ? AND user_id = ?", group.ID, user.ID).Error
+			}
+			if err != nil {
+				return err
+			}
+			return enqueueOwnersEvent(tx, group.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating owners"})
+			return
+		}
+		if owner {
+			recordAudit(db, c, "group.owner_add", "group", group.ID, nil, gin.H{"user_id": user.ID})
+			c.JSON(http.StatusOK, gin.H{"message": "Owner added"})
+			return
+		}
+		recordAudit(db, c, "group.owner_remove", "group", group.ID, gin.H{"user_id": user.ID}, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Owner removed"})
+	}
+}
+
+// getGroupMembers liste les membres directs du groupe (grants actifs)
+func getGroupMembers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var group Group
+		if err := db.Where("id = ?", c.Param("id")).First(&group).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		members, err := loadRelated(db, "user_groups", "group_id", "user_id", []uint{group.ID}, func(u User) uint { return u.ID })
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching members"})
+			return
+		}
+		c.JSON(http.StatusOK, append([]User{}, members[group.ID]...))
+	}
+}
+
+// createSubgroup crée un sous-groupe du groupe :id
+func createSubgroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var parent Group
+		if err := db.Where("id = ?", c.Param("id")).First(&parent).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		var group Group
+		if err := c.BindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group data"})
+			return
+		}
+		// les rôles d'un groupe restent gérés par les administrateurs
+		group.ID, group.ParentGroupID, group.Roles = 0, &parent.ID, nil
+		insertGroup(db, c, group)
+	}
+}
@@ -0,0 +1,924 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"sdvgolan/identitypb"
+)
+
+// serveGRPC démarre l'API gRPC (voir identitypb/identity.proto) sur GRPC_PORT (9090 par défaut)
+func serveGRPC(db *gorm.DB) {
+	listener, err := net.Listen("tcp", ":"+getenvDefault("GRPC_PORT", "9090"))
+	if err != nil {
+		log.Printf("grpc: cannot listen: %v", err)
+		return
+	}
+
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcUnaryAuth, grpcUnaryAuthorize),
+		grpc.ChainStreamInterceptor(grpcStreamAuth, grpcStreamAuthorize),
+	)
+	identitypb.RegisterUsersServer(server, &grpcUsers{db: db})
+	identitypb.RegisterRolesServer(server, &grpcRoles{db: db})
+	identitypb.RegisterGroupsServer(server, &grpcGroups{db: db})
+	identitypb.RegisterAuthServer(server, &grpcAuth{db: db})
+
+	if err := server.Serve(listener); err != nil {
+		log.Printf("grpc: server stopped: %v", err)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Interceptors d'auth: même JWT que requireAuth, dans les métadonnées "authorization: Bearer <token>"
+
+type grpcUserKey struct{}
+
+// utilisateur qui a ouvert la session d'impersonation
+type grpcImpersonatorKey struct{}
+
+// organisation de l'appel (claim org, ou métadonnée x-org-id pour un administrateur multi-organisations)
+type grpcOrgKey struct{}
+
+// grpcPublicMethods peuvent être appelées sans token
+var grpcPublicMethods = map[string]bool{
+	"/identity.v1.Auth/Login":         true,
+	"/identity.v1.Auth/ValidateToken": true,
+}
+
+func grpcAuthenticate(ctx context.Context, method string) (context.Context, error) {
+	ctx = context.WithValue(ctx, grpcRequestIDKey{}, grpcRequestID(ctx))
+	if grpcPublicMethods[method] {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	user, session, err := sessionFromToken(strings.TrimPrefix(values[0], "Bearer "))
+	var inactive inactiveAccountError
+	if errors.As(err, &inactive) {
+		return nil, status.Error(codes.PermissionDenied, "account is "+inactive.status)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	impersonator, impersonating, err := impersonatorOf(session)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if impersonating {
+		ctx = context.WithValue(ctx, grpcImpersonatorKey{}, impersonator)
+	}
+
+	// mêmes règles que resolveTenant
+	crossTenant := user.CrossTenantAdmin
+	if impersonating {
+		crossTenant = impersonator.CrossTenantAdmin
+	}
+	if user.OrganizationID != session.OrganizationID && !user.CrossTenantAdmin {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	org := session.OrganizationID
+	if values := md.Get("x-org-id"); len(values) > 0 && strings.TrimSpace(values[0]) != "" {
+		id, err := strconv.ParseUint(strings.TrimSpace(values[0]), 10, 64)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid x-org-id")
+		}
+		if uint(id) != org {
+			if !crossTenant {
+				return nil, status.Error(codes.PermissionDenied, "cross-tenant access requires a cross-tenant admin")
+			}
+			if err := db.First(&Organization{}, id).Error; err != nil {
+				return nil, status.Error(codes.NotFound, "organization not found")
+			}
+			org = uint(id)
+		}
+	}
+	ctx = context.WithValue(ctx, grpcOrgKey{}, org)
+	return context.WithValue(ctx, grpcUserKey{}, user), nil
+}
+
+// grpcTenant limite db à l'organisation de l'appel, comme tenantDB
+func grpcTenant(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if org, ok := ctx.Value(grpcOrgKey{}).(uint); ok {
+		return scopeTenant(db, org)
+	}
+	return db
+}
+
+// auditImpersonatedCall trace chaque appel fait sous impersonation, comme auditImpersonatedRequest
+func auditImpersonatedCall(ctx context.Context, method string, err error) {
+	if _, ok := ctx.Value(grpcImpersonatorKey{}).(User); ok {
+		recordGRPCAudit(db, ctx, "impersonation.request", "request", method, nil, map[string]string{"code": status.Code(err).String()})
+	}
+}
+
+func grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcAuthenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	auditImpersonatedCall(ctx, info.FullMethod, err)
+	return resp, err
+}
+
+func grpcStreamAuth(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcAuthenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	err = handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	auditImpersonatedCall(ctx, info.FullMethod, err)
+	return err
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Interceptors d'autorisation: chaque méthode est vérifiée par authorize comme la route REST équivalente
+// (politiques, permissions des rôles, propriétaires de groupe)
+
+// grpcPermission est la ressource et l'action d'une méthode; target est le champ de la requête qui donne l'ID
+// de la ressource (id, user_id, group_id), vide pour la collection
+type grpcPermission struct {
+	resourceType string
+	action       string
+	target       string
+}
+
+var grpcPermissions = map[string]grpcPermission{
+	"/identity.v1.Users/ListUsers":      {"users", "read", ""},
+	"/identity.v1.Users/GetUser":        {"users", "read", "id"},
+	"/identity.v1.Users/CreateUser":     {"users", "create", ""},
+	"/identity.v1.Users/UpdateUser":     {"users", "update", "id"},
+	"/identity.v1.Users/DeleteUser":     {"users", "delete", "id"},
+	"/identity.v1.Users/ListUserRoles":  {"users", "read", "id"},
+	"/identity.v1.Users/ListUserGroups": {"users", "read", "id"},
+
+	"/identity.v1.Roles/ListRoles":     {"roles", "read", ""},
+	"/identity.v1.Roles/GetRole":       {"roles", "read", "id"},
+	"/identity.v1.Roles/CreateRole":    {"roles", "create", ""},
+	"/identity.v1.Roles/UpdateRole":    {"roles", "update", "id"},
+	"/identity.v1.Roles/DeleteRole":    {"roles", "delete", "id"},
+	"/identity.v1.Roles/ListRoleUsers": {"roles", "read", "id"},
+	// PUT et DELETE /users/:id/roles/:role_id
+	"/identity.v1.Roles/AssignRole": {"users", "update", "user_id"},
+	"/identity.v1.Roles/RevokeRole": {"users", "delete", "user_id"},
+
+	"/identity.v1.Groups/ListGroups":   {"groups", "read", ""},
+	"/identity.v1.Groups/GetGroup":     {"groups", "read", "id"},
+	"/identity.v1.Groups/CreateGroup":  {"groups", "create", ""},
+	"/identity.v1.Groups/UpdateGroup":  {"groups", "update", "id"},
+	"/identity.v1.Groups/DeleteGroup":  {"groups", "delete", "id"},
+	"/identity.v1.Groups/ListMembers":  {"groups", "read", "id"},
+	"/identity.v1.Groups/AddMember":    {"groups", "manage_members", "group_id"},
+	"/identity.v1.Groups/RemoveMember": {"groups", "manage_members", "group_id"},
+}
+
+func (p grpcPermission) targetID(req interface{}) uint {
+	switch p.target {
+	case "id":
+		if r, ok := req.(interface{ GetId() uint64 }); ok {
+			return uint(r.GetId())
+		}
+	case "user_id":
+		if r, ok := req.(interface{ GetUserId() uint64 }); ok {
+			return uint(r.GetUserId())
+		}
+	case "group_id":
+		if r, ok := req.(interface{ GetGroupId() uint64 }); ok {
+			return uint(r.GetGroupId())
+		}
+	}
+	return 0
+}
+
+// grpcAuthorize vérifie l'appel; une méthode sans permission connue est refusée
+func grpcAuthorize(ctx context.Context, method string, req interface{}) error {
+	if grpcPublicMethods[method] {
+		return nil
+	}
+	permission, ok := grpcPermissions[method]
+	if !ok {
+		return status.Error(codes.PermissionDenied, "method is not authorized")
+	}
+	// comme forbidImpersonation: un token d'impersonation ne fait que lire
+	if _, impersonating := ctx.Value(grpcImpersonatorKey{}).(User); impersonating && permission.action != "read" {
+		return status.Error(codes.PermissionDenied, "Not allowed while impersonating")
+	}
+	return grpcCheck(ctx, grpcTenant(ctx, db), method, req, permission.resourceType, permission.targetID(req), permission.action)
+}
+
+// grpcCheck décide une action comme authorize, avec la requête gRPC comme attributs request
+func grpcCheck(ctx context.Context, db *gorm.DB, method string, req interface{}, resourceType string, id uint, action string) error {
+	user, _ := ctx.Value(grpcUserKey{}).(User)
+	body := map[string]interface{}{}
+	if message, ok := req.(proto.Message); ok {
+		if data, err := (protojson.MarshalOptions{UseProtoNames: true}).Marshal(message); err == nil {
+			json.Unmarshal(data, &body)
+		}
+	}
+	request := map[string]interface{}{"method": "GRPC", "path": method, "body": body}
+
+	decision, err := authorize(db, user, resourceType, id, action, request)
+	if err != nil {
+		return status.Error(codes.Internal, "Error checking permissions")
+	}
+	if !decision.Allowed {
+		return status.Error(codes.PermissionDenied, decision.Reason)
+	}
+	return nil
+}
+
+func grpcUnaryAuthorize(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := grpcAuthorize(ctx, info.FullMethod, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// grpcStreamAuthorize vérifie l'appel à la lecture de la requête (le premier message du flux)
+func grpcStreamAuthorize(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &authorizedStream{ServerStream: stream, method: info.FullMethod})
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	method     string
+	authorized bool
+}
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if !s.authorized {
+		if err := grpcAuthorize(s.Context(), s.method, m); err != nil {
+			return err
+		}
+		s.authorized = true
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Audit des appels gRPC (équivalent de recordAudit)
+
+type grpcRequestIDKey struct{}
+
+// grpcRequestID reprend x-request-id des métadonnées ou en génère un
+func grpcRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-request-id"); len(values) > 0 && values[0] != "" {
+		return values[0]
+	}
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func grpcAuditEvent(ctx context.Context, action, targetType string, targetID interface{}, before, after interface{}) AuditEvent {
+	event := newAuditEvent(nil, action, targetType, targetID, before, after)
+	event.Actor = "anonymous"
+	if user, ok := ctx.Value(grpcUserKey{}).(User); ok {
+		event.ActorID = &user.ID
+		event.Actor = user.Email
+	}
+	if impersonator, ok := ctx.Value(grpcImpersonatorKey{}).(User); ok {
+		event.Actor = fmt.Sprintf("%s (as %s)", impersonator.Email, event.Actor)
+		event.ActorID = &impersonator.ID
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			event.IP = host
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user-agent"); len(values) > 0 {
+		event.UserAgent = values[0]
+	}
+	event.RequestID, _ = ctx.Value(grpcRequestIDKey{}).(string)
+	return event
+}
+
+func recordGRPCAudit(db *gorm.DB, ctx context.Context, action, targetType string, targetID interface{}, before, after interface{}) {
+	saveAudit(db, grpcAuditEvent(ctx, action, targetType, targetID, before, after))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Conversions
+
+// grpcGrantOptions construit les options d'un grant (période, raison, appelant) depuis une requête gRPC
+func grpcGrantOptions(ctx context.Context, validFrom, validUntil *timestamppb.Timestamp, reason string) (grantOptions, error) {
+	options := grantOptions{Reason: reason}
+	if validFrom != nil {
+		from := validFrom.AsTime()
+		options.ValidFrom = &from
+	}
+	if validUntil != nil {
+		until := validUntil.AsTime()
+		options.ValidUntil = &until
+	}
+	if message := options.validate(); message != "" {
+		return options, status.Error(codes.InvalidArgument, message)
+	}
+	if caller, ok := ctx.Value(grpcUserKey{}).(User); ok {
+		options.GrantedByID = &caller.ID
+	}
+	return options, nil
+}
+
+func toUserPB(user User) *identitypb.User {
+	return &identitypb.User{
+		Id:        uint64(user.ID),
+		Name:      user.Name,
+		Email:     user.Email,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+	}
+}
+
+func toRolePB(role Role) *identitypb.Role {
+	return &identitypb.Role{
+		Id:          uint64(role.ID),
+		Name:        role.Name,
+		Description: role.Description,
+		CreatedAt:   timestamppb.New(role.CreatedAt),
+		UpdatedAt:   timestamppb.New(role.UpdatedAt),
+	}
+}
+
+func toGroupPB(group Group) *identitypb.Group {
+	pb := &identitypb.Group{
+		Id:        uint64(group.ID),
+		Name:      group.Name,
+		CreatedAt: timestamppb.New(group.CreatedAt),
+		UpdatedAt: timestamppb.New(group.UpdatedAt),
+	}
+	if group.ParentGroupID != nil {
+		parentID := uint64(*group.ParentGroupID)
+		pb.ParentGroupId = &parentID
+	}
+	return pb
+}
+
+// grpcError traduit une erreur gorm: NotFound si l'enregistrement n'existe pas, Internal sinon
+func grpcError(err error, notFound, message string) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return status.Error(codes.NotFound, notFound)
+	}
+	return status.Error(codes.Internal, message)
+}
+
+// grpcAttributeError traduit une erreur de validateUserAttributes: InvalidArgument, AlreadyExists (valeur unique
+// déjà prise) ou Internal
+func grpcAttributeError(err error) error {
+	invalid, ok := err.(*attributeError)
+	switch {
+	case !ok:
+		return status.Error(codes.Internal, "Error validating attributes")
+	case invalid.status == http.StatusConflict:
+		return status.Error(codes.AlreadyExists, invalid.message)
+	default:
+		return status.Error(codes.InvalidArgument, invalid.message)
+	}
+}
+
+// streamRows envoie les lignes de query une par une, sans tout charger en mémoire
+func streamRows(db, query *gorm.DB, list *identitypb.ListRequest, dest interface{}, send func() error) error {
+	if list != nil {
+		if list.Limit > 0 {
+			query = query.Limit(list.Limit)
+		}
+		if list.Offset > 0 {
+			query = query.Offset(list.Offset)
+		}
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return status.Error(codes.Internal, "Error fetching rows")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := db.ScanRows(rows, dest); err != nil {
+			return status.Error(codes.Internal, "Error reading rows")
+		}
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Service Users
+
+type grpcUsers struct {
+	identitypb.UnimplementedUsersServer
+	db *gorm.DB
+}
+
+func (s *grpcUsers) ListUsers(req *identitypb.ListRequest, stream identitypb.Users_ListUsersServer) error {
+	db := grpcTenant(stream.Context(), s.db)
+	var user User
+	return streamRows(db, db.Model(&User{}).Order("id"), req, &user, func() error {
+		return stream.Send(toUserPB(user))
+	})
+}
+
+func (s *grpcUsers) GetUser(ctx context.Context, req *identitypb.GetRequest) (*identitypb.User, error) {
+	db := grpcTenant(ctx, s.db)
+	var user User
+	if err := db.Where("id = ?", req.Id).First(&user).Error; err != nil {
+		return nil, grpcError(err, "User not found", "Error fetching user")
+	}
+	return toUserPB(user), nil
+}
+
+func (s *grpcUsers) CreateUser(ctx context.Context, req *identitypb.CreateUserRequest) (*identitypb.User, error) {
+	db := grpcTenant(ctx, s.db)
+	user := User{Name: req.Name, Email: req.Email}
+	if err := validateUserAttributes(db, &user); err != nil {
+		return nil, grpcAttributeError(err)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := enqueueEvent(tx, "user.created", "user", user.ID, user); err != nil {
+			return err
+		}
+		return applyMembershipRules(tx, user)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error creating user")
+	}
+	recordGRPCAudit(db, ctx, "user.create", "user", user.ID, nil, user)
+	return toUserPB(user), nil
+}
+
+func (s *grpcUsers) UpdateUser(ctx context.Context, req *identitypb.UpdateUserRequest) (*identitypb.User, error) {
+	db := grpcTenant(ctx, s.db)
+	var user User
+	if err := db.Where("id = ?", req.Id).First(&user).Error; err != nil {
+		return nil, grpcError(err, "User not found", "Error fetching user")
+	}
+	before := user
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Email != nil {
+		user.Email = *req.Email
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if err := enqueueEvent(tx, "user.updated", "user", user.ID, user); err != nil {
+			return err
+		}
+		return applyMembershipRules(tx, user)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error updating user")
+	}
+	recordGRPCAudit(db, ctx, "user.update", "user", user.ID, before, user)
+	return toUserPB(user), nil
+}
+
+func (s *grpcUsers) DeleteUser(ctx context.Context, req *identitypb.GetRequest) (*emptypb.Empty, error) {
+	db := grpcTenant(ctx, s.db)
+	var user User
+	if err := db.Where("id = ?", req.Id).First(&user).Error; err != nil {
+		return nil, grpcError(err, "User not found", "Error fetching user")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return softDeleteUser(tx, user)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error deleting user")
+	}
+	recordGRPCAudit(db, ctx, "user.delete", "user", user.ID, user, nil)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcUsers) ListUserRoles(req *identitypb.GetRequest, stream identitypb.Users_ListUserRolesServer) error {
+	db := grpcTenant(stream.Context(), s.db)
+	var role Role
+	query := whereActiveGrant(db.Model(&Role{}).Select("roles.*").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", req.Id), "user_roles").Order("roles.id")
+	return streamRows(db, query, nil, &role, func() error {
+		return stream.Send(toRolePB(role))
+	})
+}
+
+func (s *grpcUsers) ListUserGroups(req *identitypb.GetRequest, stream identitypb.Users_ListUserGroupsServer) error {
+	db := grpcTenant(stream.Context(), s.db)
+	var group Group
+	query := whereActiveGrant(db.Model(&Group{}).Select("groups.*").
+		Joins("JOIN user_groups ON user_groups.group_id = groups.id").
+		Where("user_groups.user_id = ?", req.Id), "user_groups").Order("groups.id")
+	return streamRows(db, query, nil, &group, func() error {
+		return stream.Send(toGroupPB(group))
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Service Roles
+
+type grpcRoles struct {
+	identitypb.UnimplementedRolesServer
+	db *gorm.DB
+}
+
+func (s *grpcRoles) ListRoles(req *identitypb.ListRequest, stream identitypb.Roles_ListRolesServer) error {
+	db := grpcTenant(stream.Context(), s.db)
+	var role Role
+	return streamRows(db, db.Model(&Role{}).Order("id"), req, &role, func() error {
+		return stream.Send(toRolePB(role))
+	})
+}
+
+func (s *grpcRoles) GetRole(ctx context.Context, req *identitypb.GetRequest) (*identitypb.Role, error) {
+	db := grpcTenant(ctx, s.db)
+	var role Role
+	if err := db.Where("id = ?", req.Id).First(&role).Error; err != nil {
+		return nil, grpcError(err, "Role not found", "Error fetching role")
+	}
+	return toRolePB(role), nil
+}
+
+func (s *grpcRoles) CreateRole(ctx context.Context, req *identitypb.CreateRoleRequest) (*identitypb.Role, error) {
+	db := grpcTenant(ctx, s.db)
+	role := Role{Name: req.Name, Description: req.Description}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "role.created", "role", role.ID, role)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error creating role")
+	}
+	recordGRPCAudit(db, ctx, "role.create", "role", role.ID, nil, role)
+	return toRolePB(role), nil
+}
+
+func (s *grpcRoles) UpdateRole(ctx context.Context, req *identitypb.UpdateRoleRequest) (*identitypb.Role, error) {
+	db := grpcTenant(ctx, s.db)
+	var role Role
+	if err := db.Where("id = ?", req.Id).First(&role).Error; err != nil {
+		return nil, grpcError(err, "Role not found", "Error fetching role")
+	}
+	before := role
+	if req.Name != nil {
+		role.Name = *req.Name
+	}
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&role).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "role.updated", "role", role.ID, role)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error updating role")
+	}
+	recordGRPCAudit(db, ctx, "role.update", "role", role.ID, before, role)
+	return toRolePB(role), nil
+}
+
+func (s *grpcRoles) DeleteRole(ctx context.Context, req *identitypb.GetRequest) (*emptypb.Empty, error) {
+	db := grpcTenant(ctx, s.db)
+	var role Role
+	if err := db.Where("id = ?", req.Id).First(&role).Error; err != nil {
+		return nil, grpcError(err, "Role not found", "Error fetching role")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&role).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "role.deleted", "role", role.ID, role)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error deleting role")
+	}
+	recordGRPCAudit(db, ctx, "role.delete", "role", role.ID, role, nil)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcRoles) ListRoleUsers(req *identitypb.GetRequest, stream identitypb.Roles_ListRoleUsersServer) error {
+	db := grpcTenant(stream.Context(), s.db)
+	var user User
+	query := whereActiveGrant(db.Model(&User{}).Select("users.*").
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Where("user_roles.role_id = ?", req.Id), "user_roles").Order("users.id")
+	return streamRows(db, query, nil, &user, func() error {
+		return stream.Send(toUserPB(user))
+	})
+}
+
+func (s *grpcRoles) AssignRole(ctx context.Context, req *identitypb.RoleAssignment) (*emptypb.Empty, error) {
+	options, err := grpcGrantOptions(ctx, req.ValidFrom, req.ValidUntil, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return s.changeAssignment(ctx, req, "role.assign", options, func(tx *gorm.DB, userID, roleID uint) error {
+		return roleGrants.grant(tx, userID, roleID, options)
+	})
+}
+
+func (s *grpcRoles) RevokeRole(ctx context.Context, req *identitypb.RoleAssignment) (*emptypb.Empty, error) {
+	return s.changeAssignment(ctx, req, "role.revoke", grantOptions{}, roleGrants.revoke)
+}
+
+func (s *grpcRoles) changeAssignment(ctx context.Context, req *identitypb.RoleAssignment, action string, options grantOptions, change func(tx *gorm.DB, userID, roleID uint) error) (*emptypb.Empty, error) {
+	db := grpcTenant(ctx, s.db)
+	var user User
+	if err := db.Where("id = ?", req.UserId).First(&user).Error; err != nil {
+		return nil, grpcError(err, "User not found", "Error fetching user")
+	}
+	var role Role
+	if err := db.Where("id = ?", req.RoleId).First(&role).Error; err != nil {
+		return nil, grpcError(err, "Role not found", "Error fetching role")
+	}
+	// comme PUT /users/:id/roles/:role_id: update sur l'utilisateur ne suffit pas, il faut assign sur le rôle
+	method, _ := grpc.Method(ctx)
+	if err := grpcCheck(ctx, db, method, req, "roles", role.ID, "assign"); err != nil {
+		return nil, err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := change(tx, user.ID, role.ID); err != nil {
+			return err
+		}
+		return enqueueUserRolesEvent(tx, user.ID)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error updating role assignment")
+	}
+	recordGRPCAudit(db, ctx, action, "user", user.ID, nil, grantDetails("role_id", role.ID, options))
+	return &emptypb.Empty{}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Service Groups
+
+type grpcGroups struct {
+	identitypb.UnimplementedGroupsServer
+	db *gorm.DB
+}
+
+func (s *grpcGroups) ListGroups(req *identitypb.ListRequest, stream identitypb.Groups_ListGroupsServer) error {
+	db := grpcTenant(stream.Context(), s.db)
+	var group Group
+	return streamRows(db, db.Model(&Group{}).Order("id"), req, &group, func() error {
+		return stream.Send(toGroupPB(group))
+	})
+}
+
+func (s *grpcGroups) GetGroup(ctx context.Context, req *identitypb.GetRequest) (*identitypb.Group, error) {
+	db := grpcTenant(ctx, s.db)
+	var group Group
+	if err := db.Where("id = ?", req.Id).First(&group).Error; err != nil {
+		return nil, grpcError(err, "Group not found", "Error fetching group")
+	}
+	return toGroupPB(group), nil
+}
+
+func (s *grpcGroups) CreateGroup(ctx context.Context, req *identitypb.CreateGroupRequest) (*identitypb.Group, error) {
+	db := grpcTenant(ctx, s.db)
+	group := Group{Name: req.Name}
+	if req.ParentGroupId != nil {
+		parentID := uint(*req.ParentGroupId)
+		group.ParentGroupID = &parentID
+	}
+	if message := checkGroupParent(db, 0, group.ParentGroupID); message != "" {
+		return nil, status.Error(codes.InvalidArgument, message)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "group.created", "group", group.ID, group)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error creating group")
+	}
+	recordGRPCAudit(db, ctx, "group.create", "group", group.ID, nil, group)
+	return toGroupPB(group), nil
+}
+
+func (s *grpcGroups) UpdateGroup(ctx context.Context, req *identitypb.UpdateGroupRequest) (*identitypb.Group, error) {
+	db := grpcTenant(ctx, s.db)
+	var group Group
+	if err := db.Where("id = ?", req.Id).First(&group).Error; err != nil {
+		return nil, grpcError(err, "Group not found", "Error fetching group")
+	}
+	before := group
+	if req.Name != nil {
+		group.Name = *req.Name
+	}
+	if req.ClearParent {
+		group.ParentGroupID = nil
+	} else if req.ParentGroupId != nil {
+		parentID := uint(*req.ParentGroupId)
+		group.ParentGroupID = &parentID
+	}
+	if message := checkGroupParent(db, group.ID, group.ParentGroupID); message != "" {
+		return nil, status.Error(codes.InvalidArgument, message)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&group).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "group.updated", "group", group.ID, group)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error updating group")
+	}
+	recordGRPCAudit(db, ctx, "group.update", "group", group.ID, before, group)
+	return toGroupPB(group), nil
+}
+
+func (s *grpcGroups) DeleteGroup(ctx context.Context, req *identitypb.GetRequest) (*emptypb.Empty, error) {
+	db := grpcTenant(ctx, s.db)
+	var group Group
+	if err := db.Where("id = ?", req.Id).First(&group).Error; err != nil {
+		return nil, grpcError(err, "Group not found", "Error fetching group")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&group).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "group.deleted", "group", group.ID, group)
+	})
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error deleting group")
+	}
+	recordGRPCAudit(db, ctx, "group.delete", "group", group.ID, group, nil)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *grpcGroups) ListMembers(req *identitypb.GetRequest, stream identitypb.Groups_ListMembersServer) error {
+	db := grpcTenant(stream.Context(), s.db)
+	var user User
+	query := whereActiveGrant(db.Model(&User{}).Select("users.*").
+		Joins("JOIN user_groups ON user_groups.user_id = users.id").
+		Where("user_groups.group_id = ?", req.Id), "user_groups").Order("users.id")
+	return streamRows(db, query, nil, &user, func() error {
+		return stream.Send(toUserPB(user))
+	})
+}
+
+func (s *grpcGroups) AddMember(ctx context.Context, req *identitypb.Membership) (*emptypb.Empty, error) {
+	options, err := grpcGrantOptions(ctx, req.ValidFrom, req.ValidUntil, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return s.changeMembership(ctx, req, "group.member_add", options, func(tx *gorm.DB, userID, groupID uint) error {
+		return groupGrants.grant(tx, userID, groupID, options)
+	})
+}
+
+func (s *grpcGroups) RemoveMember(ctx context.Context, req *identitypb.Membership) (*emptypb.Empty, error) {
+	return s.changeMembership(ctx, req, "group.member_remove", grantOptions{}, groupGrants.revoke)
+}
+
+func (s *grpcGroups) changeMembership(ctx context.Context, req *identitypb.Membership, action string, options grantOptions, change func(tx *gorm.DB, userID, groupID uint) error) (*emptypb.Empty, error) {
+	db := grpcTenant(ctx, s.db)
+	var user User
+	if err := db.Where("id = ?", req.UserId).First(&user).Error; err != nil {
+		return nil, grpcError(err, "User not found", "Error fetching user")
+	}
+	var group Group
+	if err := db.Where("id = ?", req.GroupId).First(&group).Error; err != nil {
+		return nil, grpcError(err, "Group not found", "Error fetching group")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := change(tx, user.ID, group.ID); err != nil {
+			return err
+		}
+		return enqueueMembershipEvent(tx, group.ID)
+	})
+	if errors.Is(err, errRuleDerived) {
+		return nil, status.Error(codes.FailedPrecondition, "Membership comes from the group's membership rule")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Error updating membership")
+	}
+	recordGRPCAudit(db, ctx, action, "group", group.ID, nil, grantDetails("user_id", user.ID, options))
+	return &emptypb.Empty{}, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Service Auth
+
+type grpcAuth struct {
+	identitypb.UnimplementedAuthServer
+	db *gorm.DB
+}
+
+// Login se comporte comme POST /login, sans cookie
+func (s *grpcAuth) Login(ctx context.Context, req *identitypb.LoginRequest) (*identitypb.LoginResponse, error) {
+	var user User
+	s.db.First(&user, "email = ?", req.Email)
+
+	if user.ID == 0 {
+		event := grpcAuditEvent(ctx, "login.failure", "user", "", nil, nil)
+		event.Actor = req.Email
+		saveAudit(s.db, event)
+		return nil, status.Error(codes.Unauthenticated, "Email ou mot de passe invalide")
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		event := grpcAuditEvent(ctx, "login.failure", "user", user.ID, nil, nil)
+		event.ActorID, event.Actor = &user.ID, user.Email
+		saveAudit(s.db, event)
+		return nil, status.Error(codes.Unauthenticated, "Email ou mot de passe invalide")
+	}
+
+	if err := checkActive(user); err != nil {
+		event := grpcAuditEvent(ctx, "login.failure", "user", user.ID, nil, map[string]string{"reason": err.Error()})
+		event.ActorID, event.Actor = &user.ID, user.Email
+		saveAudit(s.db, event)
+		return nil, status.Error(codes.PermissionDenied, "Account is "+user.currentStatus())
+	}
+
+	ip, userAgent := "", ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip, _, _ = net.SplitHostPort(p.Addr.String())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user-agent"); len(values) > 0 {
+		userAgent = values[0]
+	}
+	tokenString, session, err := startSession(s.db, user, req.Device, ip, userAgent)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "Failed to create token")
+	}
+
+	event := grpcAuditEvent(ctx, "login.success", "user", user.ID, nil, nil)
+	event.ActorID, event.Actor = &user.ID, user.Email
+	saveAudit(s.db, event)
+	return &identitypb.LoginResponse{Token: tokenString, ExpiresAt: timestamppb.New(session.ExpiresAt)}, nil
+}
+
+func (s *grpcAuth) ValidateToken(ctx context.Context, req *identitypb.ValidateTokenRequest) (*identitypb.ValidateTokenResponse, error) {
+	user, err := userFromToken(req.Token)
+	if err != nil {
+		return &identitypb.ValidateTokenResponse{Valid: false}, nil
+	}
+	return &identitypb.ValidateTokenResponse{Valid: true, User: toUserPB(user)}, nil
+}
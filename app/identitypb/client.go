@@ -0,0 +1,57 @@
+// Package identitypb contient l'API gRPC du binaire app (code généré depuis identity.proto)
+// et un client prêt à l'emploi pour les services Go.
+package identitypb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative identity.proto
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client regroupe les clients des quatre services sur une même connexion
+type Client struct {
+	Users  UsersClient
+	Roles  RolesClient
+	Groups GroupsClient
+	Auth   AuthClient
+
+	conn *grpc.ClientConn
+}
+
+// Dial se connecte à addr (ex: app:9090) sans TLS, sauf si opts en fournit.
+// token est le JWT retourné par login, envoyé à chaque appel; il peut être vide pour appeler Auth.
+func Dial(addr, token string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(token)))
+	}
+	conn, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Users:  NewUsersClient(conn),
+		Roles:  NewRolesClient(conn),
+		Groups: NewGroupsClient(conn),
+		Auth:   NewAuthClient(conn),
+		conn:   conn,
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// bearerToken envoie "authorization: Bearer <token>" dans les métadonnées de chaque appel
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (bearerToken) RequireTransportSecurity() bool {
+	return false
+}
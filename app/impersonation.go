@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jinzhu/gorm"
+)
+
+// Impersonation: un administrateur obtient un token court au nom d'un utilisateur. Le token porte
+// l'utilisateur (userid) et l'administrateur (claim act, RFC 8693); requireAuth expose les deux
+// (c.Get("user") et c.Get("impersonator")) et l'audit enregistre l'administrateur comme acteur.
+
+// actorOf lit le claim act {"sub": "<id>"}; 0 hors impersonation
+func actorOf(claims jwt.MapClaims) uint {
+	act, ok := claims["act"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+	sub, _ := act["sub"].(string)
+	id, _ := strconv.ParseUint(sub, 10, 64)
+	return uint(id)
+}
+
+// impersonatorOf charge l'administrateur d'une session d'impersonation (ok = false sinon), qui doit être actif
+func impersonatorOf(session Session) (User, bool, error) {
+	var impersonator User
+	if session.ImpersonatorID == nil {
+		return impersonator, false, nil
+	}
+	if err := db.First(&impersonator, *session.ImpersonatorID).Error; err != nil {
+		return impersonator, false, err
+	}
+	// un administrateur suspendu ou désactivé perd ses sessions d'impersonation
+	if err := checkActive(impersonator); err != nil {
+		return impersonator, false, err
+	}
+	return impersonator, true, nil
+}
+
+// forbidImpersonation bloque les endpoints sensibles (mots de passe, sessions, politiques...) aux tokens d'impersonation
+func forbidImpersonation(c *gin.Context) {
+	if _, ok := c.Get("impersonator"); ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating"})
+		return
+	}
+	c.Next()
+}
+
+// auditImpersonatedRequest trace chaque requête faite sous impersonation, lectures comprises
+func auditImpersonatedRequest(c *gin.Context) {
+	recordAudit(db, c, "impersonation.request", "request", c.Request.Method+" "+c.Request.URL.Path, nil,
+		gin.H{"status": c.Writer.Status()})
+}
+
+// impersonationTTL est la durée des tokens d'impersonation (IMPERSONATION_TTL, 15 minutes par défaut)
+func impersonationTTL() time.Duration {
+	ttl, err := time.ParseDuration(getenvDefault("IMPERSONATION_TTL", "15m"))
+	if err != nil || ttl <= 0 {
+		return 15 * time.Minute
+	}
+	return ttl
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint impersonation
+
+// impersonateUser émet un token au nom de l'utilisateur :id pour un appelant ayant la permission
+// "impersonate" sur users/:id (Admin: "*:*"); la raison est obligatoire et enregistrée dans l'audit
+func impersonateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		caller := c.MustGet("user").(User)
+		var target User
+		if err := db.Where("id = ?", c.Param("id")).First(&target).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if target.ID == caller.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot impersonate yourself"})
+			return
+		}
+
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid impersonation request"})
+			return
+		}
+		if strings.TrimSpace(body.Reason) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+			return
+		}
+
+		subject, err := loadAuthzSubject(db, caller)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+			return
+		}
+		set, err := policies.active()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading policies"})
+			return
+		}
+		resource := fmt.Sprintf("users/%d", target.ID)
+		attributes, err := resourceAttributes(db, "users", target.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching resource"})
+			return
+		}
+		decision := decide(set, subject, "impersonate", resource, checkInput(subject, attributes, "impersonate", resource, nil))
+		if !decision.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "reason": decision.Reason})
+			return
+		}
+
+		now := time.Now()
+		tokenString, session, err := issueSession(db, target, Session{
+			Device:         "impersonation",
+			IP:             c.ClientIP(),
+			UserAgent:      c.Request.UserAgent(),
+			LastSeenAt:     now,
+			ExpiresAt:      now.Add(impersonationTTL()),
+			ImpersonatorID: &caller.ID,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+			return
+		}
+
+		recordAudit(db, c, "user.impersonate", "user", target.ID, nil, gin.H{
+			"session_id": session.ID,
+			"reason":     body.Reason,
+			"expires_at": session.ExpiresAt,
+		})
+		c.JSON(http.StatusCreated, gin.H{
+			"token":      tokenString,
+			"session_id": session.ID,
+			"expires_at": session.ExpiresAt,
+		})
+	}
+}
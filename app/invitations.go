@@ -0,0 +1,375 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Invitation: un administrateur invite une adresse email avec des rôles et groupes; l'invité choisit
+// son mot de passe en acceptant le lien reçu par email. Seul le hash du token est enregistré.
+type Invitation struct {
+	ID             uint          `gorm:"primary_key" json:"id"`
+	OrganizationID uint          `json:"organization_id"`
+	Email          string        `json:"email"`
+	Name           string        `json:"name"`
+	TokenHash      string        `json:"-"`
+	RoleIDs        pq.Int64Array `gorm:"type:integer[]" json:"role_ids"`
+	GroupIDs       pq.Int64Array `gorm:"type:integer[]" json:"group_ids"`
+	InvitedByID    *uint         `json:"invited_by_id"`
+	UserID         *uint         `json:"user_id"` // utilisateur créé à l'acceptation
+	ExpiresAt      time.Time     `json:"expires_at"`
+	AcceptedAt     *time.Time    `json:"accepted_at"`
+	RevokedAt      *time.Time    `json:"revoked_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+	Status         string        `gorm:"-" json:"status"`
+}
+
+// status donne l'état de l'invitation: pending, accepted, revoked ou expired
+func (i Invitation) status() string {
+	switch {
+	case i.AcceptedAt != nil:
+		return "accepted"
+	case i.RevokedAt != nil:
+		return "revoked"
+	case time.Now().After(i.ExpiresAt):
+		return "expired"
+	}
+	return "pending"
+}
+
+var errInvitationUsed = errors.New("invitation already used")
+
+// invitationTTL est la validité par défaut d'une invitation (INVITATION_TTL, 7 jours par défaut)
+func invitationTTL() time.Duration {
+	ttl, err := time.ParseDuration(getenvDefault("INVITATION_TTL", "168h"))
+	if err != nil || ttl <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return ttl
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// invitationMail construit l'email d'invitation; INVITATION_URL est le lien envoyé, {token} y est remplacé
+func invitationMail(invitation Invitation, token string) Mail {
+	link := strings.Replace(getenvDefault("INVITATION_URL", "http://localhost:8080/invitations/{token}/accept"), "{token}", token, 1)
+	return Mail{
+		To:      invitation.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("Hello %s,\n\nYou have been invited to create an account. Choose your password here:\n\n%s\n\n"+
+			"Or from the CLI: cli invitations accept %s --password <password>\n\nThis invitation expires on %s.\n",
+			invitation.Name, link, token, invitation.ExpiresAt.Format(time.RFC1123)),
+	}
+}
+
+// countExisting vérifie que tous les IDs existent dans la table de model (organisation de db)
+func countExisting(db *gorm.DB, model interface{}, ids []int64) (bool, error) {
+	if len(ids) == 0 {
+		return true, nil
+	}
+	unique := map[int64]bool{}
+	for _, id := range ids {
+		unique[id] = true
+	}
+	var count int
+	err := db.Model(model).Where("id IN (?)", ids).Count(&count).Error
+	return count == len(unique), err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint invitations
+
+// getInvitationsList retourne les invitations en attente
+func getInvitationsList(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		invitations := []Invitation{}
+		err := db.Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now()).
+			Order("id").Find(&invitations).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching invitations"})
+			return
+		}
+		for i := range invitations {
+			invitations[i].Status = invitations[i].status()
+		}
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+// authorizeInvitationGrants vérifie que l'appelant peut donner chaque rôle (assign sur roles/:id) et chaque groupe
+// (manage_members sur groups/:id, comme PUT /groups/:id/members) de l'invitation; retourne le premier refus
+func authorizeInvitationGrants(db *gorm.DB, caller User, invitation Invitation, request map[string]interface{}) (authzDecision, error) {
+	checks := []struct {
+		resourceType, action string
+		ids                  []int64
+	}{{"roles", "assign", invitation.RoleIDs}, {"groups", "manage_members", invitation.GroupIDs}}
+	decision := authzDecision{UserID: caller.ID, Allowed: true}
+	for _, check := range checks {
+		for _, id := range check.ids {
+			var err error
+			decision, err = authorize(db, caller, check.resourceType, uint(id), check.action, request)
+			if err != nil || !decision.Allowed {
+				return decision, err
+			}
+		}
+	}
+	return decision, nil
+}
+
+// createInvitation enregistre une invitation et l'envoie par email (mailer), après le commit; si l'envoi échoue
+// l'invitation est supprimée
+func createInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		request := requestAttributes(c)
+		var body struct {
+			Email     string     `json:"email"`
+			Name      string     `json:"name"`
+			Roles     []int64    `json:"roles"`
+			Groups    []int64    `json:"groups"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+		if err := c.BindJSON(&body); err != nil || strings.TrimSpace(body.Email) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email is required"})
+			return
+		}
+		invitation := Invitation{
+			Email:     strings.TrimSpace(body.Email),
+			Name:      strings.TrimSpace(body.Name),
+			RoleIDs:   body.Roles,
+			GroupIDs:  body.Groups,
+			ExpiresAt: time.Now().Add(invitationTTL()),
+		}
+		if invitation.Name == "" {
+			invitation.Name = invitation.Email
+		}
+		if body.ExpiresAt != nil {
+			if !body.ExpiresAt.After(time.Now()) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+				return
+			}
+			invitation.ExpiresAt = *body.ExpiresAt
+		}
+
+		// les emails sont uniques sur tout le déploiement: la vérification n'est pas limitée à l'organisation
+		var taken int
+		if err := db.Model(&User{}).Unscoped().Where("email = ?", invitation.Email).Count(&taken).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invitation"})
+			return
+		}
+		if taken > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+			return
+		}
+
+		db := tenantDB(c, db)
+		if ok, err := countExisting(db, &Role{}, invitation.RoleIDs); err != nil || !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+		if ok, err := countExisting(db, &Group{}, invitation.GroupIDs); err != nil || !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown group"})
+			return
+		}
+		caller := c.MustGet("user").(User)
+		decision, err := authorizeInvitationGrants(db, caller, invitation, request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
+			return
+		}
+		if !decision.Allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden", "reason": decision.Reason})
+			return
+		}
+		var pending int
+		err = db.Model(&Invitation{}).
+			Where("email = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", invitation.Email, time.Now()).
+			Count(&pending).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invitation"})
+			return
+		}
+		if pending > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A pending invitation already exists for this email"})
+			return
+		}
+
+		buf := make([]byte, 32)
+		rand.Read(buf)
+		token := hex.EncodeToString(buf)
+		invitation.TokenHash = hashInvitationToken(token)
+		invitation.InvitedByID = &caller.ID
+
+		if err := db.Create(&invitation).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invitation"})
+			return
+		}
+		// le mail part une fois l'invitation enregistrée: un lien envoyé désigne toujours une invitation existante
+		if err := mailer.Send(invitationMail(invitation, token)); err != nil {
+			db.Delete(&invitation)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Error sending invitation"})
+			return
+		}
+		invitation.Status = invitation.status()
+		recordAudit(db, c, "invitation.create", "invitation", invitation.ID, nil, invitation)
+		c.JSON(http.StatusCreated, invitation)
+	}
+}
+
+// revokeInvitation annule une invitation en attente: son lien ne peut plus être accepté
+func revokeInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var invitation Invitation
+		if err := db.Where("id = ?", c.Param("id")).First(&invitation).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		if status := invitation.status(); status != "pending" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Invitation is " + status})
+			return
+		}
+		before := invitation
+		now := time.Now()
+		invitation.RevokedAt = &now
+		if err := db.Model(&invitation).UpdateColumn("revoked_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking invitation"})
+			return
+		}
+		invitation.Status = invitation.status()
+		recordAudit(db, c, "invitation.revoke", "invitation", invitation.ID, before, invitation)
+		c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+	}
+}
+
+// acceptInvitation crée le compte de l'invité avec le mot de passe choisi et les rôles et groupes de
+// l'invitation (sans authentification: le token du lien fait foi); 410 si l'invitation a expiré, été révoquée ou déjà acceptée
+func acceptInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var invitation Invitation
+		if err := db.Where("token_hash = ?", hashInvitationToken(c.Param("token"))).First(&invitation).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+			return
+		}
+		if status := invitation.status(); status != "pending" {
+			c.JSON(http.StatusGone, gin.H{"error": "Invitation is " + status})
+			return
+		}
+
+		var body struct {
+			Name     string `json:"name"`
+			Password string `json:"password"`
+		}
+		if err := c.BindJSON(&body); err != nil || body.Password == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+			return
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), 10)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+			return
+		}
+		var taken int
+		if err := db.Model(&User{}).Unscoped().Where("email = ?", invitation.Email).Count(&taken).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error accepting invitation"})
+			return
+		}
+		if taken > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "A user with this email already exists"})
+			return
+		}
+		user := User{Name: invitation.Name, Email: invitation.Email, Password: string(hash)}
+		if name := strings.TrimSpace(body.Name); name != "" {
+			user.Name = name
+		}
+		if err := validateUserAttributes(scopeTenant(db, invitation.OrganizationID), &user); err != nil {
+			respondAttributeError(c, err)
+			return
+		}
+
+		db := scopeTenant(db, invitation.OrganizationID)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// l'invitation n'est utilisable qu'une fois, même avec deux acceptations simultanées
+			now := time.Now()
+			used := tx.Model(&invitation).Where("accepted_at IS NULL AND revoked_at IS NULL").UpdateColumn("accepted_at", now)
+			if used.Error != nil {
+				return used.Error
+			}
+			if used.RowsAffected != 1 {
+				return errInvitationUsed
+			}
+
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&invitation).UpdateColumn("user_id", user.ID).Error; err != nil {
+				return err
+			}
+			// rôles et groupes encore existants au moment de l'acceptation
+			var roleIDs, groupIDs []uint
+			if len(invitation.RoleIDs) > 0 {
+				if err := tx.Model(&Role{}).Where("id IN (?)", []int64(invitation.RoleIDs)).Pluck("id", &roleIDs).Error; err != nil {
+					return err
+				}
+			}
+			if len(invitation.GroupIDs) > 0 {
+				if err := tx.Model(&Group{}).Where("id IN (?)", []int64(invitation.GroupIDs)).Pluck("id", &groupIDs).Error; err != nil {
+					return err
+				}
+			}
+			options := grantOptions{Reason: "invitation", GrantedByID: invitation.InvitedByID}
+			for _, roleID := range roleIDs {
+				if err := roleGrants.grant(tx, user.ID, roleID, options); err != nil {
+					return err
+				}
+			}
+			for _, groupID := range groupIDs {
+				if err := groupGrants.grant(tx, user.ID, groupID, options); err != nil {
+					return err
+				}
+			}
+
+			if err := enqueueEvent(tx, "user.created", "user", user.ID, user); err != nil {
+				return err
+			}
+			if len(roleIDs) > 0 {
+				if err := enqueueUserRolesEvent(tx, user.ID); err != nil {
+					return err
+				}
+			}
+			for _, groupID := range groupIDs {
+				if err := enqueueMembershipEvent(tx, groupID); err != nil {
+					return err
+				}
+			}
+			return applyMembershipRules(tx, user)
+		})
+		if err == errInvitationUsed {
+			c.JSON(http.StatusGone, gin.H{"error": "Invitation already used"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error accepting invitation"})
+			return
+		}
+
+		c.Set("actor", invitation.Email)
+		recordAudit(db, c, "invitation.accept", "invitation", invitation.ID, nil, gin.H{"user_id": user.ID})
+		c.JSON(http.StatusCreated, user)
+	}
+}
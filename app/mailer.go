@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Mail est un email texte envoyé par l'API (invitations...)
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer envoie les emails de l'API
+type Mailer interface {
+	Send(mail Mail) error
+}
+
+var mailer Mailer = logMailer{}
+
+// newMailer choisit l'implémentation selon MAILER_DRIVER (log par défaut, ou smtp)
+func newMailer() Mailer {
+	if getenvDefault("MAILER_DRIVER", "log") == "smtp" {
+		return smtpMailer{
+			addr:     getenvDefault("SMTP_HOST", "localhost") + ":" + getenvDefault("SMTP_PORT", "25"),
+			host:     getenvDefault("SMTP_HOST", "localhost"),
+			username: getenvDefault("SMTP_USERNAME", ""),
+			password: getenvDefault("SMTP_PASSWORD", ""),
+			from:     getenvDefault("MAIL_FROM", "no-reply@localhost"),
+		}
+	}
+	return logMailer{}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// logMailer écrit les emails dans les logs du serveur (développement)
+type logMailer struct{}
+
+func (logMailer) Send(mail Mail) error {
+	log.Printf("mailer: to=%s subject=%q\n%s", mail.To, mail.Subject, mail.Body)
+	return nil
+}
+
+// smtpMailer envoie les emails par SMTP (authentification PLAIN si SMTP_USERNAME est défini)
+type smtpMailer struct {
+	addr, host         string
+	username, password string
+	from               string
+}
+
+func (m smtpMailer) Send(mail Mail) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+	if strings.ContainsAny(mail.To+mail.Subject, "\r\n") {
+		return fmt.Errorf("mailer: invalid header")
+	}
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		m.from, mail.To, mail.Subject, mail.Body)
+	return smtp.SendMail(m.addr, auth, m.from, []string{mail.To}, []byte(message))
+}
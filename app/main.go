@@ -1,9 +1,12 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,20 +14,29 @@ import (
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/joho/godotenv"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	ID         uint        `gorm:"primary_key" json:"id"`
-	Name       string      `json:"name"`
-	Email      string      `gorm:"unique" json:"email"`
-	Password   string      `json:"-"`
-	Roles      []Role      `gorm:"many2many:user_roles;" json:"roles"`
-	Groups     []Group     `gorm:"many2many:user_groups;" json:"groups"`
-	CreatedAt  time.Time   `json:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at"`
-	DeletedAt  *time.Time  `json:"deleted_at"`
-	AuthTokens []AuthToken `json:"auth_tokens"`
+	ID               uint        `gorm:"primary_key" json:"id"`
+	OrganizationID   uint        `json:"organization_id"`
+	CrossTenantAdmin bool        `json:"cross_tenant_admin"` // accordé par PUT /orgs/admins/:user_id uniquement
+	Name             string      `json:"name"`
+	Email            string      `gorm:"unique" json:"email"`
+	Password         string      `json:"-"`
+	Status           string      `gorm:"default:'active'" json:"status"` // voir status.go
+	StatusReason     string      `json:"status_reason"`
+	StatusChangedAt  *time.Time  `json:"status_changed_at"`
+	DeactivateAt     *time.Time  `json:"deactivate_at"`                             // désactivation programmée (statut expired à la date)
+	Attributes       JSONB       `gorm:"type:jsonb;default:'{}'" json:"attributes"` // attributs personnalisés (voir attributes.go)
+	ManagerID        *uint       `json:"manager_id"`                                // manager direct (voir managers.go)
+	Roles            []Role      `gorm:"many2many:user_roles;" json:"roles"`
+	Groups           []Group     `gorm:"many2many:user_groups;" json:"groups"`
+	CreatedAt        time.Time   `json:"created_at"`
+	UpdatedAt        time.Time   `json:"updated_at"`
+	DeletedAt        *time.Time  `json:"deleted_at"`
+	AuthTokens       []AuthToken `json:"auth_tokens"`
 }
 
 type AuthToken struct {
@@ -41,23 +53,30 @@ type RefreshToken struct {
 	UserID    uint      `json:"-"`
 }
 
+// Permissions: "action:ressource", ex: "read:users", "update:groups/*", "*:*" (voir authz.go)
 type Role struct {
-	ID          uint       `gorm:"primary_key" json:"id"`
-	Name        string     `json:"name"`
-	Description string     `json:"description"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	DeletedAt   *time.Time `json:"deleted_at"`
+	ID             uint           `gorm:"primary_key" json:"id"`
+	OrganizationID uint           `json:"organization_id"`
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Permissions    pq.StringArray `gorm:"type:text[]" json:"permissions"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      *time.Time     `json:"deleted_at"`
 }
 
+// Les rôles d'un groupe sont accordés à ses membres et aux membres de ses sous-groupes
 type Group struct {
-	ID            uint       `gorm:"primary_key" json:"id"`
-	Name          string     `json:"name"`
-	ParentGroupID *uint      `json:"parent_group_id"`
-	ChildGroupIDs []uint     `gorm:"-" json:"child_group_ids"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at"`
-	DeletedAt     *time.Time `json:"deleted_at"`
+	ID             uint       `gorm:"primary_key" json:"id"`
+	OrganizationID uint       `json:"organization_id"`
+	Name           string     `json:"name"`
+	ParentGroupID  *uint      `json:"parent_group_id"`
+	MembershipRule string     `json:"membership_rule"` // expression CEL des groupes dynamiques (voir dynamic_groups.go)
+	ChildGroupIDs  []uint     `gorm:"-" json:"child_group_ids"`
+	Roles          []Role     `gorm:"many2many:group_roles;" json:"roles,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at"`
 }
 
 var db *gorm.DB
@@ -87,24 +106,129 @@ func main() {
 	}
 	defer db.Close()
 
+	// Chaque requête sur User, Role, Group et Session est limitée à l'organisation de la requête (voir tenant.go)
+	registerTenantCallbacks(db)
+
+	// Bus entre réplicas (PUBSUB_DRIVER), aussi utilisé par les sous-commandes pour prévenir les serveurs
+	bus = newPubSub(db, connStr)
+
+	// Envoi des emails (MAILER_DRIVER)
+	mailer = newMailer()
+
+	// Sous-commandes (app sync run ...)
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Politiques d'accès (table policies et POLICY_FILE), rechargées à chaque modification
+	policies = newPolicyEngine(db)
+	go policies.watch()
+	go watchGroupRules()
+
 	// Set up Gin router
 	router := gin.Default()
+	router.Use(requestID)
 
 	// user endpoints
 	users := router.Group("/users")
 	{
-		users.Use(requireAuth)
+		users.Use(requireAuth, enforcePolicies(db, "users"))
 		users.GET("/", getUsersList(db))
 		users.GET("/:id", getUser(db))
 		users.POST("/", createUser(db))
 		users.PUT("/:id", updateUser(db))
 		users.DELETE("/:id", deleteUser(db))
+		users.GET("/:id/sessions", getUserSessions(db))
+		users.POST("/:id/impersonate", forbidImpersonation, impersonateUser(db))
+		users.POST("/:id/suspend", suspendUser(db))
+		users.POST("/:id/deactivate", deactivateUser(db))
+		users.POST("/:id/reactivate", reactivateUser(db))
+		users.GET("/:id/grants", getUserGrants(db))
+		users.GET("/:id/reports", getDirectReports(db))
+		users.GET("/:id/managers", getManagerChain(db))
+		users.GET("/:id/org-chart", exportOrgChart(db))
+		users.PUT("/:id/roles/:target_id", grantToUser(db, roleGrants, userGrantParams))
+		users.DELETE("/:id/roles/:target_id", revokeFromUser(db, roleGrants, userGrantParams))
+		users.PUT("/:id/groups/:target_id", grantToUser(db, groupGrants, userGrantParams))
+		users.DELETE("/:id/groups/:target_id", revokeFromUser(db, groupGrants, userGrantParams))
+	}
+
+	// Self-service endpoints for the authenticated user
+	me := router.Group("/me")
+	{
+		me.Use(requireAuth)
+		me.GET("", getMe(db))
+		me.PATCH("", forbidImpersonation, updateMe(db))
+		me.POST("/password", forbidImpersonation, changeMyPassword(db))
+		me.GET("/sessions", getMySessions(db))
+		me.DELETE("/sessions/:id", forbidImpersonation, revokeMySession(db))
+	}
+
+	// Invitation endpoints (l'acceptation se fait sans token, avec le lien reçu par email)
+	invitations := router.Group("/invitations")
+	{
+		invitations.GET("/", requireAuth, enforcePolicies(db, "invitations"), getInvitationsList(db))
+		invitations.POST("/", requireAuth, enforcePolicies(db, "invitations"), createInvitation(db))
+		invitations.DELETE("/:id", requireAuth, enforcePolicies(db, "invitations"), revokeInvitation(db))
+		invitations.POST("/:token/accept", acceptInvitation(db))
+	}
+
+	// Confirmation d'un changement d'email fait par PATCH /me (sans token, avec le lien reçu par email)
+	router.POST("/email-changes/:token/confirm", confirmEmailChange(db))
+
+	// Access request endpoints (libre-service: chaque utilisateur demande pour lui-même, les approbateurs décident)
+	access := router.Group("/access-requests")
+	{
+		access.Use(requireAuth)
+		access.GET("/", getAccessRequestsList(db))
+		access.POST("/", forbidImpersonation, createAccessRequest(db))
+		access.POST("/:id/approve", forbidImpersonation, approveAccessRequest(db))
+		access.POST("/:id/deny", forbidImpersonation, denyAccessRequest(db))
+		access.DELETE("/:id", forbidImpersonation, cancelAccessRequest(db))
+	}
+
+	// Access review endpoints (campagnes gérées par les administrateurs, décisions par les relecteurs)
+	reviews := router.Group("/access-reviews")
+	{
+		reviews.Use(requireAuth)
+		reviews.GET("/", enforcePolicies(db, "access_reviews"), getAccessReviewsList(db))
+		reviews.POST("/", enforcePolicies(db, "access_reviews"), createAccessReview(db))
+		reviews.GET("/assigned", getAssignedAccessReviews(db))
+		reviews.GET("/:id", enforcePolicies(db, "access_reviews"), getAccessReview(db))
+		reviews.POST("/:id/close", enforcePolicies(db, "access_reviews"), forbidImpersonation, closeAccessReview(db))
+		reviews.GET("/:id/report", enforcePolicies(db, "access_reviews"), exportAccessReview(db))
+		reviews.GET("/:id/items", getAccessReviewItems(db))
+		reviews.POST("/:id/items/:item_id", forbidImpersonation, decideAccessReviewItem(db))
+	}
+
+	// Organization endpoints (administrateurs multi-organisations)
+	orgs := router.Group("/orgs")
+	{
+		orgs.Use(requireAuth, forbidImpersonation, requireCrossTenantAdmin)
+		orgs.GET("/", getOrganizationsList(db))
+		orgs.GET("/:id", getOrganization(db))
+		orgs.POST("/", createOrganization(db))
+		orgs.PUT("/:id", updateOrganization(db))
+		orgs.DELETE("/:id", deleteOrganization(db))
+		orgs.PUT("/admins/:user_id", setCrossTenantAdmin(db, true))
+		orgs.DELETE("/admins/:user_id", setCrossTenantAdmin(db, false))
+	}
+
+	// Session endpoints
+	sessions := router.Group("/sessions")
+	{
+		sessions.Use(requireAuth, forbidImpersonation, enforcePolicies(db, "sessions"))
+		sessions.DELETE("/:id", revokeSession(db))
 	}
 
 	// Role endpoints
 	roles := router.Group("/roles")
 	{
-		roles.Use(requireAuth)
+		roles.Use(requireAuth, enforcePolicies(db, "roles"))
 		roles.GET("/", getRolesList(db))
 		roles.GET("/:id", getRole(db))
 		roles.POST("/", createRole(db))
@@ -112,21 +236,138 @@ func main() {
 		roles.DELETE("/:id", deleteRole(db))
 	}
 
+	// Attribute definition endpoints (attributs personnalisés des utilisateurs)
+	attributes := router.Group("/attributes")
+	{
+		attributes.Use(requireAuth, enforcePolicies(db, "attributes"))
+		attributes.GET("/", getAttributeDefinitions(db))
+		attributes.POST("/", createAttributeDefinition(db))
+		attributes.PUT("/:id", updateAttributeDefinition(db))
+		attributes.DELETE("/:id", deleteAttributeDefinition(db))
+	}
+
 	// Group endpoints
 	groups := router.Group("/groups")
 	{
 		groups.Use(requireAuth)
-		groups.GET("/", getGroupsList(db))
-		groups.GET("/:id", getGroup(db))
-		groups.POST("/", createGroup(db))
-		groups.PUT("/:id", updateGroup(db))
-		groups.DELETE("/:id", deleteGroup(db))
+		groups.GET("/", enforcePolicies(db, "groups"), getGroupsList(db))
+		groups.GET("/:id", enforcePolicies(db, "groups"), getGroup(db))
+		groups.POST("/", enforcePolicies(db, "groups"), createGroup(db))
+		groups.PUT("/:id", enforcePolicies(db, "groups"), updateGroup(db))
+		groups.DELETE("/:id", enforcePolicies(db, "groups"), deleteGroup(db))
+		groups.POST("/rule-preview", enforcePoliciesFor(db, "groups", "read"), previewMembershipRule(db))
+
+		// administration déléguée: les propriétaires du groupe (ou d'un ancêtre) passent par decide
+		groups.GET("/:id/members", enforcePoliciesFor(db, "groups", "read"), getGroupMembers(db))
+		groups.PUT("/:id/members/:user_id", enforcePoliciesFor(db, "groups", "manage_members"), forbidImpersonation, grantToUser(db, groupGrants, memberGrantParams))
+		groups.DELETE("/:id/members/:user_id", enforcePoliciesFor(db, "groups", "manage_members"), forbidImpersonation, revokeFromUser(db, groupGrants, memberGrantParams))
+		groups.POST("/:id/subgroups", enforcePoliciesFor(db, "groups", "create_subgroup"), forbidImpersonation, createSubgroup(db))
+		groups.GET("/:id/owners", enforcePoliciesFor(db, "groups", "read"), getGroupOwners(db))
+		groups.PUT("/:id/owners/:user_id", enforcePoliciesFor(db, "groups", "manage_owners"), forbidImpersonation, setGroupOwner(db, true))
+		groups.DELETE("/:id/owners/:user_id", enforcePoliciesFor(db, "groups", "manage_owners"), forbidImpersonation, setGroupOwner(db, false))
+	}
+
+	// SCIM 2.0 provisioning endpoints
+	scim := router.Group("/scim/v2")
+	{
+		scim.Use(requireSCIMToken)
+		scim.GET("/ServiceProviderConfig", getSCIMServiceProviderConfig)
+		scim.GET("/Schemas", getSCIMSchemas)
+		scim.GET("/Schemas/:id", getSCIMSchemas)
+		scim.GET("/ResourceTypes", getSCIMResourceTypes)
+		scim.GET("/ResourceTypes/:id", getSCIMResourceTypes)
+
+		scim.GET("/Users", getSCIMUsers(db))
+		scim.GET("/Users/:id", getSCIMUser(db))
+		scim.POST("/Users", createSCIMUser(db))
+		scim.PUT("/Users/:id", replaceSCIMUser(db))
+		scim.PATCH("/Users/:id", patchSCIMUser(db))
+		scim.DELETE("/Users/:id", deleteSCIMUser(db))
+
+		scim.GET("/Groups", getSCIMGroups(db))
+		scim.GET("/Groups/:id", getSCIMGroup(db))
+		scim.POST("/Groups", createSCIMGroup(db))
+		scim.PUT("/Groups/:id", replaceSCIMGroup(db))
+		scim.PATCH("/Groups/:id", patchSCIMGroup(db))
+		scim.DELETE("/Groups/:id", deleteSCIMGroup(db))
+	}
+
+	// GraphQL endpoint
+	router.POST("/graphql", requireAuth, serveGraphQL(db))
+
+	// Webhook endpoints
+	webhooks := router.Group("/webhooks")
+	{
+		webhooks.Use(requireAuth, forbidImpersonation, requireCrossTenantAdmin, enforcePolicies(db, "webhooks"))
+		webhooks.GET("/", getWebhooksList(db))
+		webhooks.GET("/:id", getWebhook(db))
+		webhooks.POST("/", createWebhook(db))
+		webhooks.PUT("/:id", updateWebhook(db))
+		webhooks.DELETE("/:id", deleteWebhook(db))
+		webhooks.GET("/:id/deliveries", getWebhookDeliveries(db))
+		webhooks.POST("/:id/replay", replayWebhookDeliveries(db))
+		webhooks.POST("/:id/deliveries/:delivery_id/replay", replayWebhookDeliveries(db))
+	}
+
+	// Change stream (Server-Sent Events)
+	events := router.Group("/events")
+	{
+		events.Use(requireAuth, requireCrossTenantAdmin)
+		events.GET("/stream", streamEvents(db))
+	}
+
+	// Audit endpoints
+	audit := router.Group("/audit")
+	{
+		audit.Use(requireAuth, forbidImpersonation, requireCrossTenantAdmin, enforcePolicies(db, "audit"))
+		audit.GET("", getAuditEvents(db))
+		audit.GET("/verify", verifyAudit(db))
+		audit.GET("/export", exportAudit(db))
+	}
+
+	// Policy endpoints
+	policyRoutes := router.Group("/policies")
+	{
+		policyRoutes.Use(requireAuth, forbidImpersonation, requireCrossTenantAdmin, enforcePolicies(db, "policies"))
+		policyRoutes.GET("/", getPoliciesList(db))
+		policyRoutes.GET("/:id", getPolicy(db))
+		policyRoutes.POST("/", createPolicy(db))
+		policyRoutes.PUT("/:id", updatePolicy(db))
+		policyRoutes.DELETE("/:id", deletePolicy(db))
+		policyRoutes.POST("/test", testPolicies(db))
+	}
+
+	// Authorization endpoints for other services and reverse proxies
+	router.GET("/auth/verify", requireAuth, verifyForwardAuth(db))
+	router.POST("/oauth/introspect", requireAuth, introspectToken(db))
+	authz := router.Group("/authz")
+	{
+		authz.Use(requireAuth)
+		authz.POST("/check", checkAuthz(db))
 	}
 
 	// Auth endpoints
 	router.POST("/signup", signup)
 	router.POST("/login", login)
 
+	// Checkpoints signés du journal d'audit
+	go runAuditCheckpoints(db)
+
+	// Livraison de l'outbox aux webhooks, relais des événements distribués vers les flux SSE, et rétention (OUTBOX_RETENTION)
+	go newOutboxDispatcher(db).run()
+	go changeHub.relay(db)
+	go runOutboxRetention(db)
+
+	// Désactivations programmées des comptes (STATUS_CHECK_INTERVAL)
+	go runStatusExpirations(db)
+
+	// Retrait des rôles et groupes expirés (GRANT_SWEEP_INTERVAL)
+	go runGrantSweeper(db)
+	go runRuleReconciler(db)
+
+	// API gRPC (GRPC_PORT)
+	go serveGRPC(db)
+
 	// Start the server
 	router.Run(":8080")
 
@@ -139,8 +380,14 @@ func main() {
 // getUsersList donne la liste des utilisateurs
 func getUsersList(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		query, err := filterAttributes(db, c, db)
+		if err != nil {
+			respondAttributeError(c, err)
+			return
+		}
 		var users []User
-		if err := db.Find(&users).Error; err != nil {
+		if err := query.Find(&users).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
 			return
 		}
@@ -151,6 +398,7 @@ func getUsersList(db *gorm.DB) gin.HandlerFunc {
 // getUser fetches a single user by their ID
 func getUser(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var user User
 		if err := db.Where("id = ?", id).First(&user).Error; err != nil {
@@ -164,16 +412,37 @@ func getUser(db *gorm.DB) gin.HandlerFunc {
 // createUser crée un nouvel utilisateur
 func createUser(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		var user User
 		if err := c.BindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user data"})
 			return
 		}
+		user.CrossTenantAdmin = false
+		user.Status, user.StatusReason, user.StatusChangedAt, user.DeactivateAt = statusActive, "", nil, nil
+		if err := validateUserAttributes(db, &user); err != nil {
+			respondAttributeError(c, err)
+			return
+		}
+		if err := validateManager(db, user); err != nil {
+			respondManagerError(c, err)
+			return
+		}
 
-		if err := db.Create(&user).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := enqueueEvent(tx, "user.created", "user", user.ID, user); err != nil {
+				return err
+			}
+			return applyMembershipRules(tx, user)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
 			return
 		}
+		recordAudit(db, c, "user.create", "user", user.ID, nil, user)
 		c.JSON(http.StatusCreated, user)
 	}
 }
@@ -181,29 +450,93 @@ func createUser(db *gorm.DB) gin.HandlerFunc {
 // updateUser met à jour un utilisateur existant
 func updateUser(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var user User
 		if err := db.Where("id = ?", id).First(&user).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
+		before := user
 
+		// nil: distingue un PUT sans attributs, et le décodage ne réécrit pas le tableau partagé avec before
+		user.Attributes = nil
 		if err := c.BindJSON(&user); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user data"})
 			return
 		}
+		user.CrossTenantAdmin = before.CrossTenantAdmin
+		// le statut ne change que par /suspend, /deactivate et /reactivate
+		user.Status, user.StatusReason, user.StatusChangedAt, user.DeactivateAt = before.Status, before.StatusReason, before.StatusChangedAt, before.DeactivateAt
+		// les attributs envoyés complètent ceux de l'utilisateur (null en retire un)
+		attributes := before.Attributes
+		if user.Attributes != nil {
+			var err error
+			if attributes, err = mergeAttributes(before.Attributes, user.Attributes); err != nil {
+				respondAttributeError(c, err)
+				return
+			}
+		}
+		user.Attributes = attributes
+		if err := validateUserAttributes(db, &user); err != nil {
+			respondAttributeError(c, err)
+			return
+		}
+		managerChanged := !sameManager(user.ManagerID, before.ManagerID)
+		if managerChanged {
+			if err := validateManager(db, user); err != nil {
+				respondManagerError(c, err)
+				return
+			}
+		}
 
-		if err := db.Save(&user).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if managerChanged {
+				// revérifié sous verrou: deux changements simultanés pourraient former une boucle
+				if err := lockManagers(tx, user); err != nil {
+					return err
+				}
+			}
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			if err := enqueueEvent(tx, "user.updated", "user", user.ID, user); err != nil {
+				return err
+			}
+			return applyMembershipRules(tx, user)
+		})
+		if err == errOwnManager || err == errManagerNotFound || err == errManagerCycle {
+			respondManagerError(c, err)
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
 			return
 		}
+		recordAudit(db, c, "user.update", "user", user.ID, before, user)
 		c.JSON(http.StatusOK, user)
 	}
 }
 
+// softDeleteUser supprime un utilisateur (soft delete) dans la transaction tx: ses sessions sont révoquées, ses
+// collaborateurs directs n'ont plus de manager et user.deleted est publié. Commun à REST, GraphQL, gRPC et SCIM.
+func softDeleteUser(tx *gorm.DB, user User) error {
+	if err := tx.Delete(&user).Error; err != nil {
+		return err
+	}
+	if err := revokeUserSessions(tx, user.ID); err != nil {
+		return err
+	}
+	if err := tx.Model(&User{}).Where("manager_id = ?", user.ID).UpdateColumn("manager_id", gorm.Expr("NULL")).Error; err != nil {
+		return err
+	}
+	return enqueueEvent(tx, "user.deleted", "user", user.ID, user)
+}
+
 // deleteUser supprime un utilisateur existant
 func deleteUser(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var user User
 		if err := db.Where("id = ?", id).First(&user).Error; err != nil {
@@ -211,10 +544,14 @@ func deleteUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Delete(&user).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return softDeleteUser(tx, user)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
 			return
 		}
+		recordAudit(db, c, "user.delete", "user", user.ID, user, nil)
 		c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 	}
 }
@@ -226,6 +563,7 @@ func deleteUser(db *gorm.DB) gin.HandlerFunc {
 // getRoles retourne la liste de tous les rôles et retourne un rôle par son ID
 func getRolesList(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		var roles []Role
 		if err := db.Find(&roles).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
@@ -238,6 +576,7 @@ func getRolesList(db *gorm.DB) gin.HandlerFunc {
 // getRole fetches a single role by their ID
 func getRole(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var role Role
 		if err := db.Where("id = ?", id).First(&role).Error; err != nil {
@@ -251,16 +590,24 @@ func getRole(db *gorm.DB) gin.HandlerFunc {
 // createRole crée un nouveau rôle
 func createRole(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		var role Role
 		if err := c.BindJSON(&role); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role data"})
 			return
 		}
 
-		if err := db.Create(&role).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&role).Error; err != nil {
+				return err
+			}
+			return enqueueEvent(tx, "role.created", "role", role.ID, role)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating role"})
 			return
 		}
+		recordAudit(db, c, "role.create", "role", role.ID, nil, role)
 		c.JSON(http.StatusCreated, role)
 	}
 }
@@ -268,22 +615,31 @@ func createRole(db *gorm.DB) gin.HandlerFunc {
 // UpdateRole met à jour un rôle existant
 func updateRole(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var role Role
 		if err := db.Where("id = ?", id).First(&role).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
 			return
 		}
+		before := role
 
 		if err := c.BindJSON(&role); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role data"})
 			return
 		}
 
-		if err := db.Save(&role).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&role).Error; err != nil {
+				return err
+			}
+			return enqueueEvent(tx, "role.updated", "role", role.ID, role)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating role"})
 			return
 		}
+		recordAudit(db, c, "role.update", "role", role.ID, before, role)
 		c.JSON(http.StatusOK, role)
 	}
 }
@@ -291,6 +647,7 @@ func updateRole(db *gorm.DB) gin.HandlerFunc {
 // DeleteRole supprime un rôle par son ID
 func deleteRole(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var role Role
 		if err := db.Where("id = ?", id).First(&role).Error; err != nil {
@@ -298,10 +655,17 @@ func deleteRole(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Delete(&role).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&role).Error; err != nil {
+				return err
+			}
+			return enqueueEvent(tx, "role.deleted", "role", role.ID, role)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting role"})
 			return
 		}
+		recordAudit(db, c, "role.delete", "role", role.ID, role, nil)
 		c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
 	}
 }
@@ -313,6 +677,7 @@ func deleteRole(db *gorm.DB) gin.HandlerFunc {
 // getGroups retourne la liste de tous les groupes et un groupe par son ID
 func getGroupsList(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		var groups []Group
 		if err := db.Find(&groups).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching groups"})
@@ -325,6 +690,7 @@ func getGroupsList(db *gorm.DB) gin.HandlerFunc {
 // getGroup fetches a single group by their ID
 func getGroup(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var group Group
 		if err := db.Where("id = ?", id).First(&group).Error; err != nil {
@@ -338,39 +704,108 @@ func getGroup(db *gorm.DB) gin.HandlerFunc {
 // createGroup crée un nouveau rôle
 func createGroup(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		var group Group
 		if err := c.BindJSON(&group); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group data"})
 			return
 		}
-
-		if err := db.Create(&group).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating group"})
+		if message := checkGroupParent(db, 0, group.ParentGroupID); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
 			return
 		}
-		c.JSON(http.StatusCreated, group)
+		insertGroup(db, c, group)
+	}
+}
+
+// checkGroupParent vérifie que le parent est un groupe de la même organisation (db est scopé) et, pour un
+// groupe existant, qu'il n'en descend pas; retourne le message d'erreur, "" si le parent convient
+func checkGroupParent(db *gorm.DB, groupID uint, parentID *uint) string {
+	if parentID == nil {
+		return ""
+	}
+	if db.First(&Group{}, *parentID).Error != nil {
+		return "Parent group not found"
+	}
+	seen := map[uint]bool{}
+	for next := *parentID; next != 0 && !seen[next]; {
+		if next == groupID {
+			return "Parent group cannot be the group itself or one of its subgroups"
+		}
+		seen[next] = true
+		var parent Group
+		if db.First(&parent, next).Error != nil || parent.ParentGroupID == nil {
+			break
+		}
+		next = *parent.ParentGroupID
+	}
+	return ""
+}
+
+// insertGroup enregistre un nouveau groupe avec son événement et son audit, applique sa règle d'appartenance
+// et répond 201
+func insertGroup(db *gorm.DB, c *gin.Context, group Group) {
+	if _, err := compileMembershipRule(group.MembershipRule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "group.created", "group", group.ID, group)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating group"})
+		return
+	}
+	recordAudit(db, c, "group.create", "group", group.ID, nil, group)
+	if group.MembershipRule != "" {
+		syncGroupRule(db, group)
 	}
+	c.JSON(http.StatusCreated, group)
 }
 
 // updateGroup met à jour un groupe existant
 func updateGroup(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var group Group
 		if err := db.Where("id = ?", id).First(&group).Error; err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
 			return
 		}
+		before := group
 
 		if err := c.BindJSON(&group); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group data"})
 			return
 		}
+		if message := checkGroupParent(db, group.ID, group.ParentGroupID); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+		if _, err := compileMembershipRule(group.MembershipRule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		if err := db.Save(&group).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&group).Error; err != nil {
+				return err
+			}
+			return enqueueEvent(tx, "group.updated", "group", group.ID, group)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating group"})
 			return
 		}
+		recordAudit(db, c, "group.update", "group", group.ID, before, group)
+		if group.MembershipRule != before.MembershipRule {
+			// sans règle, les appartenances dérivées sont retirées
+			syncGroupRule(db, group)
+		}
 		c.JSON(http.StatusOK, group)
 	}
 }
@@ -378,6 +813,7 @@ func updateGroup(db *gorm.DB) gin.HandlerFunc {
 // deleteGroup supprime un groupe par son ID
 func deleteGroup(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		db := tenantDB(c, db)
 		id := c.Param("id")
 		var group Group
 		if err := db.Where("id = ?", id).First(&group).Error; err != nil {
@@ -385,10 +821,17 @@ func deleteGroup(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Delete(&group).Error; err != nil {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&group).Error; err != nil {
+				return err
+			}
+			return enqueueEvent(tx, "group.deleted", "group", group.ID, group)
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting group"})
 			return
 		}
+		recordAudit(db, c, "group.delete", "group", group.ID, group, nil)
 		c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
 	}
 }
@@ -414,6 +857,22 @@ func signup(c *gin.Context) {
 		return
 	}
 
+	// organisation des inscriptions: fermées dès qu'il y a plusieurs organisations, sauf SIGNUP_ORGANIZATION_ID
+
+	orgID, err := signupOrganization(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to create user",
+		})
+		return
+	}
+	if orgID == 0 {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Signup is disabled, ask an administrator for an invitation",
+		})
+		return
+	}
+
 	// hash password
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), 10)
@@ -427,14 +886,27 @@ func signup(c *gin.Context) {
 	// creation user
 
 	user := User{Name: body.Name, Email: body.Email, Password: string(hash)}
-	result := db.Create(&user)
+	if err := validateUserAttributes(scopeTenant(db, orgID), &user); err != nil {
+		respondAttributeError(c, err)
+		return
+	}
+	err = scopeTenant(db, orgID).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := enqueueEvent(tx, "user.created", "user", user.ID, user); err != nil {
+			return err
+		}
+		return applyMembershipRules(tx, user)
+	})
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Failed to create user",
 		})
 		return
 	}
+	recordAudit(db, c, "signup", "user", user.ID, nil, user)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Utilisateur enregistré, vous pouvez login",
@@ -443,9 +915,11 @@ func signup(c *gin.Context) {
 
 func login(c *gin.Context) {
 
+	// l'email identifie le compte: il est unique sur tout le déploiement, le nom seulement dans une organisation
 	var body struct {
-		Name     string
+		Email    string
 		Password string
+		Device   string
 	}
 
 	if c.Bind(&body) != nil {
@@ -456,12 +930,15 @@ func login(c *gin.Context) {
 	}
 
 	var user User
-	db.First(&user, "name = ?", body.Name)
+	db.First(&user, "email = ?", body.Email)
 
 	if user.ID == 0 {
 
+		event := newAuditEvent(c, "login.failure", "user", "", nil, nil)
+		event.Actor = body.Email
+		saveAudit(db, event)
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Nom d'utilisateur ou mot de passe invalide",
+			"error": "Email ou mot de passe invalide",
 		})
 		return
 	}
@@ -470,22 +947,31 @@ func login(c *gin.Context) {
 
 	if err != nil {
 
+		event := newAuditEvent(c, "login.failure", "user", user.ID, nil, nil)
+		event.ActorID, event.Actor = &user.ID, user.Email
+		saveAudit(db, event)
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "Nom d'utilisateur ou mot de passe invalide",
+			"error": "Email ou mot de passe invalide",
 		})
 		return
 	}
 
-	// generation du token JWT
+	// seul un compte actif peut se connecter
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userid": user.ID,
-		"exp":    time.Now().Add(time.Hour * 24 * 30).Unix(),
-	})
+	if err := checkActive(user); err != nil {
+
+		event := newAuditEvent(c, "login.failure", "user", user.ID, nil, gin.H{"reason": err.Error()})
+		event.ActorID, event.Actor = &user.ID, user.Email
+		saveAudit(db, event)
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Account is " + user.currentStatus(),
+		})
+		return
+	}
 
-	// signature et recup du token chiffré en string utilisant la var SECRET
+	// ouverture de la session et generation du token JWT
 
-	tokenString, err := token.SignedString([]byte(os.Getenv("SECRET")))
+	tokenString, _, err := startSession(db, user, body.Device, c.ClientIP(), c.Request.UserAgent())
 
 	if err != nil {
 
@@ -495,21 +981,65 @@ func login(c *gin.Context) {
 		return
 	}
 
+	event := newAuditEvent(c, "login.success", "user", user.ID, nil, nil)
+	event.ActorID, event.Actor = &user.ID, user.Email
+	saveAudit(db, event)
+
 	// on retourne le token (en cookie)
 	c.SetSameSite(http.SameSiteLaxMode)
 	c.SetCookie("Authorization", tokenString, 3600*24*30, "", "", false, true)
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Vous êtes connecté",
+		"token":   tokenString,
 	})
 
 }
 
-func requireAuth(c *gin.Context) {
+// signToken génère le JWT d'une session, signé avec la var SECRET (claim act pour une impersonation)
+func signToken(user User, session Session) (string, error) {
+	claims := jwt.MapClaims{
+		"userid": user.ID,
+		"sid":    session.ID,
+		"org":    session.OrganizationID,
+		"iat":    time.Now().Unix(),
+		"exp":    session.ExpiresAt.Unix(),
+	}
+	if session.ImpersonatorID != nil {
+		claims["act"] = map[string]string{"sub": strconv.FormatUint(uint64(*session.ImpersonatorID), 10)}
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(os.Getenv("SECRET")))
+}
 
-	tokenString, err := c.Cookie("Authorization")
+// userFromToken valide un JWT émis par signToken et retourne son utilisateur (REST, GraphQL et gRPC)
+func userFromToken(tokenString string) (User, error) {
+	user, _, err := sessionFromToken(tokenString)
+	return user, err
+}
+
+// sessionFromToken valide un JWT et sa session (non révoquée) et retourne l'utilisateur et la session
+func sessionFromToken(tokenString string) (User, Session, error) {
+	claims, err := parseToken(tokenString)
 	if err != nil {
-		c.AbortWithStatus(http.StatusUnauthorized)
+		return User{}, Session{}, err
+	}
+	session, err := activeSession(claims)
+	if err != nil {
+		return User{}, Session{}, err
+	}
+
+	var user User
+	if err := db.First(&user, claims["userid"]).Error; err != nil {
+		return User{}, Session{}, err
 	}
+	if err := checkActive(user); err != nil {
+		return User{}, Session{}, err
+	}
+	return user, session, nil
+}
+
+// parseToken vérifie la signature et l'expiration d'un JWT et retourne ses claims
+func parseToken(tokenString string) (jwt.MapClaims, error) {
 
 	// Parsing du token string
 
@@ -522,24 +1052,71 @@ func requireAuth(c *gin.Context) {
 		return []byte(os.Getenv("SECRET")), nil
 
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
 
-		// vérification de la date d'expiration du token
+	// vérification de la date d'expiration du token
 
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
-			c.AbortWithStatus(http.StatusUnauthorized)
-		}
+	exp, ok := claims["exp"].(float64)
+	if !ok || float64(time.Now().Unix()) > exp {
+		return nil, errors.New("token expired")
+	}
+	return claims, nil
+}
 
-		var user User
-		db.First(&user, claims["userid"])
+// requestToken lit le JWT dans le cookie Authorization ou dans le header "Authorization: Bearer <token>"
+func requestToken(c *gin.Context) (string, bool) {
+	if tokenString, err := c.Cookie("Authorization"); err == nil && tokenString != "" {
+		return tokenString, true
+	}
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer "), true
+	}
+	return "", false
+}
 
-		c.Set("user", user)
+func requireAuth(c *gin.Context) {
 
-		c.Next()
+	tokenString, ok := requestToken(c)
+	if !ok {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
 
-	} else {
+	user, session, err := sessionFromToken(tokenString)
+	var inactive inactiveAccountError
+	if errors.As(err, &inactive) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account is " + inactive.status})
+		return
+	}
+	if err != nil {
 		c.AbortWithStatus(http.StatusUnauthorized)
+		return
 	}
 
+	c.Set("user", user)
+	c.Set("session", session)
+
+	impersonator, impersonating, err := impersonatorOf(session)
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	if impersonating {
+		c.Set("impersonator", impersonator)
+		defer auditImpersonatedRequest(c)
+	}
+
+	if !resolveTenant(c, user, session) {
+		return
+	}
+
+	c.Next()
+
 }
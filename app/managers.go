@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Hiérarchie: chaque utilisateur a au plus un manager (users.manager_id) dans son organisation. Les politiques
+// voient la chaîne hiérarchique (subject.manager_ids, resource.manager_ids) et le manager du demandeur peut
+// approuver ses demandes d'accès (voir access_requests.go).
+
+// clé du verrou advisory qui sérialise les changements de manager (détection des boucles)
+const managerLock = 7283002
+
+var (
+	errOwnManager      = errors.New("user cannot be their own manager")
+	errManagerNotFound = errors.New("manager not found")
+	errManagerCycle    = errors.New("manager assignment would create a cycle")
+)
+
+// orgChartNode est un utilisateur de l'organigramme avec ses collaborateurs directs
+type orgChartNode struct {
+	ID        uint            `json:"id"`
+	Name      string          `json:"name"`
+	Email     string          `json:"email"`
+	Status    string          `json:"status"`
+	ManagerID *uint           `json:"manager_id"`
+	Reports   []*orgChartNode `json:"reports"`
+}
+
+// managerChain remonte la chaîne hiérarchique depuis managerID, du manager direct au sommet, un niveau (une requête)
+// à la fois; un manager supprimé arrête la chaîne
+func managerChain(db *gorm.DB, managerID *uint) ([]User, error) {
+	chain := []User{}
+	seen := map[uint]bool{}
+	for managerID != nil && !seen[*managerID] {
+		seen[*managerID] = true
+		var manager User
+		if err := db.Where("id = ?", *managerID).First(&manager).Error; err != nil {
+			return chain, ignoreNotFound(err)
+		}
+		chain = append(chain, manager)
+		managerID = manager.ManagerID
+	}
+	return chain, nil
+}
+
+// managerIDs donne les IDs d'une chaîne hiérarchique, pour les politiques
+func managerIDs(chain []User) []int64 {
+	ids := make([]int64, len(chain))
+	for i, manager := range chain {
+		ids[i] = int64(manager.ID)
+	}
+	return ids
+}
+
+// validateManager vérifie que le manager existe dans l'organisation et que l'utilisateur n'est pas dans sa chaîne
+func validateManager(db *gorm.DB, user User) error {
+	if user.ManagerID == nil {
+		return nil
+	}
+	if *user.ManagerID == user.ID {
+		return errOwnManager
+	}
+	chain, err := managerChain(db, user.ManagerID)
+	if err != nil {
+		return err
+	}
+	if len(chain) == 0 || chain[0].ID != *user.ManagerID {
+		return errManagerNotFound
+	}
+	for _, manager := range chain {
+		if user.ID != 0 && manager.ID == user.ID {
+			return errManagerCycle
+		}
+	}
+	return nil
+}
+
+// lockManagers sérialise les changements de manager jusqu'à la fin de la transaction, puis revérifie la chaîne
+func lockManagers(tx *gorm.DB, user User) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", managerLock).Error; err != nil {
+		return err
+	}
+	return validateManager(tx, user)
+}
+
+// respondManagerError renvoie 400 (manager invalide), 409 (boucle) ou 500
+func respondManagerError(c *gin.Context, err error) {
+	switch err {
+	case errOwnManager:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A user cannot be their own manager"})
+	case errManagerNotFound:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Manager not found"})
+	case errManagerCycle:
+		c.JSON(http.StatusConflict, gin.H{"error": "Manager assignment would create a cycle"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking manager"})
+	}
+}
+
+// sameManager compare deux manager_id optionnels
+func sameManager(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// loadOrgChart charge le sous-arbre sous root, un niveau (une requête) à la fois; depth 0 = sans limite
+func loadOrgChart(db *gorm.DB, root User, depth int) (*orgChartNode, error) {
+	newNode := func(u User) *orgChartNode {
+		return &orgChartNode{ID: u.ID, Name: u.Name, Email: u.Email, Status: u.currentStatus(), ManagerID: u.ManagerID, Reports: []*orgChartNode{}}
+	}
+	tree := newNode(root)
+	nodes := map[uint]*orgChartNode{root.ID: tree}
+	level := []uint{root.ID}
+	for d := 1; len(level) > 0 && (depth == 0 || d <= depth); d++ {
+		var reports []User
+		if err := db.Where("manager_id IN (?)", level).Order("name, id").Find(&reports).Error; err != nil {
+			return nil, err
+		}
+		level = nil
+		for _, report := range reports {
+			if nodes[report.ID] != nil {
+				continue
+			}
+			node := newNode(report)
+			nodes[report.ID] = node
+			nodes[*report.ManagerID].Reports = append(nodes[*report.ManagerID].Reports, node)
+			level = append(level, report.ID)
+		}
+	}
+	return tree, nil
+}
+
+// writeOrgChartCSV écrit le sous-arbre en profondeur d'abord, une ligne par utilisateur
+func writeOrgChartCSV(w *csv.Writer, node *orgChartNode, depth int) {
+	w.Write([]string{strconv.FormatUint(uint64(node.ID), 10), node.Name, node.Email, node.Status,
+		formatOptionalID(node.ManagerID), strconv.Itoa(depth)})
+	for _, report := range node.Reports {
+		writeOrgChartCSV(w, report, depth+1)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint managers
+
+// getDirectReports retourne les collaborateurs directs d'un utilisateur
+func getDirectReports(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		reports := []User{}
+		if err := db.Where("manager_id = ?", user.ID).Order("name, id").Find(&reports).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reports"})
+			return
+		}
+		c.JSON(http.StatusOK, reports)
+	}
+}
+
+// getManagerChain retourne la chaîne hiérarchique d'un utilisateur, du manager direct au sommet
+func getManagerChain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		chain, err := managerChain(db, user.ManagerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching managers"})
+			return
+		}
+		c.JSON(http.StatusOK, chain)
+	}
+}
+
+// exportOrgChart exporte l'organigramme sous un utilisateur en JSON (arbre) ou en CSV (?format=csv),
+// limité à ?depth= niveaux
+func exportOrgChart(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		depth := 0
+		if value := c.Query("depth"); value != "" {
+			var err error
+			if depth, err = strconv.Atoi(value); err != nil || depth < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid depth"})
+				return
+			}
+		}
+		tree, err := loadOrgChart(db, user, depth)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching org chart"})
+			return
+		}
+
+		filename := fmt.Sprintf("org-chart-%d", user.ID)
+		if c.Query("format") != "csv" {
+			c.Header("Content-Disposition", "attachment; filename="+filename+".json")
+			c.JSON(http.StatusOK, tree)
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename="+filename+".csv")
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"user_id", "name", "email", "status", "manager_id", "depth"})
+		writeOrgChartCSV(w, tree, 0)
+		w.Flush()
+	}
+}
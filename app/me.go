@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Endpoints /me: l'utilisateur du token gère son propre compte, sans droits sur /users/:id
+
+// meProfile est le profil de l'appelant: ses rôles et groupes directs, et ses rôles effectifs (hérités des groupes compris)
+type meProfile struct {
+	User
+	EffectiveRoles []string `json:"effective_roles"`
+	ImpersonatedBy *User    `json:"impersonated_by,omitempty"` // administrateur, sous impersonation
+}
+
+// getMe retourne le profil de l'utilisateur connecté
+func getMe(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user := c.MustGet("user").(User)
+		if err := db.First(&user, user.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+			return
+		}
+		// rôles et groupes directs, sans les grants à venir ou expirés
+		roles, err := loadRelated(db, "user_roles", "user_id", "role_id", []uint{user.ID}, func(r Role) uint { return r.ID })
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+			return
+		}
+		groups, err := loadRelated(db, "user_groups", "user_id", "group_id", []uint{user.ID}, func(g Group) uint { return g.ID })
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching groups"})
+			return
+		}
+		user.Roles, user.Groups = roles[user.ID], groups[user.ID]
+		subject, err := loadAuthzSubject(db, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+			return
+		}
+		profile := meProfile{User: user, EffectiveRoles: subject.roleNames()}
+		if value, ok := c.Get("impersonator"); ok {
+			impersonator := value.(User)
+			profile.ImpersonatedBy = &impersonator
+		}
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+// updateMe modifie le nom de l'utilisateur connecté; un nouvel email ne prend effet qu'une fois confirmé avec le lien
+// envoyé à cette adresse (voir email_changes.go). Les autres champs sont ignorés
+func updateMe(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(User)
+		before := user
+
+		var body struct {
+			Name  *string `json:"name"`
+			Email *string `json:"email"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user data"})
+			return
+		}
+		if body.Name != nil {
+			user.Name = strings.TrimSpace(*body.Name)
+		}
+		email := user.Email
+		if body.Email != nil {
+			email = strings.TrimSpace(*body.Email)
+		}
+		if user.Name == "" || email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name and email cannot be empty"})
+			return
+		}
+
+		if email != user.Email {
+			// les emails sont uniques sur tout le déploiement: la vérification n'est pas limitée à l'organisation
+			var taken int
+			if err := db.Model(&User{}).Unscoped().Where("email = ? AND id <> ?", email, user.ID).Count(&taken).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+				return
+			}
+			if taken > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+				return
+			}
+		}
+
+		if user.Name != before.Name {
+			// le nom n'entre pas dans les règles des groupes dynamiques, il change tout de suite
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Model(&user).Update("name", user.Name).Error; err != nil {
+					return err
+				}
+				return enqueueEvent(tx, "user.updated", "user", user.ID, user)
+			})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+				return
+			}
+			recordAudit(db, c, "user.update", "user", user.ID, before, user)
+		}
+
+		if email != user.Email {
+			if err := startEmailChange(db, user, email); err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Error sending email confirmation"})
+				return
+			}
+			recordAudit(db, c, "user.email_change_request", "user", user.ID, gin.H{"email": user.Email}, gin.H{"email": email})
+		}
+
+		pending, err := pendingEmail(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user"})
+			return
+		}
+		c.JSON(http.StatusOK, struct {
+			User
+			PendingEmail string `json:"pending_email,omitempty"`
+		}{user, pending})
+	}
+}
+
+// changeMyPassword remplace le mot de passe de l'utilisateur connecté s'il donne le mot de passe actuel
+func changeMyPassword(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(User)
+
+		var body struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := c.BindJSON(&body); err != nil || body.NewPassword == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "current_password and new_password are required"})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(body.CurrentPassword)) != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is invalid"})
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid new password"})
+			return
+		}
+		// les autres sessions ne survivent pas au changement, seule celle de la requête reste ouverte
+		session := c.MustGet("session").(Session)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Update("password", string(hash)).Error; err != nil {
+				return err
+			}
+			return revokeOtherSessions(tx, user.ID, session.ID)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating password"})
+			return
+		}
+		recordAudit(db, c, "user.password_change", "user", user.ID, nil, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// OutboxEvent est écrit dans la même transaction que la modification qu'il décrit,
+// le dispatcher le distribue ensuite aux webhooks abonnés
+type OutboxEvent struct {
+	ID           uint       `gorm:"primary_key" json:"id"`
+	EventType    string     `json:"type"`
+	EntityType   string     `json:"entity_type"`
+	EntityID     uint       `json:"entity_id"`
+	Payload      JSONB      `gorm:"type:jsonb" json:"data"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DispatchedAt *time.Time `json:"-"`
+	DispatchSeq  *uint      `json:"-"` // ordre de distribution, ID des événements SSE (voir fanOut)
+}
+
+// clé du verrou advisory qui sérialise fanOut: dispatch_seq suit alors l'ordre des commits
+const outboxLock = 7283003
+
+// enqueueEvent ajoute un événement à l'outbox; tx doit être la transaction de la modification
+func enqueueEvent(tx *gorm.DB, eventType, entityType string, entityID uint, payload interface{}) error {
+	event := OutboxEvent{
+		EventType:  eventType,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Payload:    toJSONB(payload),
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return err
+	}
+	// réveille les dispatchers dès le commit (Postgres fusionne les NOTIFY identiques d'une transaction)
+	return bus.PublishTx(tx, topicOutbox, "")
+}
+
+// enqueueMembershipEvent publie la liste à jour des membres d'un groupe (group.members_changed)
+func enqueueMembershipEvent(tx *gorm.DB, groupID uint) error {
+	memberIDs := []uint{}
+	if err := whereActiveGrant(tx.Table("user_groups"), "user_groups").Where("group_id = ?", groupID).Order("user_id").Pluck("user_id", &memberIDs).Error; err != nil {
+		return err
+	}
+	return enqueueEvent(tx, "group.members_changed", "group", groupID, map[string]interface{}{
+		"group_id":   groupID,
+		"member_ids": memberIDs,
+	})
+}
+
+// enqueueUserRolesEvent publie la liste à jour des rôles d'un utilisateur (user.roles_changed)
+func enqueueUserRolesEvent(tx *gorm.DB, userID uint) error {
+	roleIDs := []uint{}
+	if err := whereActiveGrant(tx.Table("user_roles"), "user_roles").Where("user_id = ?", userID).Order("role_id").Pluck("role_id", &roleIDs).Error; err != nil {
+		return err
+	}
+	return enqueueEvent(tx, "user.roles_changed", "user", userID, map[string]interface{}{
+		"user_id":  userID,
+		"role_ids": roleIDs,
+	})
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Dispatcher
+
+type outboxDispatcher struct {
+	db          *gorm.DB
+	client      *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	lease       time.Duration // durée de réservation d'une livraison en cours d'envoi (50 envois de 10s au plus)
+
+	// webhooks actifs, vidé par un message cache_invalidate "webhooks" sur tous les réplicas
+	mu       sync.Mutex
+	webhooks []Webhook
+}
+
+func newOutboxDispatcher(db *gorm.DB) *outboxDispatcher {
+	maxAttempts, err := strconv.Atoi(getenvDefault("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || maxAttempts < 1 {
+		maxAttempts = 8
+	}
+	return &outboxDispatcher{
+		db:          db,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		maxAttempts: maxAttempts,
+		baseDelay:   10 * time.Second,
+		maxDelay:    time.Hour,
+		lease:       2 * time.Minute,
+	}
+}
+
+// run distribue l'outbox puis livre les webhooks en attente, dès qu'un événement est publié sur le bus
+// et au moins toutes les OUTBOX_POLL_INTERVAL (1s par défaut) pour les nouvelles tentatives
+func (d *outboxDispatcher) run() {
+	interval, err := time.ParseDuration(getenvDefault("OUTBOX_POLL_INTERVAL", "1s"))
+	if err != nil {
+		interval = time.Second
+	}
+	wakeups, _ := bus.Subscribe(topicOutbox)
+	invalidations, _ := bus.Subscribe(topicCacheInvalidate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-wakeups:
+			for len(wakeups) > 0 {
+				<-wakeups
+			}
+		case <-ticker.C:
+		case name := <-invalidations:
+			if name == "webhooks" {
+				d.mu.Lock()
+				d.webhooks = nil
+				d.mu.Unlock()
+			}
+			continue
+		}
+
+		events, err := d.fanOut()
+		if err != nil {
+			log.Printf("outbox: fan-out failed: %v", err)
+		}
+		// une fois la transaction validée, les flux SSE de tous les réplicas sont prévenus
+		for _, event := range events {
+			if err := bus.Publish(topicChanges, strconv.FormatUint(uint64(event.ID), 10)); err != nil {
+				log.Printf("outbox: cannot publish event %d: %v", event.ID, err)
+			}
+		}
+		if err := d.deliverDue(); err != nil {
+			log.Printf("outbox: delivery failed: %v", err)
+		}
+	}
+}
+
+// activeWebhooks retourne les webhooks actifs, chargés une fois puis gardés jusqu'à invalidation
+func (d *outboxDispatcher) activeWebhooks(tx *gorm.DB) ([]Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.webhooks == nil {
+		webhooks := []Webhook{}
+		if err := tx.Where("active = ?", true).Find(&webhooks).Error; err != nil {
+			return nil, err
+		}
+		d.webhooks = webhooks
+	}
+	return d.webhooks, nil
+}
+
+// fanOut crée une livraison par webhook abonné pour chaque événement pas encore distribué
+// et retourne les événements distribués. Les IDs de l'outbox sont pris à l'insertion et ne suivent pas l'ordre des
+// commits; dispatch_seq est pris ici, sous un verrou tenu jusqu'au commit: un événement distribué implique que tous
+// ceux de dispatch_seq plus petit le sont aussi.
+func (d *outboxDispatcher) fanOut() ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", outboxLock).Error; err != nil {
+			return err
+		}
+		if err := tx.Raw(`SELECT * FROM outbox_events WHERE dispatched_at IS NULL
+			ORDER BY id LIMIT 100 FOR UPDATE SKIP LOCKED`).Scan(&events).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		webhooks, err := d.activeWebhooks(tx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, event := range events {
+			for _, webhook := range webhooks {
+				if !webhook.subscribedTo(event.EventType) {
+					continue
+				}
+				delivery := WebhookDelivery{
+					WebhookID:     webhook.ID,
+					OutboxEventID: event.ID,
+					Status:        deliveryPending,
+					NextAttemptAt: now,
+				}
+				if err := tx.Create(&delivery).Error; err != nil {
+					return err
+				}
+			}
+			err := tx.Model(&event).UpdateColumns(map[string]interface{}{
+				"dispatched_at": now,
+				"dispatch_seq":  gorm.Expr("nextval('outbox_dispatch_seq')"),
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// deliverDue envoie les livraisons arrivées à échéance. Les appels HTTP se font hors transaction: les livraisons
+// sont d'abord réservées (claimDue), puis chaque résultat est enregistré à part (record).
+func (d *outboxDispatcher) deliverDue() error {
+	deliveries, err := d.claimDue()
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		if err := d.attempt(&deliveries[i]); err != nil {
+			log.Printf("outbox: cannot record delivery %d: %v", deliveries[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// claimDue réserve les livraisons dues: next_attempt_at est repoussé de la durée du bail et la tentative comptée,
+// dans une transaction courte. Un réplica arrêté en cours d'envoi laisse la livraison repartir à la fin du bail.
+func (d *outboxDispatcher) claimDue() ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Raw(`SELECT * FROM webhook_deliveries WHERE status IN (?) AND next_attempt_at <= ?
+			ORDER BY next_attempt_at LIMIT 50 FOR UPDATE SKIP LOCKED`,
+			[]string{deliveryPending, deliveryRetrying}, time.Now()).Scan(&deliveries).Error; err != nil {
+			return err
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+		// précision des timestamps postgres: record retrouve la réservation par égalité
+		lease := time.Now().Add(d.lease).Truncate(time.Microsecond)
+		ids := make([]uint, len(deliveries))
+		for i := range deliveries {
+			ids[i] = deliveries[i].ID
+			deliveries[i].Attempts++
+			deliveries[i].NextAttemptAt = lease
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id IN (?)", ids).UpdateColumns(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": lease,
+		}).Error
+	})
+	return deliveries, err
+}
+
+// attempt envoie une livraison réservée et programme la suivante avec un backoff exponentiel,
+// au-delà de WEBHOOK_MAX_ATTEMPTS la livraison passe en dead-letter
+func (d *outboxDispatcher) attempt(delivery *WebhookDelivery) error {
+	lease := delivery.NextAttemptAt
+
+	var webhook Webhook
+	var event OutboxEvent
+	if err := d.db.First(&webhook, delivery.WebhookID).Error; err != nil {
+		return d.fail(delivery, lease, 0, "webhook not found")
+	}
+	if err := d.db.First(&event, delivery.OutboxEventID).Error; err != nil {
+		return d.fail(delivery, lease, 0, "event not found")
+	}
+
+	status, err := d.send(webhook, event, delivery.ID)
+	if err != nil {
+		return d.fail(delivery, lease, status, err.Error())
+	}
+
+	now := time.Now()
+	delivery.Status = deliveryDelivered
+	delivery.DeliveredAt = &now
+	delivery.ResponseStatus = status
+	delivery.LastError = ""
+	return d.record(delivery, lease)
+}
+
+func (d *outboxDispatcher) fail(delivery *WebhookDelivery, lease time.Time, status int, reason string) error {
+	delivery.LastError = reason
+	delivery.ResponseStatus = status
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status = deliveryDead
+	} else {
+		delivery.Status = deliveryRetrying
+		delivery.NextAttemptAt = time.Now().Add(d.backoff(delivery.Attempts))
+	}
+	return d.record(delivery, lease)
+}
+
+// record enregistre le résultat d'une tentative si la livraison est toujours réservée par elle (un replay
+// pendant l'envoi l'emporte)
+func (d *outboxDispatcher) record(delivery *WebhookDelivery, lease time.Time) error {
+	return d.db.Model(&WebhookDelivery{}).Where("id = ? AND next_attempt_at = ?", delivery.ID, lease).UpdateColumns(map[string]interface{}{
+		"status":          delivery.Status,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_error":      delivery.LastError,
+		"response_status": delivery.ResponseStatus,
+		"delivered_at":    delivery.DeliveredAt,
+		"updated_at":      time.Now(),
+	}).Error
+}
+
+// backoff: 10s, 20s, 40s... plafonné à 1h
+func (d *outboxDispatcher) backoff(attempts int) time.Duration {
+	delay := d.baseDelay
+	for i := 1; i < attempts && delay < d.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.maxDelay {
+		delay = d.maxDelay
+	}
+	return delay
+}
+
+// send poste l'événement signé: X-Webhook-Signature = sha256=HMAC(secret, timestamp + "." + body)
+func (d *outboxDispatcher) send(webhook Webhook, event OutboxEvent, deliveryID uint) (int, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", strconv.FormatUint(uint64(deliveryID), 10))
+	req.Header.Set("X-Webhook-Event", event.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signWebhookPayload(webhook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// eventMatches accepte un type exact, un préfixe "user.*" ou "*"
+func eventMatches(pattern, eventType string) bool {
+	if pattern == "*" || pattern == eventType {
+		return true
+	}
+	return strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*"))
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Rétention de l'outbox
+
+// runOutboxRetention supprime toutes les heures les livraisons terminées (delivered, dead) et les événements
+// distribués plus vieux que OUTBOX_RETENTION (720h par défaut)
+func runOutboxRetention(db *gorm.DB) {
+	retention, err := time.ParseDuration(getenvDefault("OUTBOX_RETENTION", "720h"))
+	if err != nil || retention <= 0 {
+		log.Printf("outbox: invalid OUTBOX_RETENTION, using 720h")
+		retention = 720 * time.Hour
+	}
+	for range time.Tick(time.Hour) {
+		if err := pruneOutbox(db, time.Now().Add(-retention)); err != nil {
+			log.Printf("outbox: failed to prune: %v", err)
+		}
+	}
+}
+
+// pruneOutbox supprime ce qui est antérieur à before; un événement n'est supprimé qu'une fois toutes ses
+// livraisons parties
+func pruneOutbox(db *gorm.DB, before time.Time) error {
+	err := db.Exec(`DELETE FROM webhook_deliveries WHERE status IN (?) AND COALESCE(updated_at, created_at) < ?`,
+		[]string{deliveryDelivered, deliveryDead}, before).Error
+	if err != nil {
+		return err
+	}
+	return db.Exec(`DELETE FROM outbox_events e WHERE e.dispatched_at < ?
+		AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.outbox_event_id = e.id)`, before).Error
+}
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/cel-go/cel"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+const (
+	policyAllow = "allow"
+	policyDeny  = "deny"
+)
+
+// Policy est une règle d'accès: Effect s'applique aux Actions sur les Resources (motifs comme
+// les permissions, vide = toutes) quand Condition, une expression CEL, est vraie (vide = toujours).
+// Variables de la condition: subject, resource, action et request (voir policyInput).
+type Policy struct {
+	ID          uint           `gorm:"primary_key" json:"id"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Effect      string         `json:"effect"`
+	Actions     pq.StringArray `gorm:"type:text[]" json:"actions"`
+	Resources   pq.StringArray `gorm:"type:text[]" json:"resources"`
+	Condition   string         `json:"condition"`
+	Enabled     bool           `json:"enabled"`
+	Source      string         `gorm:"-" json:"source,omitempty"` // "file" pour les politiques de POLICY_FILE
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+type compiledPolicy struct {
+	Policy
+	program cel.Program
+}
+
+// policyInput est ce qu'une condition peut lire:
+//   - subject: id, name, email, roles, groups, group_ids (groupes et leurs parents), owned_group_ids, attributes,
+//     manager_id (0 sans manager) et manager_ids (chaîne hiérarchique)
+//   - resource: type, id et, pour users/roles/groups, les attributs de l'enregistrement
+//     (users et groups ont aussi group_ids: groupes de l'utilisateur, ou le groupe lui-même, avec leurs parents)
+//   - action: read, create, update, delete...
+//   - request: method, path, body (JSON envoyé, {} sinon)
+type policyInput struct {
+	Subject  map[string]interface{}
+	Resource map[string]interface{}
+	Action   string
+	Request  map[string]interface{}
+}
+
+var policyEnv = mustPolicyEnv()
+
+func mustPolicyEnv() *cel.Env {
+	env, err := cel.NewEnv(
+		cel.Variable("subject", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("action", cel.StringType),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return env
+}
+
+// compilePolicy vérifie une politique et compile sa condition
+func compilePolicy(policy Policy) (compiledPolicy, error) {
+	compiled := compiledPolicy{Policy: policy}
+	if policy.Name == "" {
+		return compiled, errors.New("name is required")
+	}
+	if policy.Effect != policyAllow && policy.Effect != policyDeny {
+		return compiled, errors.New("effect must be allow or deny")
+	}
+	condition := policy.Condition
+	if strings.TrimSpace(condition) == "" {
+		condition = "true"
+	}
+	ast, issues := policyEnv.Compile(condition)
+	if issues != nil && issues.Err() != nil {
+		return compiled, fmt.Errorf("invalid condition: %v", issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return compiled, errors.New("condition must be a boolean expression")
+	}
+	program, err := policyEnv.Program(ast)
+	if err != nil {
+		return compiled, fmt.Errorf("invalid condition: %v", err)
+	}
+	compiled.program = program
+	return compiled, nil
+}
+
+// applies dit si la politique concerne la demande et si sa condition est vraie
+func (p compiledPolicy) applies(action, resource string, input policyInput) (bool, error) {
+	if !matchesAny(p.Actions, action) || !matchesAny(p.Resources, resource) {
+		return false, nil
+	}
+	out, _, err := p.program.Eval(map[string]interface{}{
+		"subject":  input.Subject,
+		"resource": input.Resource,
+		"action":   input.Action,
+		"request":  input.Request,
+	})
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, errors.New("condition did not return a boolean")
+	}
+	return result, nil
+}
+
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if globMatches(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Moteur de politiques
+
+// policyEngine garde les politiques actives compilées (table policies + POLICY_FILE),
+// rechargées quand un réplica publie cache_invalidate "policies"
+type policyEngine struct {
+	db *gorm.DB
+
+	mu       sync.Mutex
+	loaded   bool
+	policies []compiledPolicy
+}
+
+var policies = &policyEngine{}
+
+func newPolicyEngine(db *gorm.DB) *policyEngine {
+	if value := os.Getenv("POLICY_DEFAULT"); value != "" && value != policyDeny {
+		// les permissions des rôles s'appliquent toujours: POLICY_DEFAULT=allow n'existe plus
+		log.Printf("policies: POLICY_DEFAULT=%s is ignored, requests need an allow policy or a role permission", value)
+	}
+	return &policyEngine{db: db}
+}
+
+// watch vide le cache à chaque modification des politiques, sur tous les réplicas
+func (e *policyEngine) watch() {
+	invalidations, _ := bus.Subscribe(topicCacheInvalidate)
+	for name := range invalidations {
+		if name == "policies" {
+			e.mu.Lock()
+			e.loaded = false
+			e.mu.Unlock()
+		}
+	}
+}
+
+func invalidatePolicies() {
+	if err := bus.Publish(topicCacheInvalidate, "policies"); err != nil {
+		log.Printf("policies: cannot invalidate cache: %v", err)
+	}
+}
+
+func (e *policyEngine) active() ([]compiledPolicy, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.loaded {
+		return e.policies, nil
+	}
+
+	var stored []Policy
+	if err := e.db.Where("enabled = ?", true).Order("id").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	fromFile, err := loadPolicyFile(os.Getenv("POLICY_FILE"))
+	if err != nil {
+		log.Printf("policies: %v", err)
+	}
+
+	e.policies = nil
+	for _, policy := range append(fromFile, stored...) {
+		compiled, err := compilePolicy(policy)
+		if err != nil {
+			log.Printf("policies: skipping %q: %v", policy.Name, err)
+			continue
+		}
+		e.policies = append(e.policies, compiled)
+	}
+	e.loaded = true
+	return e.policies, nil
+}
+
+// loadPolicyFile lit un tableau JSON de politiques; elles sont toutes actives et non modifiables par l'API
+func loadPolicyFile(path string) ([]Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var fromFile []Policy
+	if err := json.Unmarshal(data, &fromFile); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range fromFile {
+		fromFile[i].Enabled = true
+		fromFile[i].Source = "file"
+	}
+	return fromFile, nil
+}
+
+// decide combine politiques et permissions des rôles: une politique deny l'emporte, puis une
+// politique allow, puis une permission. Une politique deny dont la condition échoue refuse l'accès.
+func decide(set []compiledPolicy, subject *authzSubject, action, resource string, input policyInput) authzDecision {
+	var allowedBy *compiledPolicy
+	for i, policy := range set {
+		applies, err := policy.applies(action, resource, input)
+		if err != nil && policy.Effect == policyDeny {
+			return authzDecision{UserID: subject.User.ID, Action: action, Resource: resource, Policy: policy.Name,
+				Reason: fmt.Sprintf("policy %q could not be evaluated: %v", policy.Name, err)}
+		}
+		if !applies {
+			continue
+		}
+		if policy.Effect == policyDeny {
+			return authzDecision{UserID: subject.User.ID, Action: action, Resource: resource, Policy: policy.Name,
+				Reason: fmt.Sprintf("denied by policy %q", policy.Name)}
+		}
+		if allowedBy == nil {
+			allowedBy = &set[i]
+		}
+	}
+	if allowedBy != nil {
+		return authzDecision{UserID: subject.User.ID, Action: action, Resource: resource, Allowed: true, Policy: allowedBy.Name,
+			Reason: fmt.Sprintf("allowed by policy %q", allowedBy.Name)}
+	}
+	decision := subject.check(action, resource)
+	if !decision.Allowed {
+		// délégation: les propriétaires d'un groupe administrent son sous-arbre (voir group_owners.go)
+		if owned, ok := subject.checkOwnership(action, resource); ok {
+			return owned
+		}
+	}
+	return decision
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Attributs
+
+func subjectAttributes(subject *authzSubject) map[string]interface{} {
+	groupIDs := make([]int64, len(subject.Groups))
+	for i, group := range subject.Groups {
+		groupIDs[i] = int64(group.ID)
+	}
+	var managerID uint
+	if subject.User.ManagerID != nil {
+		managerID = *subject.User.ManagerID
+	}
+	return map[string]interface{}{
+		"id":              int64(subject.User.ID),
+		"name":            subject.User.Name,
+		"email":           subject.User.Email,
+		"roles":           subject.roleNames(),
+		"groups":          subject.groupNames(),
+		"group_ids":       groupIDs,
+		"organization_id": int64(subject.User.OrganizationID),
+		"status":          subject.User.currentStatus(),
+		"owned_group_ids": subject.ownedGroupIDs(),
+		"attributes":      subject.User.attributeValues(),
+		"manager_id":      int64(managerID),
+		"manager_ids":     managerIDs(subject.Managers),
+	}
+}
+
+// checkInput construit l'entrée d'une vérification hors requête HTTP (authz check, policies test)
+func checkInput(subject *authzSubject, attributes map[string]interface{}, action, resource string, body map[string]interface{}) policyInput {
+	if body == nil {
+		body = map[string]interface{}{}
+	}
+	return policyInput{
+		Subject:  subjectAttributes(subject),
+		Resource: attributes,
+		Action:   action,
+		Request:  map[string]interface{}{"method": "", "path": "/" + resource, "body": body},
+	}
+}
+
+// parseResourceRef découpe "groups/3" en ("groups", 3)
+func parseResourceRef(resource string) (string, uint) {
+	parts := strings.SplitN(resource, "/", 2)
+	if len(parts) == 2 {
+		if id, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+			return parts[0], uint(id)
+		}
+	}
+	return parts[0], 0
+}
+
+// resourceAttributes charge les attributs de la ressource visée; une ressource introuvable n'a que type et id
+func resourceAttributes(db *gorm.DB, resourceType string, id uint) (map[string]interface{}, error) {
+	attributes := map[string]interface{}{"type": resourceType, "id": int64(id)}
+	if id == 0 {
+		return attributes, nil
+	}
+
+	switch resourceType {
+	case "users":
+		var user User
+		if err := db.First(&user, id).Error; err != nil {
+			return attributes, ignoreNotFound(err)
+		}
+		target, err := loadAuthzSubject(db, user)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range subjectAttributes(target) {
+			attributes[key] = value
+		}
+	case "groups":
+		var group Group
+		if err := db.First(&group, id).Error; err != nil {
+			return attributes, ignoreNotFound(err)
+		}
+		lineage, err := withAncestors(db, []Group{group})
+		if err != nil {
+			return nil, err
+		}
+		groupIDs := make([]int64, len(lineage))
+		for i, g := range lineage {
+			groupIDs[i] = int64(g.ID)
+		}
+		attributes["name"] = group.Name
+		attributes["organization_id"] = int64(group.OrganizationID)
+		attributes["parent_group_id"] = int64(0)
+		if group.ParentGroupID != nil {
+			attributes["parent_group_id"] = int64(*group.ParentGroupID)
+		}
+		attributes["group_ids"] = groupIDs
+	case "roles":
+		var role Role
+		if err := db.First(&role, id).Error; err != nil {
+			return attributes, ignoreNotFound(err)
+		}
+		attributes["name"] = role.Name
+		attributes["organization_id"] = int64(role.OrganizationID)
+		attributes["permissions"] = []string(role.Permissions)
+	}
+	return attributes, nil
+}
+
+func ignoreNotFound(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	}
+	return err
+}
+
+// actionForMethod traduit la méthode HTTP en action
+func actionForMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "read"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut, http.MethodPatch:
+		return "update"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return strings.ToLower(method)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Middleware
+
+// enforcePolicies applique les politiques et les permissions des rôles aux routes de resourceType, après requireAuth:
+// il faut une politique allow, une permission de rôle ou la propriété du groupe, et aucune politique deny.
+func enforcePolicies(db *gorm.DB, resourceType string) gin.HandlerFunc {
+	return enforcePoliciesFor(db, resourceType, "")
+}
+
+// enforcePoliciesFor est enforcePolicies avec une action fixe (ex: manage_members) au lieu de celle de la méthode HTTP
+func enforcePoliciesFor(db *gorm.DB, resourceType, action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+		action := action
+		if action == "" {
+			action = actionForMethod(c.Request.Method)
+		}
+		decision, err := authorize(db, c.MustGet("user").(User), resourceType, uint(id), action, requestAttributes(c))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Error checking permissions"})
+			return
+		}
+		if !decision.Allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden", "reason": decision.Reason})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorize décide si user peut faire action sur resourceType/id (id 0: la collection). C'est la vérification de
+// enforcePolicies, reprise par les resolvers GraphQL et l'interceptor gRPC; request est le request des conditions.
+func authorize(db *gorm.DB, user User, resourceType string, id uint, action string, request map[string]interface{}) (authzDecision, error) {
+	set, err := policies.active()
+	if err != nil {
+		return authzDecision{}, err
+	}
+	subject, err := loadAuthzSubject(db, user)
+	if err != nil {
+		return authzDecision{}, err
+	}
+	resource := resourceType
+	if id != 0 {
+		resource = fmt.Sprintf("%s/%d", resourceType, id)
+	}
+	attributes, err := resourceAttributes(db, resourceType, id)
+	if err != nil {
+		return authzDecision{}, err
+	}
+	return decide(set, subject, action, resource, policyInput{
+		Subject:  subjectAttributes(subject),
+		Resource: attributes,
+		Action:   action,
+		Request:  request,
+	}), nil
+}
+
+// requestAttributes expose la méthode, le chemin et le corps JSON (remis en place pour le handler)
+func requestAttributes(c *gin.Context) map[string]interface{} {
+	body := map[string]interface{}{}
+	if c.Request.Body != nil && strings.HasPrefix(c.ContentType(), "application/json") {
+		data, err := io.ReadAll(c.Request.Body)
+		if err == nil {
+			json.Unmarshal(data, &body)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+	}
+	return map[string]interface{}{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+		"body":   body,
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint policies
+
+// getPoliciesList donne les politiques de la base puis celles de POLICY_FILE (source "file")
+func getPoliciesList(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var stored []Policy
+		if err := db.Order("id").Find(&stored).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching policies"})
+			return
+		}
+		fromFile, err := loadPolicyFile(os.Getenv("POLICY_FILE"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading policy file"})
+			return
+		}
+		c.JSON(http.StatusOK, append(stored, fromFile...))
+	}
+}
+
+// getPolicy fetches a single policy by its ID
+func getPolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policy Policy
+		if err := db.Where("id = ?", c.Param("id")).First(&policy).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+			return
+		}
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// createPolicy crée une politique après avoir compilé sa condition
+func createPolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy := Policy{Enabled: true}
+		if err := c.BindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy data"})
+			return
+		}
+		policy.Source = ""
+		if _, err := compilePolicy(policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := db.Create(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating policy"})
+			return
+		}
+		invalidatePolicies()
+		recordAudit(db, c, "policy.create", "policy", policy.ID, nil, policy)
+		c.JSON(http.StatusCreated, policy)
+	}
+}
+
+// updatePolicy met à jour une politique existante
+func updatePolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policy Policy
+		if err := db.Where("id = ?", c.Param("id")).First(&policy).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+			return
+		}
+		before := policy
+
+		if err := c.BindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy data"})
+			return
+		}
+		policy.Source = ""
+		if _, err := compilePolicy(policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := db.Save(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating policy"})
+			return
+		}
+		invalidatePolicies()
+		recordAudit(db, c, "policy.update", "policy", policy.ID, before, policy)
+		c.JSON(http.StatusOK, policy)
+	}
+}
+
+// deletePolicy supprime une politique par son ID
+func deletePolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policy Policy
+		if err := db.Where("id = ?", c.Param("id")).First(&policy).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+			return
+		}
+
+		if err := db.Delete(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting policy"})
+			return
+		}
+		invalidatePolicies()
+		recordAudit(db, c, "policy.delete", "policy", policy.ID, policy, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Policy deleted"})
+	}
+}
+
+type policyTestCase struct {
+	Name     string                 `json:"name"`
+	User     string                 `json:"user"` // ID ou email
+	Action   string                 `json:"action"`
+	Resource string                 `json:"resource"` // ex: users/3
+	Body     map[string]interface{} `json:"body"`
+	Expect   string                 `json:"expect"` // allow, deny ou vide
+}
+
+// testPolicies évalue des cas sans rien modifier, avec les politiques actives ou celles fournies
+// ({"policies": [...], "cases": [...]}) pour valider un brouillon avant de l'enregistrer
+func testPolicies(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var body struct {
+			Policies []Policy         `json:"policies"`
+			Cases    []policyTestCase `json:"cases"`
+		}
+		if err := c.BindJSON(&body); err != nil || len(body.Cases) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid policy test"})
+			return
+		}
+
+		set, err := policies.active()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading policies"})
+			return
+		}
+		if body.Policies != nil {
+			set = nil
+			for _, policy := range body.Policies {
+				compiled, err := compilePolicy(policy)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("policy %q: %v", policy.Name, err)})
+					return
+				}
+				set = append(set, compiled)
+			}
+		}
+
+		results := make([]gin.H, len(body.Cases))
+		for i, tc := range body.Cases {
+			user, err := findUserByRef(db, tc.User)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("case %d: unknown user %q", i+1, tc.User)})
+				return
+			}
+			subject, err := loadAuthzSubject(db, user)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching roles"})
+				return
+			}
+			resourceType, id := parseResourceRef(tc.Resource)
+			attributes, err := resourceAttributes(db, resourceType, id)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching resource"})
+				return
+			}
+			decision := decide(set, subject, tc.Action, tc.Resource, checkInput(subject, attributes, tc.Action, tc.Resource, tc.Body))
+			result := gin.H{"name": tc.Name, "decision": decision}
+			if tc.Expect != "" {
+				result["pass"] = (tc.Expect == policyAllow) == decision.Allowed
+			}
+			results[i] = result
+		}
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
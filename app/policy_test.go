@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustCompilePolicy(t *testing.T, policy Policy) compiledPolicy {
+	t.Helper()
+	compiled, err := compilePolicy(policy)
+	if err != nil {
+		t.Fatalf("compile %s: %v", policy.Name, err)
+	}
+	return compiled
+}
+
+func testSubject(roles ...Role) *authzSubject {
+	subject := &authzSubject{User: User{ID: 7, Name: "Bob"}}
+	for _, role := range roles {
+		subject.Roles = append(subject.Roles, grantedRole{Role: role})
+	}
+	return subject
+}
+
+var (
+	adminRole  = Role{ID: 1, Name: "Admin", Permissions: []string{"*:*"}}
+	editorRole = Role{ID: 2, Name: "Editor", Permissions: []string{"read:*", "create:*", "update:*"}}
+	viewerRole = Role{ID: 3, Name: "Viewer", Permissions: []string{"read:*"}}
+)
+
+func TestDecideRolePermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		subject  *authzSubject
+		action   string
+		resource string
+		allowed  bool
+		reason   string
+	}{
+		{"viewer reads", testSubject(viewerRole), "read", "users/2", true, `permission "read:*" of role "Viewer"`},
+		{"viewer cannot update", testSubject(viewerRole), "update", "users/2", false, "no permission of roles Viewer"},
+		{"editor updates", testSubject(editorRole), "update", "groups/3", true, `permission "update:*" of role "Editor"`},
+		{"editor cannot assign roles", testSubject(editorRole), "assign", "roles/1", false, "no permission of roles Editor"},
+		{"admin assigns roles", testSubject(adminRole), "assign", "roles/1", true, `permission "*:*" of role "Admin"`},
+		{"no role", testSubject(), "read", "users/2", false, "user has no role"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := decide(nil, tt.subject, tt.action, tt.resource, policyInput{})
+			if decision.Allowed != tt.allowed || !strings.Contains(decision.Reason, tt.reason) {
+				t.Errorf("decision = %v (%s), want %v (%s)", decision.Allowed, decision.Reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestDecidePolicies(t *testing.T) {
+	denyDeletes := mustCompilePolicy(t, Policy{Name: "deny-deletes", Effect: policyDeny, Actions: []string{"delete"}, Resources: []string{"users/*"}})
+	allowSelf := mustCompilePolicy(t, Policy{Name: "self-update", Effect: policyAllow, Actions: []string{"update"}, Resources: []string{"users/*"},
+		Condition: "subject.id == resource.id"})
+	broken := mustCompilePolicy(t, Policy{Name: "broken", Effect: policyDeny, Actions: []string{"read"}, Resources: []string{"*"},
+		Condition: "resource.missing == 1"})
+
+	input := func(resourceID int64) policyInput {
+		return policyInput{
+			Subject:  map[string]interface{}{"id": int64(7)},
+			Resource: map[string]interface{}{"type": "users", "id": resourceID},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		set      []compiledPolicy
+		subject  *authzSubject
+		action   string
+		resource string
+		input    policyInput
+		allowed  bool
+		reason   string
+	}{
+		{"deny wins over role", []compiledPolicy{denyDeletes}, testSubject(adminRole), "delete", "users/2", input(2), false, `denied by policy "deny-deletes"`},
+		{"deny wins over allow", []compiledPolicy{allowSelf, denyDeletes}, testSubject(), "delete", "users/7", input(7), false, `denied by policy "deny-deletes"`},
+		{"allow without role", []compiledPolicy{allowSelf}, testSubject(viewerRole), "update", "users/7", input(7), true, `allowed by policy "self-update"`},
+		{"condition not met falls back to roles", []compiledPolicy{allowSelf}, testSubject(viewerRole), "update", "users/2", input(2), false, "no permission of roles Viewer"},
+		{"deny that cannot be evaluated refuses", []compiledPolicy{broken}, testSubject(adminRole), "read", "users/2", input(2), false, `policy "broken" could not be evaluated`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := decide(tt.set, tt.subject, tt.action, tt.resource, tt.input)
+			if decision.Allowed != tt.allowed || !strings.Contains(decision.Reason, tt.reason) {
+				t.Errorf("decision = %v (%s), want %v (%s)", decision.Allowed, decision.Reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
+
+func TestDecideGroupOwners(t *testing.T) {
+	sales := Group{ID: 3, Name: "Sales"}
+	owner := testSubject(viewerRole)
+	owner.OwnedGroups = map[uint]Group{3: sales, 4: sales, 5: sales}
+	owner.OwnedRoles = map[uint][]Role{4: {adminRole}, 5: {viewerRole}}
+
+	tests := []struct {
+		name     string
+		subject  *authzSubject
+		action   string
+		resource string
+		allowed  bool
+		reason   string
+	}{
+		{"owner manages members", owner, "manage_members", "groups/3", true, `owner of group "Sales"`},
+		{"owner creates subgroups", owner, "create_subgroup", "groups/3", true, `owner of group "Sales"`},
+		{"owner cannot rename", owner, "update", "groups/3", false, "no permission of roles Viewer"},
+		{"not an owned group", owner, "manage_members", "groups/9", false, "no permission of roles Viewer"},
+		{"group gives a role the owner lacks", owner, "manage_members", "groups/4", false, `group grants role "Admin"`},
+		{"approving is refused as well", owner, "approve", "groups/4", false, `group grants role "Admin"`},
+		{"group gives a role the owner holds", owner, "manage_members", "groups/5", true, `owner of group "Sales"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := decide(nil, tt.subject, tt.action, tt.resource, policyInput{})
+			if decision.Allowed != tt.allowed || !strings.Contains(decision.Reason, tt.reason) {
+				t.Errorf("decision = %v (%s), want %v (%s)", decision.Allowed, decision.Reason, tt.allowed, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+// Topics du bus d'événements
+const (
+	topicOutbox          = "outbox"           // un événement a été ajouté à l'outbox (payload vide)
+	topicChanges         = "changes"          // un événement a été distribué, pour les flux SSE (payload: ID)
+	topicCacheInvalidate = "cache_invalidate" // un cache local doit être vidé (payload: nom du cache)
+)
+
+// PubSub relie les réplicas de l'API: ce qui est publié sur un réplica est reçu par tous
+type PubSub interface {
+	// Publish envoie immédiatement le message
+	Publish(topic string, payload string) error
+	// PublishTx n'envoie le message qu'au commit de tx (quand l'implémentation le permet)
+	PublishTx(tx *gorm.DB, topic string, payload string) error
+	// Subscribe retourne les messages du topic et la fonction pour se désabonner
+	Subscribe(topic string) (<-chan string, func())
+}
+
+var bus PubSub = newMemoryPubSub()
+
+// newPubSub choisit l'implémentation selon PUBSUB_DRIVER (postgres par défaut, ou memory pour un seul réplica)
+func newPubSub(db *gorm.DB, connStr string) PubSub {
+	if getenvDefault("PUBSUB_DRIVER", "postgres") == "memory" {
+		return newMemoryPubSub()
+	}
+	return newPostgresPubSub(db, connStr)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Implémentation en mémoire
+
+type memoryPubSub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan string]struct{}
+}
+
+func newMemoryPubSub() *memoryPubSub {
+	return &memoryPubSub{subscribers: map[string]map[chan string]struct{}{}}
+}
+
+func (p *memoryPubSub) Publish(topic string, payload string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch := range p.subscribers[topic] {
+		select {
+		case ch <- payload:
+		default:
+			log.Printf("pubsub: subscriber of %s is too slow, message dropped", topic)
+		}
+	}
+	return nil
+}
+
+// PublishTx publie tout de suite: sans transaction partagée, les abonnés doivent tolérer
+// un message reçu avant le commit (les lecteurs de l'outbox repassent de toute façon périodiquement)
+func (p *memoryPubSub) PublishTx(tx *gorm.DB, topic string, payload string) error {
+	return p.Publish(topic, payload)
+}
+
+func (p *memoryPubSub) Subscribe(topic string) (<-chan string, func()) {
+	ch := make(chan string, 1024)
+	p.mu.Lock()
+	if p.subscribers[topic] == nil {
+		p.subscribers[topic] = map[chan string]struct{}{}
+	}
+	p.subscribers[topic][ch] = struct{}{}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			delete(p.subscribers[topic], ch)
+			p.mu.Unlock()
+		})
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Implémentation PostgreSQL LISTEN/NOTIFY
+
+// postgresPubSub publie avec pg_notify et écoute avec une connexion dédiée (pq.Listener).
+// Un NOTIFY exécuté dans une transaction n'est délivré qu'au commit.
+type postgresPubSub struct {
+	db       *gorm.DB
+	listener *pq.Listener
+	local    *memoryPubSub
+
+	mu        sync.Mutex
+	listening map[string]bool
+}
+
+func newPostgresPubSub(db *gorm.DB, connStr string) *postgresPubSub {
+	p := &postgresPubSub{db: db, local: newMemoryPubSub(), listening: map[string]bool{}}
+	p.listener = pq.NewListener(connStr, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("pubsub: listener: %v", err)
+		}
+	})
+	go p.run()
+	return p
+}
+
+func (p *postgresPubSub) run() {
+	for n := range p.listener.Notify {
+		// n est nil après une reconnexion: des messages ont pu être perdus, on vide tous les caches et
+		// on réveille le dispatcher; les flux SSE rattrapent via Last-Event-ID
+		if n == nil {
+			p.local.Publish(topicCacheInvalidate, "webhooks")
+			p.local.Publish(topicCacheInvalidate, "policies")
+			p.local.Publish(topicCacheInvalidate, "group_rules")
+			p.local.Publish(topicOutbox, "")
+			continue
+		}
+		p.local.Publish(n.Channel, n.Extra)
+	}
+}
+
+func (p *postgresPubSub) Publish(topic string, payload string) error {
+	return p.db.Exec("SELECT pg_notify(?, ?)", topic, payload).Error
+}
+
+func (p *postgresPubSub) PublishTx(tx *gorm.DB, topic string, payload string) error {
+	return tx.Exec("SELECT pg_notify(?, ?)", topic, payload).Error
+}
+
+func (p *postgresPubSub) Subscribe(topic string) (<-chan string, func()) {
+	p.mu.Lock()
+	if !p.listening[topic] {
+		if err := p.listener.Listen(topic); err != nil {
+			log.Printf("pubsub: cannot listen on %s: %v", topic, err)
+		} else {
+			p.listening[topic] = true
+		}
+	}
+	p.mu.Unlock()
+	return p.local.Subscribe(topic)
+}
@@ -0,0 +1,1524 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	scimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	scimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaSPConfig     = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimSchemaSchema       = "urn:ietf:params:scim:schemas:core:2.0:Schema"
+	scimSchemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	scimContentType  = "application/scim+json"
+	scimMaxPageCount = 1000
+)
+
+type scimMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location"`
+}
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimMultiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// scimUser est la représentation SCIM d'un User (userName = email)
+type scimUser struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	UserName    string           `json:"userName"`
+	Name        *scimName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Emails      []scimMultiValue `json:"emails,omitempty"`
+	Active      *bool            `json:"active,omitempty"`
+	Password    string           `json:"password,omitempty"`
+	Groups      []scimMultiValue `json:"groups,omitempty"`
+	Meta        *scimMeta        `json:"meta,omitempty"`
+}
+
+// scimGroup est la représentation SCIM d'un Group, les membres viennent de user_groups
+type scimGroup struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	DisplayName string           `json:"displayName"`
+	Members     []scimMultiValue `json:"members,omitempty"`
+	Meta        *scimMeta        `json:"meta,omitempty"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string `json:"schemas"`
+	Operations []struct {
+		Op    string          `json:"op"`
+		Path  string          `json:"path"`
+		Value json.RawMessage `json:"value"`
+	} `json:"Operations"`
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Auth et réponses SCIM
+
+// requireSCIMToken vérifie le bearer token partagé avec le fournisseur d'identité (SCIM_TOKEN); SCIM reste fermé tant qu'il est vide
+func requireSCIMToken(c *gin.Context) {
+	expected := os.Getenv("SCIM_TOKEN")
+	header := c.GetHeader("Authorization")
+	token := strings.TrimPrefix(header, "Bearer ")
+
+	if expected == "" || token == header || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		scimError(c, http.StatusUnauthorized, "", "Invalid or missing bearer token")
+		c.Abort()
+		return
+	}
+	c.Set("actor", "scim")
+	c.Set("org", envOrganizationID("SCIM_ORGANIZATION_ID"))
+	c.Next()
+}
+
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Data(status, scimContentType, data)
+}
+
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{scimSchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	scimJSON(c, status, body)
+}
+
+func scimLocation(c *gin.Context, resource, id string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%s", scheme, c.Request.Host, resource, id)
+}
+
+// scimPage lit startIndex et count (RFC 7644 §3.4.2.4) et retourne la tranche à renvoyer
+func scimPage(c *gin.Context, total int) (startIndex, from, to int) {
+	startIndex, err := strconv.Atoi(c.DefaultQuery("startIndex", "1"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.DefaultQuery("count", "100"))
+	if err != nil || count < 0 {
+		count = 100
+	}
+	if count > scimMaxPageCount {
+		count = scimMaxPageCount
+	}
+
+	from = startIndex - 1
+	if from > total {
+		from = total
+	}
+	to = from + count
+	if to > total {
+		to = total
+	}
+	return startIndex, from, to
+}
+
+func scimListResponse(c *gin.Context, resources []interface{}) {
+	filter, err := parseSCIMFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	matched := make([]interface{}, 0, len(resources))
+	for _, resource := range resources {
+		if filter == nil || filter.matches(scimAsMap(resource)) {
+			matched = append(matched, resource)
+		}
+	}
+
+	startIndex, from, to := scimPage(c, len(matched))
+	scimPageResponse(c, len(matched), startIndex, matched[from:to])
+}
+
+// scimPageResponse envoie une page de resources sur total résultats
+func scimPageResponse(c *gin.Context, total, startIndex int, resources []interface{}) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":      []string{scimSchemaListResponse},
+		"totalResults": total,
+		"startIndex":   startIndex,
+		"itemsPerPage": len(resources),
+		"Resources":    resources,
+	})
+}
+
+func scimAsMap(resource interface{}) map[string]interface{} {
+	data, _ := json.Marshal(resource)
+	var m map[string]interface{}
+	json.Unmarshal(data, &m)
+	return m
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint SCIM Users
+
+func toSCIMUser(c *gin.Context, user User) scimUser {
+	active := user.currentStatus() == statusActive
+	id := strconv.FormatUint(uint64(user.ID), 10)
+	result := scimUser{
+		Schemas:     []string{scimSchemaUser},
+		ID:          id,
+		UserName:    user.Email,
+		Name:        &scimName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []scimMultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+			Location:     scimLocation(c, "Users", id),
+		},
+	}
+	for _, group := range user.Groups {
+		if group.DeletedAt != nil {
+			continue
+		}
+		result.Groups = append(result.Groups, scimMultiValue{Value: strconv.FormatUint(uint64(group.ID), 10), Display: group.Name})
+	}
+	return result
+}
+
+// displayName retourne le nom affichable envoyé par le fournisseur
+func (u scimUser) displayName() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	if u.Name != nil {
+		if u.Name.Formatted != "" {
+			return u.Name.Formatted
+		}
+		return strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName)
+	}
+	return ""
+}
+
+func (u scimUser) email() string {
+	if u.UserName != "" {
+		return u.UserName
+	}
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+// raison des désactivations faites par le fournisseur SCIM (active=false)
+const scimStatusReason = "deactivated by SCIM provider"
+
+func findSCIMUser(db *gorm.DB, id string) (User, bool) {
+	var user User
+	if err := db.Preload("Groups").Where("id = ?", id).First(&user).Error; err != nil {
+		return user, false
+	}
+	return user, true
+}
+
+// getSCIMUsers filtre et pagine en base: le filtre est traduit en SQL (scimUserFilterSQL)
+func getSCIMUsers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		filter, err := parseSCIMFilter(c.Query("filter"))
+		if err != nil {
+			scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+			return
+		}
+		query := db.Model(&User{})
+		if filter != nil {
+			where, args, err := scimUserFilterSQL(filter)
+			if err != nil {
+				scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+				return
+			}
+			query = query.Where(where, args...)
+		}
+
+		var total int
+		if err := query.Count(&total).Error; err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error fetching users")
+			return
+		}
+		startIndex, from, to := scimPage(c, total)
+		users := []User{}
+		if to > from {
+			if err := query.Preload("Groups").Order("id").Offset(from).Limit(to - from).Find(&users).Error; err != nil {
+				scimError(c, http.StatusInternalServerError, "", "Error fetching users")
+				return
+			}
+		}
+		resources := make([]interface{}, 0, len(users))
+		for _, user := range users {
+			resources = append(resources, toSCIMUser(c, user))
+		}
+		scimPageResponse(c, total, startIndex, resources)
+	}
+}
+
+func getSCIMUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user, ok := findSCIMUser(db, c.Param("id"))
+		if !ok {
+			scimError(c, http.StatusNotFound, "", "User not found")
+			return
+		}
+		scimJSON(c, http.StatusOK, toSCIMUser(c, user))
+	}
+}
+
+func createSCIMUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body scimUser
+		if err := c.ShouldBindJSON(&body); err != nil || body.email() == "" {
+			scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+			return
+		}
+
+		// les emails sont uniques sur tout le déploiement: la vérification n'est pas limitée à l'organisation
+		var existing User
+		if db.Unscoped().Where("email = ?", body.email()).First(&existing).Error == nil {
+			scimError(c, http.StatusConflict, "uniqueness", "userName already exists")
+			return
+		}
+		db := tenantDB(c, db)
+
+		user := User{Name: body.displayName(), Email: body.email()}
+		if body.Active != nil && !*body.Active {
+			now := time.Now()
+			user.Status, user.StatusReason, user.StatusChangedAt = statusDeactivated, scimStatusReason, &now
+		}
+		if body.Password != "" {
+			hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), 10)
+			if err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", "Invalid password")
+				return
+			}
+			user.Password = string(hash)
+		}
+		if err := validateUserAttributes(db, &user); err != nil {
+			if invalid, ok := err.(*attributeError); ok && invalid.status == http.StatusConflict {
+				scimError(c, http.StatusConflict, "uniqueness", invalid.message)
+			} else if ok {
+				scimError(c, http.StatusBadRequest, "invalidValue", invalid.message)
+			} else {
+				scimError(c, http.StatusInternalServerError, "", "Error creating user")
+			}
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			if err := enqueueEvent(tx, "user.created", "user", user.ID, user); err != nil {
+				return err
+			}
+			return applyMembershipRules(tx, user)
+		})
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error creating user")
+			return
+		}
+
+		user, _ = findSCIMUser(db, strconv.FormatUint(uint64(user.ID), 10))
+		recordAudit(db, c, "user.create", "user", user.ID, nil, user)
+		scimJSON(c, http.StatusCreated, toSCIMUser(c, user))
+	}
+}
+
+func replaceSCIMUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user, ok := findSCIMUser(db, c.Param("id"))
+		if !ok {
+			scimError(c, http.StatusNotFound, "", "User not found")
+			return
+		}
+		before := user
+
+		var body scimUser
+		if err := c.ShouldBindJSON(&body); err != nil || body.email() == "" {
+			scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+			return
+		}
+
+		active := body.Active == nil || *body.Active
+		if err := applySCIMUserChanges(db, &user, body.displayName(), body.email(), body.Password, &active); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+
+		user, _ = findSCIMUser(db, c.Param("id"))
+		recordAudit(db, c, "user.update", "user", user.ID, before, user)
+		scimJSON(c, http.StatusOK, toSCIMUser(c, user))
+	}
+}
+
+func patchSCIMUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user, ok := findSCIMUser(db, c.Param("id"))
+		if !ok {
+			scimError(c, http.StatusNotFound, "", "User not found")
+			return
+		}
+		before := user
+
+		var body scimPatchRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid PATCH request")
+			return
+		}
+
+		name, email, password, clearPassword := user.Name, user.Email, "", false
+		var active *bool
+		for _, op := range body.Operations {
+			// remove (RFC 7644 §3.5.2.2): le path est obligatoire; userName et active ne peuvent pas être retirés,
+			// le nom retombe sur l'email et le mot de passe est effacé (connexion par le fournisseur uniquement)
+			if strings.EqualFold(op.Op, "remove") {
+				switch strings.ToLower(op.Path) {
+				case "":
+					scimError(c, http.StatusBadRequest, "noTarget", "remove requires a path")
+					return
+				case "username", "active":
+					scimError(c, http.StatusBadRequest, "mutability", op.Path+" cannot be removed")
+					return
+				case "displayname", "name", "name.formatted":
+					name = ""
+				case "password":
+					password, clearPassword = "", true
+				}
+				continue
+			}
+
+			values := map[string]json.RawMessage{}
+			if op.Path == "" {
+				// sans path, value contient les attributs à modifier
+				if err := json.Unmarshal(op.Value, &values); err != nil {
+					scimError(c, http.StatusBadRequest, "invalidValue", "Invalid PATCH value")
+					return
+				}
+			} else {
+				values[op.Path] = op.Value
+			}
+
+			for _, path := range scimSortedKeys(values) {
+				var value interface{}
+				json.Unmarshal(values[path], &value)
+
+				switch strings.ToLower(path) {
+				case "username":
+					email = fmt.Sprint(value)
+				case "displayname", "name.formatted":
+					name = fmt.Sprint(value)
+				case "name":
+					if m, ok := value.(map[string]interface{}); ok {
+						if formatted, ok := m["formatted"].(string); ok {
+							name = formatted
+						}
+					}
+				case "password":
+					password, clearPassword = fmt.Sprint(value), false
+				case "active":
+					b := value == true || strings.EqualFold(fmt.Sprint(value), "true")
+					active = &b
+				}
+			}
+		}
+		if name == "" {
+			name = email
+		}
+		if clearPassword {
+			if err := db.Model(&user).UpdateColumn("password", "").Error; err != nil {
+				scimError(c, http.StatusInternalServerError, "", "Error updating user")
+				return
+			}
+		}
+
+		if err := applySCIMUserChanges(db, &user, name, email, password, active); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+
+		user, _ = findSCIMUser(db, c.Param("id"))
+		recordAudit(db, c, "user.update", "user", user.ID, before, user)
+		scimJSON(c, http.StatusOK, toSCIMUser(c, user))
+	}
+}
+
+// applySCIMUserChanges enregistre les attributs SCIM; active=false désactive le compte (statut deactivated) et
+// active=true ne réactive qu'un compte désactivé, pas un compte suspendu ou expiré
+func applySCIMUserChanges(db *gorm.DB, user *User, name, email, password string, active *bool) error {
+	updates := map[string]interface{}{"name": name, "email": email}
+	if password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+		if err != nil {
+			return err
+		}
+		updates["password"] = string(hash)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := enqueueEvent(tx, "user.updated", "user", user.ID, user); err != nil {
+			return err
+		}
+		return applyMembershipRules(tx, *user)
+	})
+	if err == nil && active != nil {
+		if !*active && user.currentStatus() == statusActive {
+			err = setUserStatus(db, user, statusDeactivated, scimStatusReason, nil)
+		} else if *active && user.Status == statusDeactivated {
+			err = setUserStatus(db, user, statusActive, "", nil)
+		}
+	}
+	if err != nil {
+		return errors.New("Error updating user")
+	}
+	return nil
+}
+
+// deleteSCIMUser supprime l'utilisateur comme DELETE /users/:id (soft delete: invitations, sessions, demandes et
+// revues d'accès le référencent encore) et le retire de ses rôles et groupes; un GET suivant répond 404
+func deleteSCIMUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user, ok := findSCIMUser(db, c.Param("id"))
+		if !ok {
+			scimError(c, http.StatusNotFound, "", "User not found")
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, table := range []string{"user_roles", "user_groups", "auth_tokens", "refresh_tokens"} {
+				if err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", user.ID).Error; err != nil {
+					return err
+				}
+			}
+			return softDeleteUser(tx, user)
+		})
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error deleting user")
+			return
+		}
+		recordAudit(db, c, "user.delete", "user", user.ID, user, nil)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint SCIM Groups
+
+func toSCIMGroup(c *gin.Context, group Group, members []scimMultiValue) scimGroup {
+	id := strconv.FormatUint(uint64(group.ID), 10)
+	return scimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		ID:          id,
+		DisplayName: group.Name,
+		Members:     members,
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      group.CreatedAt,
+			LastModified: group.UpdatedAt,
+			Location:     scimLocation(c, "Groups", id),
+		},
+	}
+}
+
+// scimGroupMembers charge les membres de plusieurs groupes en une requête
+func scimGroupMembers(db *gorm.DB, groupIDs []uint) (map[uint][]scimMultiValue, error) {
+	members := make(map[uint][]scimMultiValue)
+	if len(groupIDs) == 0 {
+		return members, nil
+	}
+
+	rows, err := db.Raw(`SELECT user_groups.group_id, users.id, users.name FROM user_groups
+		JOIN users ON users.id = user_groups.user_id
+		WHERE user_groups.group_id IN (?)
+		AND user_groups.valid_from <= ? AND (user_groups.valid_until IS NULL OR user_groups.valid_until > ?)
+		ORDER BY users.id`, groupIDs, time.Now(), time.Now()).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var groupID, userID uint
+		var name string
+		if err := rows.Scan(&groupID, &userID, &name); err != nil {
+			return nil, err
+		}
+		members[groupID] = append(members[groupID], scimMultiValue{Value: strconv.FormatUint(uint64(userID), 10), Display: name})
+	}
+	return members, rows.Err()
+}
+
+func getSCIMGroups(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var groups []Group
+		if err := db.Order("id").Find(&groups).Error; err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error fetching groups")
+			return
+		}
+
+		ids := make([]uint, 0, len(groups))
+		for _, group := range groups {
+			ids = append(ids, group.ID)
+		}
+		members, err := scimGroupMembers(db, ids)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error fetching group members")
+			return
+		}
+
+		excludeMembers := strings.Contains(c.Query("excludedAttributes"), "members")
+		resources := make([]interface{}, 0, len(groups))
+		for _, group := range groups {
+			if excludeMembers {
+				resources = append(resources, toSCIMGroup(c, group, nil))
+			} else {
+				resources = append(resources, toSCIMGroup(c, group, members[group.ID]))
+			}
+		}
+		scimListResponse(c, resources)
+	}
+}
+
+func getSCIMGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var group Group
+		if err := db.Where("id = ?", c.Param("id")).First(&group).Error; err != nil {
+			scimError(c, http.StatusNotFound, "", "Group not found")
+			return
+		}
+		members, err := scimGroupMembers(db, []uint{group.ID})
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error fetching group members")
+			return
+		}
+		scimJSON(c, http.StatusOK, toSCIMGroup(c, group, members[group.ID]))
+	}
+}
+
+func createSCIMGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var body scimGroup
+		if err := c.ShouldBindJSON(&body); err != nil || body.DisplayName == "" {
+			scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+			return
+		}
+
+		var existing Group
+		if db.Where("name = ?", body.DisplayName).First(&existing).Error == nil {
+			scimError(c, http.StatusConflict, "uniqueness", "displayName already exists")
+			return
+		}
+
+		group := Group{Name: body.DisplayName}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+			if err := setSCIMGroupMembers(tx, group.ID, body.Members); err != nil {
+				return err
+			}
+			if err := enqueueEvent(tx, "group.created", "group", group.ID, group); err != nil {
+				return err
+			}
+			return enqueueMembershipEvent(tx, group.ID)
+		})
+		if err == errSCIMInvalidValue || err == errSCIMUnknownMember {
+			scimError(c, http.StatusBadRequest, "invalidValue", "Unknown member")
+			return
+		}
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error creating group")
+			return
+		}
+
+		members, _ := scimGroupMembers(db, []uint{group.ID})
+		recordAudit(db, c, "group.create", "group", group.ID, nil, toSCIMGroup(c, group, members[group.ID]))
+		scimJSON(c, http.StatusCreated, toSCIMGroup(c, group, members[group.ID]))
+	}
+}
+
+func replaceSCIMGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var group Group
+		if err := db.Where("id = ?", c.Param("id")).First(&group).Error; err != nil {
+			scimError(c, http.StatusNotFound, "", "Group not found")
+			return
+		}
+		previous, _ := scimGroupMembers(db, []uint{group.ID})
+		before := toSCIMGroup(c, group, previous[group.ID])
+
+		var body scimGroup
+		if err := c.ShouldBindJSON(&body); err != nil || body.DisplayName == "" {
+			scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&group).Update("name", body.DisplayName).Error; err != nil {
+				return err
+			}
+			if err := setSCIMGroupMembers(tx, group.ID, body.Members); err != nil {
+				return err
+			}
+			if err := enqueueEvent(tx, "group.updated", "group", group.ID, group); err != nil {
+				return err
+			}
+			return enqueueMembershipEvent(tx, group.ID)
+		})
+		if err == errSCIMInvalidValue || err == errSCIMUnknownMember {
+			scimError(c, http.StatusBadRequest, "invalidValue", "Unknown member")
+			return
+		}
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error updating group")
+			return
+		}
+
+		members, _ := scimGroupMembers(db, []uint{group.ID})
+		recordAudit(db, c, "group.update", "group", group.ID, before, toSCIMGroup(c, group, members[group.ID]))
+		scimJSON(c, http.StatusOK, toSCIMGroup(c, group, members[group.ID]))
+	}
+}
+
+// scimMemberPath reconnaît les chemins du type members[value eq "42"]
+var scimMemberPath = regexp.MustCompile(`(?i)^members\[\s*value\s+eq\s+"?([^"\]]+)"?\s*\]$`)
+
+func patchSCIMGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var group Group
+		if err := db.Where("id = ?", c.Param("id")).First(&group).Error; err != nil {
+			scimError(c, http.StatusNotFound, "", "Group not found")
+			return
+		}
+		previous, _ := scimGroupMembers(db, []uint{group.ID})
+		before := toSCIMGroup(c, group, previous[group.ID])
+
+		var body scimPatchRequest
+		if err := c.ShouldBindJSON(&body); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid PATCH request")
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			renamed, membersChanged := false, false
+			for _, op := range body.Operations {
+				operation := strings.ToLower(op.Op)
+				path := strings.ToLower(op.Path)
+
+				if match := scimMemberPath.FindStringSubmatch(op.Path); match != nil && operation == "remove" {
+					if err := removeSCIMGroupMember(tx, group.ID, match[1]); err != nil {
+						return err
+					}
+					membersChanged = true
+					continue
+				}
+
+				switch {
+				case path == "displayname":
+					var name string
+					if err := json.Unmarshal(op.Value, &name); err != nil {
+						return errSCIMInvalidValue
+					}
+					if err := tx.Model(&group).Update("name", name).Error; err != nil {
+						return err
+					}
+					renamed = true
+				case path == "members":
+					membersChanged = true
+					var members []scimMultiValue
+					if len(op.Value) > 0 {
+						if err := json.Unmarshal(op.Value, &members); err != nil {
+							return errSCIMInvalidValue
+						}
+					}
+					switch operation {
+					case "add":
+						if err := addSCIMGroupMembers(tx, group.ID, members); err != nil {
+							return err
+						}
+					case "replace":
+						if err := setSCIMGroupMembers(tx, group.ID, members); err != nil {
+							return err
+						}
+					case "remove":
+						if len(members) == 0 {
+							if err := setSCIMGroupMembers(tx, group.ID, nil); err != nil {
+								return err
+							}
+						}
+						for _, member := range members {
+							if err := removeSCIMGroupMember(tx, group.ID, member.Value); err != nil {
+								return err
+							}
+						}
+					}
+				case path == "":
+					var value scimGroup
+					if err := json.Unmarshal(op.Value, &value); err != nil {
+						return errSCIMInvalidValue
+					}
+					if value.DisplayName != "" {
+						if err := tx.Model(&group).Update("name", value.DisplayName).Error; err != nil {
+							return err
+						}
+						renamed = true
+					}
+					if value.Members != nil {
+						if err := addSCIMGroupMembers(tx, group.ID, value.Members); err != nil {
+							return err
+						}
+						membersChanged = true
+					}
+				}
+			}
+
+			if renamed {
+				if err := enqueueEvent(tx, "group.updated", "group", group.ID, group); err != nil {
+					return err
+				}
+			}
+			if membersChanged {
+				return enqueueMembershipEvent(tx, group.ID)
+			}
+			return nil
+		})
+		if err == errSCIMInvalidValue {
+			scimError(c, http.StatusBadRequest, "invalidValue", "Invalid PATCH value")
+			return
+		}
+		if err == errSCIMUnknownMember {
+			scimError(c, http.StatusBadRequest, "invalidValue", "Unknown member")
+			return
+		}
+		if errors.Is(err, errRuleDerived) {
+			scimError(c, http.StatusBadRequest, "mutability", "Membership comes from the group's membership rule")
+			return
+		}
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error updating group")
+			return
+		}
+
+		members, _ := scimGroupMembers(db, []uint{group.ID})
+		recordAudit(db, c, "group.update", "group", group.ID, before, toSCIMGroup(c, group, members[group.ID]))
+		scimJSON(c, http.StatusOK, toSCIMGroup(c, group, members[group.ID]))
+	}
+}
+
+var (
+	errSCIMInvalidValue  = errors.New("invalid value")
+	errSCIMUnknownMember = errors.New("unknown member")
+)
+
+// setSCIMGroupMembers remplace les membres ajoutés à la main (grants); les membres dérivés de la règle du
+// groupe restent, et les membres déjà présents gardent leur période et leur raison
+func setSCIMGroupMembers(tx *gorm.DB, groupID uint, members []scimMultiValue) error {
+	wanted := map[uint]bool{}
+	for _, member := range members {
+		userID, err := strconv.ParseUint(member.Value, 10, 64)
+		if err != nil {
+			return errSCIMInvalidValue
+		}
+		wanted[uint(userID)] = true
+	}
+	var current []uint
+	if err := tx.Table("user_groups").Where("group_id = ? AND NOT rule_derived", groupID).Pluck("user_id", &current).Error; err != nil {
+		return err
+	}
+	for _, userID := range current {
+		if !wanted[userID] {
+			if err := groupGrants.revoke(tx, userID, groupID); err != nil {
+				return err
+			}
+		}
+	}
+	return addSCIMGroupMembers(tx, groupID, members)
+}
+
+// addSCIMGroupMembers ajoute des membres par groupGrants (un membre déjà actif est laissé tel quel); chaque
+// utilisateur doit exister dans l'organisation (tx est scopée par tenantDB), sinon errSCIMUnknownMember
+func addSCIMGroupMembers(tx *gorm.DB, groupID uint, members []scimMultiValue) error {
+	for _, member := range members {
+		userID, err := strconv.ParseUint(member.Value, 10, 64)
+		if err != nil {
+			return errSCIMInvalidValue
+		}
+		var user User
+		if err := tx.Where("id = ?", userID).First(&user).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return errSCIMUnknownMember
+			}
+			return err
+		}
+		var active int
+		if err := whereActiveGrant(tx.Table("user_groups"), "user_groups").Where("user_id = ? AND group_id = ?", user.ID, groupID).Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			continue
+		}
+		if err := groupGrants.grant(tx, user.ID, groupID, grantOptions{Reason: "SCIM"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSCIMGroupMember retire un membre par groupGrants.revoke: un membre dérivé de la règle du groupe ne se
+// retire pas (errRuleDerived)
+func removeSCIMGroupMember(tx *gorm.DB, groupID uint, value string) error {
+	userID, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return errSCIMInvalidValue
+	}
+	return groupGrants.revoke(tx, uint(userID), groupID)
+}
+
+// deleteSCIMGroup supprime un groupe (soft delete, comme deleteGroup)
+func deleteSCIMGroup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var group Group
+		if err := db.Where("id = ?", c.Param("id")).First(&group).Error; err != nil {
+			scimError(c, http.StatusNotFound, "", "Group not found")
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&group).Error; err != nil {
+				return err
+			}
+			return enqueueEvent(tx, "group.deleted", "group", group.ID, group)
+		})
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Error deleting group")
+			return
+		}
+		recordAudit(db, c, "group.delete", "group", group.ID, group, nil)
+		c.Status(http.StatusNoContent)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint SCIM discovery
+
+func getSCIMServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":          []string{scimSchemaSPConfig},
+		"documentationUri": "https://github.com/IROUAG/API-CLI-GOLANG",
+		"patch":            gin.H{"supported": true},
+		"bulk":             gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           gin.H{"supported": true, "maxResults": scimMaxPageCount},
+		"changePassword":   gin.H{"supported": true},
+		"sort":             gin.H{"supported": false},
+		"etag":             gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "Static bearer token configured with SCIM_TOKEN",
+			"primary":     true,
+		}},
+		"meta": gin.H{"resourceType": "ServiceProviderConfig", "location": "/scim/v2/ServiceProviderConfig"},
+	})
+}
+
+func scimAttribute(name, typ string, multiValued, required bool, extra gin.H) gin.H {
+	attribute := gin.H{
+		"name":        name,
+		"type":        typ,
+		"multiValued": multiValued,
+		"required":    required,
+		"caseExact":   false,
+		"mutability":  "readWrite",
+		"returned":    "default",
+		"uniqueness":  "none",
+	}
+	for key, value := range extra {
+		attribute[key] = value
+	}
+	return attribute
+}
+
+var scimSchemas = []gin.H{
+	{
+		"schemas":     []string{scimSchemaSchema},
+		"id":          scimSchemaUser,
+		"name":        "User",
+		"description": "User Account",
+		"attributes": []gin.H{
+			scimAttribute("userName", "string", false, true, gin.H{"uniqueness": "server"}),
+			scimAttribute("name", "complex", false, false, gin.H{"subAttributes": []gin.H{
+				scimAttribute("formatted", "string", false, false, nil),
+				scimAttribute("givenName", "string", false, false, nil),
+				scimAttribute("familyName", "string", false, false, nil),
+			}}),
+			scimAttribute("displayName", "string", false, false, nil),
+			scimAttribute("emails", "complex", true, false, gin.H{"mutability": "readOnly"}),
+			scimAttribute("active", "boolean", false, false, nil),
+			scimAttribute("password", "string", false, false, gin.H{"mutability": "writeOnly", "returned": "never"}),
+			scimAttribute("groups", "complex", true, false, gin.H{"mutability": "readOnly"}),
+		},
+		"meta": gin.H{"resourceType": "Schema", "location": "/scim/v2/Schemas/" + scimSchemaUser},
+	},
+	{
+		"schemas":     []string{scimSchemaSchema},
+		"id":          scimSchemaGroup,
+		"name":        "Group",
+		"description": "Group",
+		"attributes": []gin.H{
+			scimAttribute("displayName", "string", false, true, gin.H{"uniqueness": "server"}),
+			scimAttribute("members", "complex", true, false, gin.H{"subAttributes": []gin.H{
+				scimAttribute("value", "string", false, false, gin.H{"mutability": "immutable"}),
+				scimAttribute("display", "string", false, false, gin.H{"mutability": "readOnly"}),
+			}}),
+		},
+		"meta": gin.H{"resourceType": "Schema", "location": "/scim/v2/Schemas/" + scimSchemaGroup},
+	},
+}
+
+var scimResourceTypes = []gin.H{
+	{
+		"schemas":     []string{scimSchemaResourceType},
+		"id":          "User",
+		"name":        "User",
+		"endpoint":    "/Users",
+		"description": "User Account",
+		"schema":      scimSchemaUser,
+		"meta":        gin.H{"resourceType": "ResourceType", "location": "/scim/v2/ResourceTypes/User"},
+	},
+	{
+		"schemas":     []string{scimSchemaResourceType},
+		"id":          "Group",
+		"name":        "Group",
+		"endpoint":    "/Groups",
+		"description": "Group",
+		"schema":      scimSchemaGroup,
+		"meta":        gin.H{"resourceType": "ResourceType", "location": "/scim/v2/ResourceTypes/Group"},
+	},
+}
+
+func getSCIMSchemas(c *gin.Context) {
+	if id := c.Param("id"); id != "" {
+		for _, schema := range scimSchemas {
+			if schema["id"] == id {
+				scimJSON(c, http.StatusOK, schema)
+				return
+			}
+		}
+		scimError(c, http.StatusNotFound, "", "Schema not found")
+		return
+	}
+	resources := make([]interface{}, 0, len(scimSchemas))
+	for _, schema := range scimSchemas {
+		resources = append(resources, schema)
+	}
+	scimListResponse(c, resources)
+}
+
+func getSCIMResourceTypes(c *gin.Context) {
+	if id := c.Param("id"); id != "" {
+		for _, resourceType := range scimResourceTypes {
+			if resourceType["id"] == id {
+				scimJSON(c, http.StatusOK, resourceType)
+				return
+			}
+		}
+		scimError(c, http.StatusNotFound, "", "Resource type not found")
+		return
+	}
+	resources := make([]interface{}, 0, len(scimResourceTypes))
+	for _, resourceType := range scimResourceTypes {
+		resources = append(resources, resourceType)
+	}
+	scimListResponse(c, resources)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Filtres SCIM (RFC 7644 §3.4.2.2): attrPath op value, and/or/not et parenthèses
+
+type scimFilter interface {
+	matches(resource map[string]interface{}) bool
+}
+
+type scimAnd struct{ left, right scimFilter }
+type scimOr struct{ left, right scimFilter }
+type scimNot struct{ inner scimFilter }
+type scimCompare struct {
+	path  string
+	op    string
+	value interface{}
+}
+
+func (f scimAnd) matches(r map[string]interface{}) bool {
+	return f.left.matches(r) && f.right.matches(r)
+}
+func (f scimOr) matches(r map[string]interface{}) bool {
+	return f.left.matches(r) || f.right.matches(r)
+}
+func (f scimNot) matches(r map[string]interface{}) bool { return !f.inner.matches(r) }
+
+func (f scimCompare) matches(r map[string]interface{}) bool {
+	values := scimResolvePath(r, strings.Split(f.path, "."))
+	if f.op == "pr" {
+		for _, v := range values {
+			if v != nil && v != "" {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range values {
+		if scimCompareValue(v, f.op, f.value) {
+			return true
+		}
+	}
+	return f.op == "ne" && len(values) == 0
+}
+
+// scimResolvePath retourne toutes les valeurs d'un chemin, en traversant les attributs multi-valués
+func scimResolvePath(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		if list, ok := value.([]interface{}); ok {
+			return list
+		}
+		return []interface{}{value}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if strings.EqualFold(key, path[0]) {
+				return scimResolvePath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		var values []interface{}
+		for _, item := range v {
+			values = append(values, scimResolvePath(item, path)...)
+		}
+		return values
+	}
+	return nil
+}
+
+func scimCompareValue(actual interface{}, op string, expected interface{}) bool {
+	if m, ok := actual.(map[string]interface{}); ok {
+		actual = m["value"]
+	}
+
+	switch exp := expected.(type) {
+	case string:
+		a := strings.ToLower(fmt.Sprint(actual))
+		e := strings.ToLower(exp)
+		switch op {
+		case "eq":
+			return a == e
+		case "ne":
+			return a != e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == exp
+		case "ne":
+			return a != exp
+		case "gt":
+			return a > exp
+		case "ge":
+			return a >= exp
+		case "lt":
+			return a < exp
+		case "le":
+			return a <= exp
+		}
+	case bool, nil:
+		switch op {
+		case "eq":
+			return actual == exp
+		case "ne":
+			return actual != exp
+		}
+	}
+	return false
+}
+
+// scimUserColumns associe les attributs filtrables d'un utilisateur SCIM à leur colonne
+var scimUserColumns = map[string]string{
+	"id":                "CAST(users.id AS TEXT)",
+	"username":          "users.email",
+	"emails":            "users.email",
+	"emails.value":      "users.email",
+	"displayname":       "users.name",
+	"name.formatted":    "users.name",
+	"meta.created":      "users.created_at",
+	"meta.lastmodified": "users.updated_at",
+}
+
+// scimUserActiveSQL est l'équivalent SQL de currentStatus() == statusActive
+const scimUserActiveSQL = "(COALESCE(users.status, '') IN ('', 'active') AND (users.deactivate_at IS NULL OR users.deactivate_at > NOW()))"
+
+// scimUserFilterSQL traduit un filtre SCIM sur les utilisateurs en condition SQL; les chaînes sont comparées sans
+// tenir compte de la casse, comme scimCompareValue
+func scimUserFilterSQL(filter scimFilter) (string, []interface{}, error) {
+	switch f := filter.(type) {
+	case scimAnd:
+		return scimUserJoinSQL(f.left, f.right, "AND")
+	case scimOr:
+		return scimUserJoinSQL(f.left, f.right, "OR")
+	case scimNot:
+		inner, args, err := scimUserFilterSQL(f.inner)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + inner + ")", args, nil
+	case scimCompare:
+		return scimUserCompareSQL(f)
+	}
+	return "", nil, fmt.Errorf("unsupported filter")
+}
+
+func scimUserJoinSQL(left, right scimFilter, op string) (string, []interface{}, error) {
+	l, lArgs, err := scimUserFilterSQL(left)
+	if err != nil {
+		return "", nil, err
+	}
+	r, rArgs, err := scimUserFilterSQL(right)
+	if err != nil {
+		return "", nil, err
+	}
+	return "(" + l + " " + op + " " + r + ")", append(lArgs, rArgs...), nil
+}
+
+func scimUserCompareSQL(f scimCompare) (string, []interface{}, error) {
+	path := strings.ToLower(f.path)
+	if path == "active" {
+		switch {
+		case f.op == "pr":
+			return "TRUE", nil, nil
+		case (f.op == "eq" || f.op == "ne") && (f.value == true || f.value == false):
+			if (f.value == true) == (f.op == "eq") {
+				return scimUserActiveSQL, nil, nil
+			}
+			return "NOT " + scimUserActiveSQL, nil, nil
+		}
+		return "", nil, fmt.Errorf("unsupported comparison on active")
+	}
+
+	column, ok := scimUserColumns[path]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported filter attribute %q", f.path)
+	}
+	if f.op == "pr" {
+		return "(" + column + " IS NOT NULL AND " + column + " <> '')", nil, nil
+	}
+	value, ok := f.value.(string)
+	if !ok {
+		return "", nil, fmt.Errorf("%s must be compared with a string", f.path)
+	}
+
+	if strings.HasPrefix(path, "meta.") {
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s must be compared with an RFC 3339 date", f.path)
+		}
+		operators := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+		if operators[f.op] == "" {
+			return "", nil, fmt.Errorf("unsupported operator %q on %s", f.op, f.path)
+		}
+		return column + " " + operators[f.op] + " ?", []interface{}{at}, nil
+	}
+
+	lower := "LOWER(" + column + ")"
+	like := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(value))
+	switch f.op {
+	case "eq":
+		return lower + " = ?", []interface{}{strings.ToLower(value)}, nil
+	case "ne":
+		return lower + " <> ?", []interface{}{strings.ToLower(value)}, nil
+	case "co":
+		return lower + " LIKE ?", []interface{}{"%" + like + "%"}, nil
+	case "sw":
+		return lower + " LIKE ?", []interface{}{like + "%"}, nil
+	case "ew":
+		return lower + " LIKE ?", []interface{}{"%" + like}, nil
+	case "gt":
+		return lower + " > ?", []interface{}{strings.ToLower(value)}, nil
+	case "ge":
+		return lower + " >= ?", []interface{}{strings.ToLower(value)}, nil
+	case "lt":
+		return lower + " < ?", []interface{}{strings.ToLower(value)}, nil
+	case "le":
+		return lower + " <= ?", []interface{}{strings.ToLower(value)}, nil
+	}
+	return "", nil, fmt.Errorf("unknown operator %q", f.op)
+}
+
+type scimFilterParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseSCIMFilter retourne nil si le filtre est vide
+func parseSCIMFilter(filter string) (scimFilter, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+	tokens, err := tokenizeSCIMFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &scimFilterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q in filter", p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+func tokenizeSCIMFilter(filter string) ([]string, error) {
+	var tokens []string
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in filter")
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '(' && runes[j] != ')' {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *scimFilterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *scimFilterParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *scimFilterParser) parseOr() (scimFilter, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = scimOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseAnd() (scimFilter, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = scimAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *scimFilterParser) parseUnary() (scimFilter, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of filter")
+	case strings.EqualFold(token, "not"):
+		if p.next() != "(" {
+			return nil, fmt.Errorf("expected ( after not")
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return scimNot{inner}, nil
+	case token == "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return inner, nil
+	}
+
+	if strings.ContainsAny(token, "[]") {
+		return nil, fmt.Errorf("value path filters are not supported")
+	}
+	path := token
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		// urn:...:User:userName -> userName
+		path = path[i+1:]
+	}
+
+	op := strings.ToLower(p.next())
+	switch op {
+	case "pr":
+		return scimCompare{path: path, op: op}, nil
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+
+	raw := p.next()
+	var value interface{}
+	switch {
+	case raw == "":
+		return nil, fmt.Errorf("missing value for %s", path)
+	case strings.HasPrefix(raw, `"`):
+		var s string
+		if err := json.Unmarshal([]byte(raw), &s); err != nil {
+			return nil, fmt.Errorf("invalid string %s", raw)
+		}
+		value = s
+	case raw == "true" || raw == "false":
+		value = raw == "true"
+	case raw == "null":
+		value = nil
+	default:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s", raw)
+		}
+		value = n
+	}
+	return scimCompare{path: path, op: op, value: value}, nil
+}
+
+// scimSortedKeys permet d'appliquer les attributs d'un PATCH dans un ordre stable
+func scimSortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
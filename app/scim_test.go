@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSCIMUserFilterSQL(t *testing.T) {
+	tests := []struct {
+		filter string
+		sql    string
+		args   []interface{}
+	}{
+		{`userName eq "Alice@Example.com"`, "LOWER(users.email) = ?", []interface{}{"alice@example.com"}},
+		{`displayName co "li"`, "LOWER(users.name) LIKE ?", []interface{}{"%li%"}},
+		{`userName sw "a_b%"`, "LOWER(users.email) LIKE ?", []interface{}{`a\_b\%%`}},
+		{`emails.value ew "@example.com"`, "LOWER(users.email) LIKE ?", []interface{}{"%@example.com"}},
+		{`displayName pr`, "(users.name IS NOT NULL AND users.name <> '')", nil},
+		{`active eq true`, scimUserActiveSQL, nil},
+		{`active eq false`, "NOT " + scimUserActiveSQL, nil},
+		{`active ne false`, scimUserActiveSQL, nil},
+		{
+			`userName eq "a@example.com" or not (displayName eq "Bob")`,
+			"(LOWER(users.email) = ? OR NOT (LOWER(users.name) = ?))",
+			[]interface{}{"a@example.com", "bob"},
+		},
+		{
+			`meta.created gt "2026-01-01T00:00:00Z" and active eq true`,
+			"(users.created_at > ? AND " + scimUserActiveSQL + ")",
+			[]interface{}{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			filter, err := parseSCIMFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			sql, args, err := scimUserFilterSQL(filter)
+			if err != nil {
+				t.Fatalf("scimUserFilterSQL: %v", err)
+			}
+			if sql != tt.sql {
+				t.Errorf("sql = %q, want %q", sql, tt.sql)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestSCIMUserFilterSQLRejects(t *testing.T) {
+	tests := []struct {
+		filter string
+		error  string
+	}{
+		{`title eq "CEO"`, "unsupported filter attribute"},
+		{`active eq "yes"`, "unsupported comparison on active"},
+		{`meta.created gt "yesterday"`, "RFC 3339"},
+		{`meta.created co "2026-01-01T00:00:00Z"`, "unsupported operator"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			filter, err := parseSCIMFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if _, _, err := scimUserFilterSQL(filter); err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Errorf("error = %v, want %q", err, tt.error)
+			}
+		})
+	}
+}
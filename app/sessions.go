@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jinzhu/gorm"
+)
+
+// Session est une connexion d'un utilisateur; ses JWT la référencent par le claim sid
+type Session struct {
+	ID             uint       `gorm:"primary_key" json:"id"`
+	UserID         uint       `json:"user_id"`
+	OrganizationID uint       `json:"organization_id"` // organisation du token (claim org)
+	Device         string     `json:"device"`
+	IP             string     `json:"ip"`
+	UserAgent      string     `json:"user_agent"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at"`
+	ImpersonatorID *uint      `json:"impersonator_id,omitempty"`  // administrateur qui a ouvert la session au nom de l'utilisateur (claim act)
+	Current        bool       `gorm:"-" json:"current,omitempty"` // session du token de la requête (GET /me/sessions)
+}
+
+// impersonator donne l'ID de l'administrateur de la session, 0 hors impersonation
+func (s Session) impersonator() uint {
+	if s.ImpersonatorID == nil {
+		return 0
+	}
+	return *s.ImpersonatorID
+}
+
+// last_seen_at n'est réécrit qu'une fois par minute au plus
+const sessionTouchInterval = time.Minute
+
+var errSessionRevoked = errors.New("session revoked")
+
+// startSession enregistre une session (valable 30 jours) et signe son JWT
+func startSession(db *gorm.DB, user User, device, ip, userAgent string) (string, Session, error) {
+	now := time.Now()
+	return issueSession(db, user, Session{
+		Device:     device,
+		IP:         ip,
+		UserAgent:  userAgent,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(time.Hour * 24 * 30),
+	})
+}
+
+// issueSession enregistre la session de user et signe son JWT
+func issueSession(db *gorm.DB, user User, session Session) (string, Session, error) {
+	session.UserID = user.ID
+	session.OrganizationID = user.OrganizationID
+	if err := db.Create(&session).Error; err != nil {
+		return "", session, err
+	}
+	tokenString, err := signToken(user, session)
+	return tokenString, session, err
+}
+
+// activeSession retrouve la session d'un token et refuse les sessions révoquées ou dont les claims act
+// et org ne correspondent pas; les tokens sans sid (émis avant les sessions) ne peuvent pas être révoqués et sont donc refusés
+func activeSession(claims jwt.MapClaims) (Session, error) {
+	var session Session
+	sid, ok := claims["sid"].(float64)
+	if !ok {
+		return session, errors.New("token has no session")
+	}
+	if err := db.First(&session, uint(sid)).Error; err != nil {
+		return session, err
+	}
+	if session.RevokedAt != nil {
+		return session, errSessionRevoked
+	}
+	if actorOf(claims) != session.impersonator() {
+		return session, errors.New("impersonation mismatch")
+	}
+	if org, _ := claims["org"].(float64); uint(org) != session.OrganizationID {
+		return session, errors.New("organization mismatch")
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		session.LastSeenAt = time.Now()
+		db.Model(&session).UpdateColumn("last_seen_at", session.LastSeenAt)
+	}
+	return session, nil
+}
+
+// revokeOtherSessions révoque les sessions d'un utilisateur sauf celle de la requête (changement de mot de passe)
+func revokeOtherSessions(tx *gorm.DB, userID, keepID uint) error {
+	return tx.Model(&Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepID).
+		UpdateColumn("revoked_at", time.Now()).Error
+}
+
+// revokeUserSessions révoque toutes les sessions ouvertes d'un utilisateur (suppression du compte)
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	return tx.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		UpdateColumn("revoked_at", time.Now()).Error
+}
+
+func listActiveSessions(db *gorm.DB, userID interface{}) ([]Session, error) {
+	sessions := []Session{}
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint sessions
+
+// getUserSessions liste les sessions actives d'un utilisateur, la plus récemment utilisée en premier
+func getUserSessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		sessions, err := listActiveSessions(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching sessions"})
+			return
+		}
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// getMySessions liste les sessions actives de l'utilisateur connecté et marque celle de la requête
+func getMySessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user := c.MustGet("user").(User)
+		sessions, err := listActiveSessions(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching sessions"})
+			return
+		}
+		current := c.MustGet("session").(Session)
+		for i := range sessions {
+			sessions[i].Current = sessions[i].ID == current.ID
+		}
+		c.JSON(http.StatusOK, sessions)
+	}
+}
+
+// revokeSession révoque une session: ses tokens sont refusés dès la requête suivante
+func revokeSession(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var session Session
+		if err := db.Where("id = ?", c.Param("id")).First(&session).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		revoke(db, c, session)
+	}
+}
+
+// revokeMySession révoque une session de l'utilisateur connecté, sans droits sur /sessions
+func revokeMySession(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		user := c.MustGet("user").(User)
+		var session Session
+		if err := db.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&session).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		revoke(db, c, session)
+	}
+}
+
+func revoke(db *gorm.DB, c *gin.Context, session Session) {
+	if session.RevokedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Session already revoked"})
+		return
+	}
+	before := session
+	now := time.Now()
+	session.RevokedAt = &now
+	if err := db.Model(&session).UpdateColumn("revoked_at", now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking session"})
+		return
+	}
+	recordAudit(db, c, "session.revoke", "session", session.ID, before, session)
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
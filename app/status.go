@@ -0,0 +1,236 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Statut d'un compte: seul un compte actif peut se connecter et utiliser ses tokens (login, requireAuth, gRPC).
+// active -> suspended (suspension avec raison, réversible), active -> deactivated (immédiat),
+// active ou suspended -> expired (date de désactivation programmée, appliquée par runStatusExpirations);
+// reactivate ramène tout compte à active.
+const (
+	statusActive      = "active"
+	statusSuspended   = "suspended"
+	statusDeactivated = "deactivated"
+	statusExpired     = "expired"
+)
+
+// inactiveAccountError est retournée pour un compte qui n'est pas actif
+type inactiveAccountError struct {
+	status string
+}
+
+func (e inactiveAccountError) Error() string {
+	return "account is " + e.status
+}
+
+// currentStatus donne le statut du compte, expired dès la date programmée passée (avant le passage du job)
+func (u User) currentStatus() string {
+	status := u.Status
+	if status == "" {
+		status = statusActive
+	}
+	if (status == statusActive || status == statusSuspended) && u.DeactivateAt != nil && !time.Now().Before(*u.DeactivateAt) {
+		return statusExpired
+	}
+	return status
+}
+
+// checkActive retourne une inactiveAccountError si le compte n'est pas actif
+func checkActive(user User) error {
+	if status := user.currentStatus(); status != statusActive {
+		return inactiveAccountError{status: status}
+	}
+	return nil
+}
+
+// setUserStatus applique un statut et publie user.updated dans la même transaction; les sessions
+// d'un compte désactivé ou expiré sont révoquées (une suspension les laisse, elles reprennent à la réactivation)
+func setUserStatus(db *gorm.DB, user *User, status, reason string, deactivateAt *time.Time) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return applyUserStatus(tx, user, status, reason, deactivateAt)
+	})
+}
+
+// applyUserStatus fait le travail de setUserStatus dans une transaction déjà ouverte (directory sync)
+func applyUserStatus(tx *gorm.DB, user *User, status, reason string, deactivateAt *time.Time) error {
+	now := time.Now()
+	user.Status = status
+	user.StatusReason = reason
+	user.StatusChangedAt = &now
+	user.DeactivateAt = deactivateAt
+	err := tx.Model(user).UpdateColumns(map[string]interface{}{
+		"status":            user.Status,
+		"status_reason":     user.StatusReason,
+		"status_changed_at": user.StatusChangedAt,
+		"deactivate_at":     user.DeactivateAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if status == statusDeactivated || status == statusExpired {
+		if err := revokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+	}
+	if err := enqueueEvent(tx, "user.updated", "user", user.ID, user); err != nil {
+		return err
+	}
+	return applyMembershipRules(tx, *user)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Expirations programmées
+
+// runStatusExpirations passe en expired les comptes dont la date de désactivation est atteinte,
+// toutes les STATUS_CHECK_INTERVAL (1 minute par défaut)
+func runStatusExpirations(db *gorm.DB) {
+	interval, err := time.ParseDuration(getenvDefault("STATUS_CHECK_INTERVAL", "1m"))
+	if err != nil || interval <= 0 {
+		log.Printf("status: invalid STATUS_CHECK_INTERVAL, using 1m")
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		if _, err := expireUsers(db); err != nil {
+			log.Printf("status: failed to apply expirations: %v", err)
+		}
+	}
+}
+
+// expireUsers applique les désactivations programmées et retourne le nombre de comptes expirés
+func expireUsers(db *gorm.DB) (int, error) {
+	var users []User
+	schedulable := []string{statusActive, statusSuspended}
+	if err := db.Where("status IN (?) AND deactivate_at <= ?", schedulable, time.Now()).Find(&users).Error; err != nil {
+		return 0, err
+	}
+	expired := 0
+	for i := range users {
+		user := &users[i]
+		before := *user
+		// un autre réplica a pu passer avant: la mise à jour ne s'applique qu'aux comptes pas encore expirés
+		claimed := db.Model(&User{}).Where("id = ? AND status IN (?)", user.ID, schedulable).UpdateColumn("status", statusExpired)
+		if claimed.Error != nil {
+			return expired, claimed.Error
+		}
+		if claimed.RowsAffected == 0 {
+			continue
+		}
+		if err := setUserStatus(db, user, statusExpired, "Scheduled deactivation", user.DeactivateAt); err != nil {
+			return expired, err
+		}
+		recordAudit(db, nil, "user.expire", "user", user.ID, before, *user)
+		expired++
+	}
+	return expired, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint user status
+
+// suspendUser suspend un compte actif; la raison est obligatoire
+func suspendUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status data"})
+			return
+		}
+		if strings.TrimSpace(body.Reason) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+			return
+		}
+		if status := user.currentStatus(); status != statusActive {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is " + status})
+			return
+		}
+
+		before := user
+		if err := setUserStatus(db, &user, statusSuspended, body.Reason, user.DeactivateAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user status"})
+			return
+		}
+		recordAudit(db, c, "user.suspend", "user", user.ID, before, user)
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// deactivateUser désactive un compte tout de suite, ou programme sa désactivation à la date "at"
+func deactivateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		var body struct {
+			Reason string     `json:"reason"`
+			At     *time.Time `json:"at"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status data"})
+			return
+		}
+		if status := user.currentStatus(); status == statusDeactivated || status == statusExpired {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is " + status})
+			return
+		}
+
+		before := user
+		var err error
+		if body.At != nil && body.At.After(time.Now()) {
+			// le statut ne change pas avant la date: seule la désactivation est programmée
+			err = setUserStatus(db, &user, user.currentStatus(), user.StatusReason, body.At)
+		} else {
+			err = setUserStatus(db, &user, statusDeactivated, body.Reason, nil)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user status"})
+			return
+		}
+		recordAudit(db, c, "user.deactivate", "user", user.ID, before, user)
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// reactivateUser rend un compte actif et annule sa désactivation programmée
+func reactivateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := tenantDB(c, db)
+		var user User
+		if err := db.Where("id = ?", c.Param("id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.Status == statusActive && user.DeactivateAt == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "User is active"})
+			return
+		}
+
+		before := user
+		if err := setUserStatus(db, &user, statusActive, "", nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user status"})
+			return
+		}
+		recordAudit(db, c, "user.reactivate", "user", user.ID, before, user)
+		c.JSON(http.StatusOK, user)
+	}
+}
@@ -0,0 +1,679 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/jinzhu/gorm"
+)
+
+// SyncRun garde la trace d'une exécution du job de synchronisation d'annuaire
+type SyncRun struct {
+	ID          uint       `gorm:"primary_key" json:"id"`
+	Source      string     `json:"source"`
+	DryRun      bool       `json:"dry_run"`
+	Created     int        `json:"created"`
+	Updated     int        `json:"updated"`
+	Deactivated int        `json:"deactivated"`
+	Error       string     `json:"error"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// SyncState relie une entrée de la source externe à l'utilisateur ou au groupe local qu'elle a produit
+type SyncState struct {
+	ID         uint      `gorm:"primary_key" json:"id"`
+	Source     string    `json:"source"`
+	EntityType string    `json:"entity_type"`
+	ExternalID string    `json:"external_id"`
+	LocalID    uint      `json:"local_id"`
+	Checksum   string    `json:"checksum"`
+	Active     bool      `json:"active"`
+	RunID      uint      `json:"run_id"`
+	SyncedAt   time.Time `json:"synced_at"`
+}
+
+// directoryUser et directoryGroup sont les entrées lues depuis une source externe
+type directoryUser struct {
+	ExternalID string   `json:"external_id"`
+	Name       string   `json:"name"`
+	Email      string   `json:"email"`
+	Groups     []string `json:"groups"`
+}
+
+type directoryGroup struct {
+	ExternalID string `json:"external_id"`
+	Name       string `json:"name"`
+	Parent     string `json:"parent"`
+}
+
+// directorySource est implémentée par chaque type de source (ldap, csv, json)
+type directorySource interface {
+	Name() string
+	Fetch() ([]directoryUser, []directoryGroup, error)
+}
+
+// syncChange est une ligne du diff rapporté à la fin d'une exécution
+type syncChange struct {
+	Action     string
+	EntityType string
+	ExternalID string
+	Label      string
+}
+
+func (c syncChange) String() string {
+	symbol := map[string]string{"create": "+", "update": "~", "deactivate": "-"}[c.Action]
+	return fmt.Sprintf("%s %s %s (%s)", symbol, c.EntityType, c.Label, c.ExternalID)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Commande app sync
+
+func runSyncCommand(args []string) error {
+	if len(args) == 0 || args[0] != "run" {
+		return errors.New("usage: app sync run --source=ldap|csv|json [--file=...] [--groups-file=...] [--dry-run] [--interval=1h]")
+	}
+
+	flags := flag.NewFlagSet("sync run", flag.ContinueOnError)
+	sourceName := flags.String("source", "", "Source de l'annuaire: ldap, csv ou json")
+	file := flags.String("file", "", "Fichier des utilisateurs (csv) ou de l'annuaire complet (json)")
+	groupsFile := flags.String("groups-file", "", "Fichier des groupes (csv)")
+	dryRun := flags.Bool("dry-run", false, "Afficher le diff sans rien enregistrer")
+	interval := flags.Duration("interval", 0, "Relancer la synchronisation à intervalle régulier (ex: 1h)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	var source directorySource
+	switch *sourceName {
+	case "ldap":
+		source = newLDAPSource()
+	case "csv":
+		if *file == "" {
+			return errors.New("--file is required for the csv source")
+		}
+		source = csvSource{usersFile: *file, groupsFile: *groupsFile}
+	case "json":
+		if *file == "" {
+			return errors.New("--file is required for the json source")
+		}
+		source = jsonSource{file: *file}
+	default:
+		return fmt.Errorf("unknown source %q", *sourceName)
+	}
+
+	for {
+		run, changes, err := runDirectorySync(db, source, *dryRun)
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		if err != nil {
+			fmt.Printf("sync %s failed: %v\n", source.Name(), err)
+			if *interval == 0 {
+				return err
+			}
+		} else {
+			fmt.Printf("sync %s: %d created, %d updated, %d deactivated (dry-run: %t)\n",
+				source.Name(), run.Created, run.Updated, run.Deactivated, run.DryRun)
+		}
+
+		if *interval == 0 {
+			return nil
+		}
+		time.Sleep(*interval)
+	}
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Réconciliation
+
+// runDirectorySync applique le contenu de la source sur la base dans une seule transaction.
+// En dry-run la transaction est annulée, seul le diff est retourné.
+func runDirectorySync(db *gorm.DB, source directorySource, dryRun bool) (SyncRun, []syncChange, error) {
+	run := SyncRun{Source: source.Name(), DryRun: dryRun, StartedAt: time.Now()}
+	if !dryRun {
+		if err := db.Create(&run).Error; err != nil {
+			return run, nil, err
+		}
+	}
+
+	users, groups, err := source.Fetch()
+	if err != nil {
+		return run, nil, finishSyncRun(db, &run, err)
+	}
+
+	tx := scopeTenant(db, envOrganizationID("SYNC_ORGANIZATION_ID")).Begin()
+	s := &directorySync{tx: tx, source: source.Name(), run: &run, adopt: getenvDefault("SYNC_ADOPT_EXISTING", "false") == "true"}
+	if err := s.apply(users, groups); err != nil {
+		tx.Rollback()
+		return run, s.changes, finishSyncRun(db, &run, err)
+	}
+
+	if dryRun {
+		tx.Rollback()
+		return run, s.changes, nil
+	}
+	if err := tx.Commit().Error; err != nil {
+		return run, s.changes, finishSyncRun(db, &run, err)
+	}
+	return run, s.changes, finishSyncRun(db, &run, nil)
+}
+
+func finishSyncRun(db *gorm.DB, run *SyncRun, err error) error {
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if run.DryRun {
+		return err
+	}
+	now := time.Now()
+	run.FinishedAt = &now
+	db.Save(run)
+	return err
+}
+
+type directorySync struct {
+	tx      *gorm.DB
+	source  string
+	run     *SyncRun
+	adopt   bool // SYNC_ADOPT_EXISTING: rattacher un compte (même email) ou un groupe (même nom) local existant
+	states  map[string]*SyncState
+	changes []syncChange
+}
+
+// syncStatusReason marque les comptes désactivés parce qu'ils ont disparu de l'annuaire
+const syncStatusReason = "removed from directory"
+
+func syncStateKey(entityType, externalID string) string {
+	return entityType + "/" + externalID
+}
+
+func syncChecksum(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// record ajoute la modification au diff et la publie dans l'outbox (même transaction)
+func (s *directorySync) record(action, entityType, externalID, label string, localID uint) error {
+	s.changes = append(s.changes, syncChange{Action: action, EntityType: entityType, ExternalID: externalID, Label: label})
+	var eventType string
+	switch action {
+	case "create":
+		s.run.Created++
+		eventType = entityType + ".created"
+	case "update":
+		s.run.Updated++
+		eventType = entityType + ".updated"
+	case "deactivate":
+		s.run.Deactivated++
+		eventType = entityType + ".deleted"
+	}
+	return enqueueEvent(s.tx, eventType, entityType, localID, map[string]interface{}{
+		"id":          localID,
+		"source":      s.source,
+		"external_id": externalID,
+		"label":       label,
+	})
+}
+
+func (s *directorySync) saveState(entityType, externalID string, localID uint, checksum string) error {
+	key := syncStateKey(entityType, externalID)
+	state, ok := s.states[key]
+	if !ok {
+		state = &SyncState{Source: s.source, EntityType: entityType, ExternalID: externalID}
+		s.states[key] = state
+	}
+	state.LocalID = localID
+	state.Checksum = checksum
+	state.Active = true
+	state.RunID = s.run.ID
+	state.SyncedAt = time.Now()
+	return s.tx.Save(state).Error
+}
+
+func (s *directorySync) apply(users []directoryUser, groups []directoryGroup) error {
+	var states []SyncState
+	if err := s.tx.Where("source = ?", s.source).Find(&states).Error; err != nil {
+		return err
+	}
+	s.states = make(map[string]*SyncState, len(states))
+	for i := range states {
+		s.states[syncStateKey(states[i].EntityType, states[i].ExternalID)] = &states[i]
+	}
+
+	groupIDs, err := s.applyGroups(groups)
+	if err != nil {
+		return err
+	}
+	if err := s.applyUsers(users, groupIDs); err != nil {
+		return err
+	}
+	return s.deactivateMissing(users, groups)
+}
+
+// applyGroups crée ou met à jour les groupes puis reconstruit la hiérarchie ParentGroupID
+func (s *directorySync) applyGroups(groups []directoryGroup) (map[string]uint, error) {
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ExternalID < groups[j].ExternalID })
+
+	groupIDs := make(map[string]uint, len(groups))
+	created := make(map[string]bool)
+	for _, dg := range groups {
+		var group Group
+		state, known := s.states[syncStateKey("group", dg.ExternalID)]
+		if known {
+			// un groupe déjà lié par sync_states est repris même si la synchro l'a supprimé
+			s.tx.Unscoped().First(&group, state.LocalID)
+		}
+		if group.ID == 0 && s.adopt {
+			// adoption explicite d'un groupe local de même nom (jamais un groupe supprimé)
+			s.tx.Where("name = ?", dg.Name).First(&group)
+		}
+
+		if group.ID == 0 {
+			var taken int
+			if err := s.tx.Model(&Group{}).Unscoped().Where("name = ?", dg.Name).Count(&taken).Error; err != nil {
+				return nil, err
+			}
+			if taken > 0 {
+				return nil, fmt.Errorf("creating group %s: a local group already uses this name (set SYNC_ADOPT_EXISTING=true to adopt it)", dg.Name)
+			}
+			group = Group{Name: dg.Name}
+			if err := s.tx.Create(&group).Error; err != nil {
+				return nil, fmt.Errorf("creating group %s: %w", dg.Name, err)
+			}
+			if err := s.record("create", "group", dg.ExternalID, dg.Name, group.ID); err != nil {
+				return nil, err
+			}
+			created[dg.ExternalID] = true
+		}
+		groupIDs[dg.ExternalID] = group.ID
+	}
+
+	for _, dg := range groups {
+		checksum := syncChecksum(dg.Name, dg.Parent)
+		if state, known := s.states[syncStateKey("group", dg.ExternalID)]; known && state.Active && state.Checksum == checksum {
+			continue
+		}
+
+		updates := map[string]interface{}{"name": dg.Name, "deleted_at": gorm.Expr("NULL"), "parent_group_id": gorm.Expr("NULL")}
+		if parentID, ok := groupIDs[dg.Parent]; ok && dg.Parent != "" {
+			updates["parent_group_id"] = parentID
+		}
+		if err := s.tx.Unscoped().Model(&Group{ID: groupIDs[dg.ExternalID]}).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("updating group %s: %w", dg.Name, err)
+		}
+		if !created[dg.ExternalID] {
+			if err := s.record("update", "group", dg.ExternalID, dg.Name, groupIDs[dg.ExternalID]); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.saveState("group", dg.ExternalID, groupIDs[dg.ExternalID], checksum); err != nil {
+			return nil, err
+		}
+	}
+	return groupIDs, nil
+}
+
+// applyUsers crée ou met à jour les utilisateurs et aligne leurs appartenances aux groupes synchronisés
+func (s *directorySync) applyUsers(users []directoryUser, groupIDs map[string]uint) error {
+	sort.Slice(users, func(i, j int) bool { return users[i].ExternalID < users[j].ExternalID })
+
+	managed := make([]uint, 0, len(groupIDs))
+	for _, id := range groupIDs {
+		managed = append(managed, id)
+	}
+
+	for _, du := range users {
+		memberOf := append([]string(nil), du.Groups...)
+		sort.Strings(memberOf)
+		checksum := syncChecksum(du.Name, du.Email, strings.Join(memberOf, ","))
+
+		state, known := s.states[syncStateKey("user", du.ExternalID)]
+		if known && state.Active && state.Checksum == checksum {
+			continue
+		}
+
+		var user User
+		if known {
+			// un compte déjà lié par sync_states est repris même s'il a été supprimé par l'ancienne synchro
+			s.tx.Unscoped().First(&user, state.LocalID)
+		}
+		if user.ID == 0 && s.adopt {
+			// adoption explicite d'un compte local actif (jamais un compte supprimé)
+			s.tx.Where("email = ?", du.Email).First(&user)
+		}
+
+		if user.ID == 0 {
+			var taken int
+			if err := s.tx.Model(&User{}).Unscoped().Where("email = ?", du.Email).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return fmt.Errorf("creating user %s: a local account already uses this email (set SYNC_ADOPT_EXISTING=true to adopt it)", du.Email)
+			}
+			// pas de mot de passe local: l'utilisateur s'authentifie via l'annuaire
+			user = User{Name: du.Name, Email: du.Email}
+			if err := validateUserAttributes(s.tx, &user); err != nil {
+				return fmt.Errorf("creating user %s: %w", du.Email, err)
+			}
+			if err := s.tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("creating user %s: %w", du.Email, err)
+			}
+			if err := s.record("create", "user", du.ExternalID, du.Email, user.ID); err != nil {
+				return err
+			}
+		} else {
+			updates := map[string]interface{}{"name": du.Name, "email": du.Email, "deleted_at": gorm.Expr("NULL")}
+			if err := s.tx.Unscoped().Model(&user).Updates(updates).Error; err != nil {
+				return fmt.Errorf("updating user %s: %w", du.Email, err)
+			}
+			if user.Status == statusDeactivated && user.StatusReason == syncStatusReason {
+				if err := applyUserStatus(s.tx, &user, statusActive, "", nil); err != nil {
+					return fmt.Errorf("reactivating user %s: %w", du.Email, err)
+				}
+			}
+			if err := s.record("update", "user", du.ExternalID, du.Email, user.ID); err != nil {
+				return err
+			}
+		}
+
+		if len(managed) > 0 {
+			if err := s.tx.Exec("DELETE FROM user_groups WHERE user_id = ? AND group_id IN (?)", user.ID, managed).Error; err != nil {
+				return err
+			}
+		}
+		for _, externalGroup := range memberOf {
+			groupID, ok := groupIDs[externalGroup]
+			if !ok {
+				continue
+			}
+			if err := s.tx.Exec("INSERT INTO user_groups (user_id, group_id) VALUES (?, ?) ON CONFLICT DO NOTHING", user.ID, groupID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := s.saveState("user", du.ExternalID, user.ID, checksum); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deactivateMissing désactive les utilisateurs (statut deactivated, sessions révoquées) et supprime
+// (soft delete) les groupes qui ont disparu de la source
+func (s *directorySync) deactivateMissing(users []directoryUser, groups []directoryGroup) error {
+	seen := make(map[string]bool, len(users)+len(groups))
+	for _, du := range users {
+		seen[syncStateKey("user", du.ExternalID)] = true
+	}
+	for _, dg := range groups {
+		seen[syncStateKey("group", dg.ExternalID)] = true
+	}
+
+	keys := make([]string, 0, len(s.states))
+	for key := range s.states {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		state := s.states[key]
+		if seen[key] || !state.Active {
+			continue
+		}
+
+		var err error
+		var label string
+		switch state.EntityType {
+		case "user":
+			var user User
+			s.tx.First(&user, state.LocalID)
+			label = user.Email
+			if user.ID != 0 && user.Status != statusDeactivated {
+				err = applyUserStatus(s.tx, &user, statusDeactivated, syncStatusReason, nil)
+			}
+		case "group":
+			var group Group
+			s.tx.First(&group, state.LocalID)
+			label = group.Name
+			if group.ID != 0 {
+				err = s.tx.Delete(&group).Error
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("deactivating %s %s: %w", state.EntityType, state.ExternalID, err)
+		}
+
+		state.Active = false
+		state.RunID = s.run.ID
+		state.SyncedAt = time.Now()
+		if err := s.tx.Save(state).Error; err != nil {
+			return err
+		}
+		if err := s.record("deactivate", state.EntityType, state.ExternalID, label, state.LocalID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Sources
+
+// jsonSource lit un fichier {"users": [...], "groups": [...]}
+type jsonSource struct {
+	file string
+}
+
+func (s jsonSource) Name() string { return "json" }
+
+func (s jsonSource) Fetch() ([]directoryUser, []directoryGroup, error) {
+	data, err := os.ReadFile(s.file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var directory struct {
+		Users  []directoryUser  `json:"users"`
+		Groups []directoryGroup `json:"groups"`
+	}
+	if err := json.Unmarshal(data, &directory); err != nil {
+		return nil, nil, fmt.Errorf("parsing %s: %w", s.file, err)
+	}
+	return directory.Users, directory.Groups, nil
+}
+
+// csvSource lit les utilisateurs (external_id,name,email,groups) et les groupes (external_id,name,parent).
+// Les groupes d'un utilisateur sont séparés par des ";".
+type csvSource struct {
+	usersFile  string
+	groupsFile string
+}
+
+func (s csvSource) Name() string { return "csv" }
+
+func (s csvSource) Fetch() ([]directoryUser, []directoryGroup, error) {
+	var users []directoryUser
+	err := readCSV(s.usersFile, func(record map[string]string) {
+		var groups []string
+		for _, group := range strings.Split(record["groups"], ";") {
+			if group = strings.TrimSpace(group); group != "" {
+				groups = append(groups, group)
+			}
+		}
+		users = append(users, directoryUser{
+			ExternalID: record["external_id"],
+			Name:       record["name"],
+			Email:      record["email"],
+			Groups:     groups,
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var groups []directoryGroup
+	if s.groupsFile != "" {
+		err = readCSV(s.groupsFile, func(record map[string]string) {
+			groups = append(groups, directoryGroup{
+				ExternalID: record["external_id"],
+				Name:       record["name"],
+				Parent:     record["parent"],
+			})
+		})
+	}
+	return users, groups, err
+}
+
+// readCSV appelle fn pour chaque ligne, indexée par les noms de colonnes de l'en-tête
+func readCSV(path string, fn func(map[string]string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading header of %s: %w", path, err)
+	}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(row) {
+				record[strings.TrimSpace(column)] = strings.TrimSpace(row[i])
+			}
+		}
+		fn(record)
+	}
+}
+
+// ldapSource interroge un annuaire LDAP configuré par les variables LDAP_*.
+// Les groupes imbriqués (un groupe membre d'un autre) deviennent des ParentGroupID.
+type ldapSource struct {
+	url          string
+	bindDN       string
+	bindPassword string
+	baseDN       string
+	userFilter   string
+	groupFilter  string
+	nameAttr     string
+	emailAttr    string
+	memberAttr   string
+}
+
+func newLDAPSource() ldapSource {
+	return ldapSource{
+		url:          os.Getenv("LDAP_URL"),
+		bindDN:       os.Getenv("LDAP_BIND_DN"),
+		bindPassword: os.Getenv("LDAP_BIND_PASSWORD"),
+		baseDN:       os.Getenv("LDAP_BASE_DN"),
+		userFilter:   getenvDefault("LDAP_USER_FILTER", "(objectClass=person)"),
+		groupFilter:  getenvDefault("LDAP_GROUP_FILTER", "(objectClass=groupOfNames)"),
+		nameAttr:     getenvDefault("LDAP_NAME_ATTR", "cn"),
+		emailAttr:    getenvDefault("LDAP_EMAIL_ATTR", "mail"),
+		memberAttr:   getenvDefault("LDAP_MEMBER_ATTR", "member"),
+	}
+}
+
+func (s ldapSource) Name() string { return "ldap" }
+
+func (s ldapSource) Fetch() ([]directoryUser, []directoryGroup, error) {
+	if s.url == "" || s.baseDN == "" {
+		return nil, nil, errors.New("LDAP_URL and LDAP_BASE_DN must be set")
+	}
+	conn, err := ldap.DialURL(s.url)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	if s.bindDN != "" {
+		if err := conn.Bind(s.bindDN, s.bindPassword); err != nil {
+			return nil, nil, fmt.Errorf("ldap bind: %w", err)
+		}
+	}
+
+	userEntries, err := conn.SearchWithPaging(ldap.NewSearchRequest(s.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, s.userFilter, []string{s.nameAttr, s.emailAttr}, nil), 500)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ldap user search: %w", err)
+	}
+	groupEntries, err := conn.SearchWithPaging(ldap.NewSearchRequest(s.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, s.groupFilter, []string{s.nameAttr, s.memberAttr}, nil), 500)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ldap group search: %w", err)
+	}
+
+	users := make(map[string]*directoryUser, len(userEntries.Entries))
+	var result []directoryUser
+	for _, entry := range userEntries.Entries {
+		email := entry.GetAttributeValue(s.emailAttr)
+		if email == "" {
+			continue
+		}
+		users[strings.ToLower(entry.DN)] = &directoryUser{
+			ExternalID: entry.DN,
+			Name:       entry.GetAttributeValue(s.nameAttr),
+			Email:      email,
+		}
+	}
+
+	groupDNs := make(map[string]string, len(groupEntries.Entries))
+	for _, entry := range groupEntries.Entries {
+		groupDNs[strings.ToLower(entry.DN)] = entry.DN
+	}
+
+	parents := make(map[string]string)
+	var groups []directoryGroup
+	for _, entry := range groupEntries.Entries {
+		for _, member := range entry.GetAttributeValues(s.memberAttr) {
+			key := strings.ToLower(member)
+			if user, ok := users[key]; ok {
+				user.Groups = append(user.Groups, entry.DN)
+			} else if child, ok := groupDNs[key]; ok {
+				parents[child] = entry.DN
+			}
+		}
+	}
+	for _, entry := range groupEntries.Entries {
+		groups = append(groups, directoryGroup{
+			ExternalID: entry.DN,
+			Name:       entry.GetAttributeValue(s.nameAttr),
+			Parent:     parents[entry.DN],
+		})
+	}
+	for _, user := range users {
+		result = append(result, *user)
+	}
+	return result, groups, nil
+}
+
+func getenvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
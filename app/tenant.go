@@ -0,0 +1,282 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Organization isole ses utilisateurs, rôles et groupes de ceux des autres organisations
+type Organization struct {
+	ID        uint       `gorm:"primary_key" json:"id"`
+	Name      string     `json:"name"`
+	Slug      string     `gorm:"unique" json:"slug"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+// organisation créée par setup.sql, qui reçoit les inscriptions et, par défaut, la synchronisation et SCIM
+const defaultOrganizationID uint = 1
+
+const tenantKey = "tenant:organization_id"
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Scoping automatique: une fois db.Set(tenantKey, id) (voir tenantDB), chaque requête gorm sur un
+// modèle qui a une colonne organization_id (User, Role, Group, Session) est filtrée sur l'organisation,
+// et chaque création ou mise à jour l'y force. Les requêtes SQL brutes (tx.Exec) ne sont pas concernées.
+
+func registerTenantCallbacks(db *gorm.DB) {
+	db.Callback().Query().Before("gorm:query").Register("tenant:query", scopeTenantQuery)
+	db.Callback().RowQuery().Before("gorm:row_query").Register("tenant:row_query", scopeTenantQuery)
+	db.Callback().Update().Before("gorm:update").Register("tenant:update", scopeTenantQuery)
+	db.Callback().Delete().Before("gorm:delete").Register("tenant:delete", scopeTenantQuery)
+	db.Callback().Create().Before("gorm:create").Register("tenant:create", assignTenant)
+	db.Callback().Update().Before("gorm:update").Register("tenant:assign", forceTenant)
+}
+
+func scopeTenantQuery(scope *gorm.Scope) {
+	if org, ok := scope.Get(tenantKey); ok && scope.HasColumn("organization_id") {
+		scope.Search.Where(scope.QuotedTableName()+".organization_id = ?", org)
+	}
+}
+
+// forceTenant empêche de déplacer un enregistrement vers une autre organisation (ex: organization_id dans un PUT)
+func forceTenant(scope *gorm.Scope) {
+	if org, ok := scope.Get(tenantKey); ok && scope.HasColumn("organization_id") {
+		scope.SetColumn("OrganizationID", org)
+	}
+}
+
+func assignTenant(scope *gorm.Scope) {
+	forceTenant(scope)
+	if field, ok := scope.FieldByName("OrganizationID"); ok && field.IsBlank {
+		field.Set(defaultOrganizationID)
+	}
+}
+
+// scopeTenant limite db à une organisation
+func scopeTenant(db *gorm.DB, orgID uint) *gorm.DB {
+	return db.Set(tenantKey, orgID)
+}
+
+// envOrganizationID lit l'organisation des écritures sans utilisateur (SCIM_ORGANIZATION_ID, SYNC_ORGANIZATION_ID);
+// organisation par défaut si la variable est absente
+func envOrganizationID(key string) uint {
+	id, err := strconv.ParseUint(os.Getenv(key), 10, 64)
+	if err != nil || id == 0 {
+		return defaultOrganizationID
+	}
+	return uint(id)
+}
+
+// signupOrganization donne l'organisation où signup crée les comptes: SIGNUP_ORGANIZATION_ID si elle est posée,
+// sinon l'organisation par défaut tant qu'elle est la seule. 0: signup est fermé (plusieurs organisations, il faut
+// une invitation)
+func signupOrganization(db *gorm.DB) (uint, error) {
+	if os.Getenv("SIGNUP_ORGANIZATION_ID") != "" {
+		return envOrganizationID("SIGNUP_ORGANIZATION_ID"), nil
+	}
+	var count int
+	if err := db.Model(&Organization{}).Where("id <> ?", defaultOrganizationID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	if count > 0 {
+		return 0, nil
+	}
+	return defaultOrganizationID, nil
+}
+
+// tenantDB limite db à l'organisation de la requête (posée par requireAuth ou requireSCIMToken)
+func tenantDB(c *gin.Context, db *gorm.DB) *gorm.DB {
+	if org, ok := c.Get("org"); ok {
+		return scopeTenant(db, org.(uint))
+	}
+	return db
+}
+
+// isCrossTenantAdmin dit si l'appelant (et pas l'utilisateur impersoné) peut agir sur toutes les organisations
+func isCrossTenantAdmin(c *gin.Context) bool {
+	if value, ok := c.Get("impersonator"); ok {
+		return value.(User).CrossTenantAdmin
+	}
+	value, ok := c.Get("user")
+	return ok && value.(User).CrossTenantAdmin
+}
+
+// resolveTenant choisit l'organisation de la requête: celle du token (claim org), ou celle du header
+// X-Org-ID pour un administrateur multi-organisations
+func resolveTenant(c *gin.Context, user User, session Session) bool {
+	org := session.OrganizationID
+	if user.OrganizationID != org && !user.CrossTenantAdmin {
+		// l'utilisateur a changé d'organisation depuis l'émission du token
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return false
+	}
+
+	if header := strings.TrimSpace(c.GetHeader("X-Org-ID")); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid X-Org-ID"})
+			return false
+		}
+		if uint(id) != org {
+			if !isCrossTenantAdmin(c) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Cross-tenant access requires a cross-tenant admin"})
+				return false
+			}
+			if err := db.First(&Organization{}, id).Error; err != nil {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+				return false
+			}
+			org = uint(id)
+		}
+	}
+	c.Set("org", org)
+	return true
+}
+
+// requireCrossTenantAdmin réserve aux administrateurs multi-organisations les ressources communes
+// à tout le déploiement (organisations, politiques, webhooks, audit, flux d'événements)
+func requireCrossTenantAdmin(c *gin.Context) {
+	if !isCrossTenantAdmin(c) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Cross-tenant admin privilege required"})
+		return
+	}
+	c.Next()
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// Function endpoint organizations
+
+// getOrganizationsList retourne toutes les organisations
+func getOrganizationsList(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var organizations []Organization
+		if err := db.Order("id").Find(&organizations).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching organizations"})
+			return
+		}
+		c.JSON(http.StatusOK, organizations)
+	}
+}
+
+// getOrganization fetches a single organization by its ID
+func getOrganization(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var organization Organization
+		if err := db.Where("id = ?", c.Param("id")).First(&organization).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		c.JSON(http.StatusOK, organization)
+	}
+}
+
+// createOrganization crée une organisation avec un rôle Admin ("*:*") pour ses premiers administrateurs
+func createOrganization(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var organization Organization
+		if err := c.BindJSON(&organization); err != nil || organization.Name == "" || organization.Slug == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name and slug are required"})
+			return
+		}
+		organization.ID = 0
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&organization).Error; err != nil {
+				return err
+			}
+			admin := Role{Name: "Admin", Description: "Administrator role", Permissions: []string{"*:*"}}
+			return scopeTenant(tx, organization.ID).Create(&admin).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating organization"})
+			return
+		}
+		recordAudit(db, c, "organization.create", "organization", organization.ID, nil, organization)
+		c.JSON(http.StatusCreated, organization)
+	}
+}
+
+// updateOrganization renomme une organisation
+func updateOrganization(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var organization Organization
+		if err := db.Where("id = ?", c.Param("id")).First(&organization).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		before := organization
+
+		if err := c.BindJSON(&organization); err != nil || organization.Name == "" || organization.Slug == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "name and slug are required"})
+			return
+		}
+		organization.ID = before.ID
+
+		if err := db.Save(&organization).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating organization"})
+			return
+		}
+		recordAudit(db, c, "organization.update", "organization", organization.ID, before, organization)
+		c.JSON(http.StatusOK, organization)
+	}
+}
+
+// deleteOrganization supprime une organisation vide (sans utilisateur)
+func deleteOrganization(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var organization Organization
+		if err := db.Where("id = ?", c.Param("id")).First(&organization).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+			return
+		}
+		if organization.ID == defaultOrganizationID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The default organization cannot be deleted"})
+			return
+		}
+		var members int
+		if err := scopeTenant(db, organization.ID).Model(&User{}).Count(&members).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting organization"})
+			return
+		}
+		if members > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Organization still has users"})
+			return
+		}
+
+		if err := db.Delete(&organization).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting organization"})
+			return
+		}
+		recordAudit(db, c, "organization.delete", "organization", organization.ID, organization, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Organization deleted"})
+	}
+}
+
+// setCrossTenantAdmin accorde ou retire le privilège multi-organisations à un utilisateur
+func setCrossTenantAdmin(db *gorm.DB, granted bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user User
+		if err := db.Where("id = ?", c.Param("user_id")).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		before := user
+		user.CrossTenantAdmin = granted
+		if err := db.Model(&user).UpdateColumn("cross_tenant_admin", granted).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+			return
+		}
+		recordAudit(db, c, "user.cross_tenant_admin", "user", user.ID, before, user)
+		c.JSON(http.StatusOK, user)
+	}
+}
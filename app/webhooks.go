@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+const (
+	deliveryPending   = "pending"
+	deliveryRetrying  = "retrying"
+	deliveryDelivered = "delivered"
+	deliveryDead      = "dead"
+)
+
+// Webhook est un abonnement d'un système externe aux événements de l'outbox.
+// EventTypes vide signifie tous les événements.
+type Webhook struct {
+	ID          uint           `gorm:"primary_key" json:"id"`
+	URL         string         `json:"url"`
+	Secret      string         `json:"secret,omitempty"`
+	EventTypes  pq.StringArray `gorm:"type:text[]" json:"event_types"`
+	Description string         `json:"description"`
+	Active      bool           `json:"active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   *time.Time     `json:"deleted_at"`
+}
+
+// WebhookDelivery est une tentative de livraison d'un événement à un webhook
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primary_key" json:"id"`
+	WebhookID      uint       `json:"webhook_id"`
+	OutboxEventID  uint       `json:"outbox_event_id"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastError      string     `json:"last_error"`
+	ResponseStatus int        `json:"response_status"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+func (w Webhook) subscribedTo(eventType string) bool {
+	if len(w.EventTypes) == 0 {
+		return true
+	}
+	for _, pattern := range w.EventTypes {
+		if eventMatches(pattern, eventType) {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidateWebhooks vide le cache des webhooks actifs des dispatchers de tous les réplicas
+func invalidateWebhooks() {
+	if err := bus.Publish(topicCacheInvalidate, "webhooks"); err != nil {
+		log.Printf("webhooks: cannot invalidate cache: %v", err)
+	}
+}
+
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+//  Function endpoint webhook
+
+// getWebhooksList donne la liste des webhooks (sans leur secret)
+func getWebhooksList(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var webhooks []Webhook
+		if err := db.Find(&webhooks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching webhooks"})
+			return
+		}
+		for i := range webhooks {
+			webhooks[i].Secret = ""
+		}
+		c.JSON(http.StatusOK, webhooks)
+	}
+}
+
+// getWebhook fetches a single webhook by its ID
+func getWebhook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var webhook Webhook
+		if err := db.Where("id = ?", id).First(&webhook).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		webhook.Secret = ""
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// createWebhook crée un abonnement; le secret HMAC n'est renvoyé qu'à la création
+func createWebhook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhook := Webhook{Active: true}
+		if err := c.BindJSON(&webhook); err != nil || !validWebhookURL(webhook.URL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
+			return
+		}
+		if webhook.Secret == "" {
+			buf := make([]byte, 32)
+			rand.Read(buf)
+			webhook.Secret = hex.EncodeToString(buf)
+		}
+
+		if err := db.Create(&webhook).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating webhook"})
+			return
+		}
+		secret := webhook.Secret
+		webhook.Secret = ""
+		invalidateWebhooks()
+		recordAudit(db, c, "webhook.create", "webhook", webhook.ID, nil, webhook)
+		webhook.Secret = secret
+		c.JSON(http.StatusCreated, webhook)
+	}
+}
+
+// updateWebhook met à jour un webhook existant
+func updateWebhook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var webhook Webhook
+		if err := db.Where("id = ?", id).First(&webhook).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+		before := webhook
+		before.Secret = ""
+
+		if err := c.BindJSON(&webhook); err != nil || !validWebhookURL(webhook.URL) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
+			return
+		}
+
+		if err := db.Save(&webhook).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating webhook"})
+			return
+		}
+		webhook.Secret = ""
+		invalidateWebhooks()
+		recordAudit(db, c, "webhook.update", "webhook", webhook.ID, before, webhook)
+		c.JSON(http.StatusOK, webhook)
+	}
+}
+
+// deleteWebhook supprime un webhook par son ID
+func deleteWebhook(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		var webhook Webhook
+		if err := db.Where("id = ?", id).First(&webhook).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+			return
+		}
+
+		if err := db.Delete(&webhook).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting webhook"})
+			return
+		}
+		webhook.Secret = ""
+		invalidateWebhooks()
+		recordAudit(db, c, "webhook.delete", "webhook", webhook.ID, webhook, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+	}
+}
+
+// getWebhookDeliveries liste les livraisons d'un webhook, filtrables par status (ex: dead)
+func getWebhookDeliveries(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Where("webhook_id = ?", c.Param("id"))
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		page, perPage := pagination(c)
+		var deliveries []WebhookDelivery
+		if err := query.Order("id desc").Offset((page - 1) * perPage).Limit(perPage).Find(&deliveries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching deliveries"})
+			return
+		}
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// replayWebhookDeliveries remet en file les livraisons en dead-letter d'un webhook,
+// ou une seule livraison (même réussie) si delivery_id est précisé
+func replayWebhookDeliveries(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&WebhookDelivery{}).Where("webhook_id = ?", c.Param("id"))
+		if deliveryID := c.Param("delivery_id"); deliveryID != "" {
+			query = query.Where("id = ?", deliveryID)
+		} else {
+			query = query.Where("status = ?", deliveryDead)
+		}
+
+		result := query.Updates(map[string]interface{}{
+			"status":          deliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+			"last_error":      "",
+		})
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error replaying deliveries"})
+			return
+		}
+		recordAudit(db, c, "webhook.replay", "webhook", c.Param("id"), nil, gin.H{"replayed": result.RowsAffected})
+		c.JSON(http.StatusOK, gin.H{"message": "Deliveries queued", "replayed": result.RowsAffected})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func newAccessCmd() *cobra.Command {
+	accessCmd := &cobra.Command{
+		Use:   "access",
+		Short: "Demander un rôle ou un groupe, et approuver ou refuser les demandes",
+	}
+
+	// Access Request
+	requestAccessCmd := &cobra.Command{
+		Use:   "request [role|group] [id]",
+		Short: "Demander un rôle ou l'entrée dans un groupe, avec une justification",
+		Args:  cobra.ExactArgs(2),
+		Run:   requestAccess,
+	}
+	requestAccessCmd.Flags().String("justification", "", "Pourquoi cet accès est nécessaire")
+	requestAccessCmd.Flags().String("until", "", "La fin de l'accès demandé (YYYY-MM-DD ou RFC3339, permanent par défaut)")
+	accessCmd.AddCommand(requestAccessCmd)
+
+	// Access List
+	listAccessCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lister vos demandes et celles que vous pouvez approuver",
+		Run:   listAccessRequests,
+	}
+	listAccessCmd.Flags().String("status", "", "Ne garder que les demandes pending, approved, denied ou cancelled")
+	accessCmd.AddCommand(listAccessCmd)
+
+	// Access Approve / Deny
+	for _, decision := range []struct{ name, short string }{
+		{"approve", "Approuver une demande: le rôle ou le groupe est accordé tout de suite"},
+		{"deny", "Refuser une demande"},
+	} {
+		decideCmd := &cobra.Command{
+			Use:   decision.name + " [request_id]",
+			Short: decision.short,
+			Args:  cobra.ExactArgs(1),
+			Run:   decideAccessRequest(decision.name),
+		}
+		decideCmd.Flags().String("comment", "", "Un commentaire envoyé au demandeur")
+		accessCmd.AddCommand(decideCmd)
+	}
+
+	// Access Cancel
+	cancelAccessCmd := &cobra.Command{
+		Use:   "cancel [request_id]",
+		Short: "Annuler une de vos demandes en attente",
+		Args:  cobra.ExactArgs(1),
+		Run:   cancelAccessRequest,
+	}
+	accessCmd.AddCommand(cancelAccessCmd)
+
+	return accessCmd
+}
+
+////////////////////////////////////////////////////////////////	//////////////////////////////////////////////
+
+func requestAccess(cmd *cobra.Command, args []string) {
+	kind, targetId := args[0], args[1]
+	if kind != "role" && kind != "group" {
+		log.Fatalf("Error: the first argument must be role or group")
+	}
+	id, err := strconv.Atoi(targetId)
+	if err != nil {
+		log.Fatalf("Error: invalid %s ID %q", kind, targetId)
+	}
+	justification, _ := cmd.Flags().GetString("justification")
+	if justification == "" {
+		log.Fatalf("Error: --justification is required")
+	}
+
+	payload := map[string]interface{}{"kind": kind, "target_id": id, "justification": justification}
+	if until, _ := cmd.Flags().GetString("until"); until != "" {
+		date, err := parseGrantDate(until)
+		if err != nil {
+			log.Fatalf("Error: --until must be YYYY-MM-DD or RFC3339: %v", err)
+		}
+		payload["valid_until"] = date
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/access-requests/", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func listAccessRequests(cmd *cobra.Command, args []string) {
+	url := "http://app:8080/access-requests/"
+	if status, _ := cmd.Flags().GetString("status"); status != "" {
+		url += "?status=" + status
+	}
+	responseBody, err := sendRequest("GET", url, authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func decideAccessRequest(decision string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		comment, _ := cmd.Flags().GetString("comment")
+		jsonPayload, _ := json.Marshal(map[string]string{"comment": comment})
+
+		headers := authHeaders(cmd, map[string]string{
+			"Content-Type": "application/json",
+		})
+		responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/access-requests/%s/%s", args[0], decision), headers, jsonPayload)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		fmt.Println(string(responseBody))
+	}
+}
+
+func cancelAccessRequest(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/access-requests/%s", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
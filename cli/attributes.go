@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+func newAttributesCmd() *cobra.Command {
+	attributesCmd := &cobra.Command{
+		Use:   "attributes",
+		Short: "Définir les attributs personnalisés des utilisateurs (département, matricule...)",
+	}
+
+	// Attributes List
+	listAttributesCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lister les attributs définis",
+		Run:   listAttributes,
+	}
+	attributesCmd.AddCommand(listAttributesCmd)
+
+	// Attributes Define
+	defineAttributeCmd := &cobra.Command{
+		Use:   "define [key]",
+		Short: "Définir un nouvel attribut (ex: define employee_id --type string --unique --pattern '^E[0-9]{5}$')",
+		Args:  cobra.ExactArgs(1),
+		Run:   defineAttribute,
+	}
+	defineAttributeCmd.Flags().String("type", "string", "Le type des valeurs: string, number, boolean ou date")
+	defineAttributeCmd.Flags().String("label", "", "Le libellé de l'attribut")
+	defineAttributeCmd.Flags().Bool("required", false, "Chaque utilisateur doit avoir une valeur")
+	defineAttributeCmd.Flags().Bool("unique", false, "Deux utilisateurs ne peuvent pas avoir la même valeur")
+	defineAttributeCmd.Flags().String("pattern", "", "L'expression régulière des valeurs (attributs string)")
+	defineAttributeCmd.Flags().String("default", "", "La valeur donnée aux utilisateurs qui n'en ont pas (existants et créés sans attributs)")
+	attributesCmd.AddCommand(defineAttributeCmd)
+
+	// Attributes Delete
+	deleteAttributeCmd := &cobra.Command{
+		Use:   "delete [attribute_id]",
+		Short: "Supprimer un attribut et ses valeurs",
+		Args:  cobra.ExactArgs(1),
+		Run:   deleteAttribute,
+	}
+	attributesCmd.AddCommand(deleteAttributeCmd)
+
+	return attributesCmd
+}
+
+////////////////////////////////////////////////////////////////	//////////////////////////////////////////////
+
+// attrFlags lit les flags --attr key=value; une valeur vide retire l'attribut (null)
+func attrFlags(cmd *cobra.Command) map[string]interface{} {
+	pairs, _ := cmd.Flags().GetStringArray("attr")
+	if len(pairs) == 0 {
+		return nil
+	}
+	attributes := map[string]interface{}{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			log.Fatalf("Error: --attr must be key=value, got %q", pair)
+		}
+		if parts[1] == "" {
+			attributes[parts[0]] = nil
+			continue
+		}
+		attributes[parts[0]] = parts[1]
+	}
+	return attributes
+}
+
+// attrQuery traduit les flags --attr key=value en filtres ?attr.key=value
+func attrQuery(cmd *cobra.Command) string {
+	query := url.Values{}
+	for key, value := range attrFlags(cmd) {
+		if value == nil {
+			value = ""
+		}
+		query.Set("attr."+key, fmt.Sprint(value))
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+func listAttributes(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/attributes/", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func defineAttribute(cmd *cobra.Command, args []string) {
+	attributeType, _ := cmd.Flags().GetString("type")
+	label, _ := cmd.Flags().GetString("label")
+	required, _ := cmd.Flags().GetBool("required")
+	unique, _ := cmd.Flags().GetBool("unique")
+	pattern, _ := cmd.Flags().GetString("pattern")
+
+	payload := map[string]interface{}{
+		"key":      args[0],
+		"type":     attributeType,
+		"label":    label,
+		"required": required,
+		"unique":   unique,
+		"pattern":  pattern,
+	}
+	if cmd.Flags().Changed("default") {
+		payload["default"], _ = cmd.Flags().GetString("default")
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/attributes/", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func deleteAttribute(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/attributes/%s", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type auditEvent struct {
+	ID         uint            `json:"id"`
+	ActorID    *uint           `json:"actor_id"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	Diff       json.RawMessage `json:"diff"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	RequestID  string          `json:"request_id"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+func newAuditCmd() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Consulter le journal d'audit",
+	}
+
+	// Audit Tail
+	tailAuditCmd := &cobra.Command{
+		Use:   "tail",
+		Short: "Afficher les derniers événements d'audit",
+		Run:   tailAudit,
+	}
+	tailAuditCmd.Flags().Int("limit", 20, "Le nombre d'événements à afficher")
+	tailAuditCmd.Flags().BoolP("follow", "f", false, "Continuer à afficher les nouveaux événements")
+	tailAuditCmd.Flags().Duration("interval", 2*time.Second, "L'intervalle entre deux requêtes avec --follow")
+	auditCmd.AddCommand(tailAuditCmd)
+
+	// Audit Search
+	searchAuditCmd := &cobra.Command{
+		Use:   "search",
+		Short: "Rechercher dans le journal d'audit",
+		Run:   searchAudit,
+	}
+	searchAuditCmd.Flags().String("actor", "", "L'email de l'acteur")
+	searchAuditCmd.Flags().String("actor_id", "", "L'ID de l'acteur")
+	searchAuditCmd.Flags().String("action", "", "L'action (ex: user.update, login.failure)")
+	searchAuditCmd.Flags().String("target_type", "", "Le type de la cible (user, role, group)")
+	searchAuditCmd.Flags().String("target_id", "", "L'ID de la cible")
+	searchAuditCmd.Flags().String("request_id", "", "L'ID de la requête")
+	searchAuditCmd.Flags().String("since", "", "Date de début (RFC3339)")
+	searchAuditCmd.Flags().String("until", "", "Date de fin (RFC3339)")
+	searchAuditCmd.Flags().Int("page", 1, "La page à afficher")
+	searchAuditCmd.Flags().Int("per_page", 50, "Le nombre d'événements par page")
+	auditCmd.AddCommand(searchAuditCmd)
+
+	// Audit Export
+	exportAuditCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Exporter le journal d'audit et ses checkpoints signés",
+		Run:   exportAudit,
+	}
+	exportAuditCmd.Flags().String("output", "audit-export.json", "Le fichier de sortie")
+	auditCmd.AddCommand(exportAuditCmd)
+
+	// Audit Verify
+	verifyAuditCmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Vérifier la chaîne d'audit (sur le serveur, ou hors ligne avec --file)",
+		Run:   verifyAudit,
+	}
+	verifyAuditCmd.Flags().String("file", "", "Un export à vérifier hors ligne")
+	verifyAuditCmd.Flags().String("public_key", "", "La clé publique attendue (base64), obligatoire avec --file (ou AUDIT_PUBLIC_KEY)")
+	auditCmd.AddCommand(verifyAuditCmd)
+
+	return auditCmd
+}
+
+func fetchAuditEvents(cmd *cobra.Command, query url.Values) []auditEvent {
+	responseBody, err := sendRequest("GET", "http://app:8080/audit?"+query.Encode(), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	var events []auditEvent
+	if err := json.Unmarshal(responseBody, &events); err != nil {
+		log.Fatalf("Error: %s", string(responseBody))
+	}
+	return events
+}
+
+func printAuditEvent(event auditEvent) {
+	fmt.Printf("%s #%d %s %s %s/%s", event.CreatedAt.Format(time.RFC3339), event.ID, event.Actor, event.Action, event.TargetType, event.TargetID)
+	if len(event.Diff) > 0 && string(event.Diff) != "null" {
+		fmt.Printf(" %s", string(event.Diff))
+	}
+	fmt.Println()
+}
+
+func tailAudit(cmd *cobra.Command, args []string) {
+	limit, _ := cmd.Flags().GetInt("limit")
+	follow, _ := cmd.Flags().GetBool("follow")
+	interval, _ := cmd.Flags().GetDuration("interval")
+
+	query := url.Values{}
+	query.Set("per_page", fmt.Sprint(limit))
+	events := fetchAuditEvents(cmd, query)
+
+	var lastID uint
+	for i := len(events) - 1; i >= 0; i-- {
+		printAuditEvent(events[i])
+		lastID = events[i].ID
+	}
+
+	for follow {
+		time.Sleep(interval)
+		query := url.Values{}
+		query.Set("after_id", fmt.Sprint(lastID))
+		query.Set("order", "asc")
+		query.Set("per_page", "500")
+		for _, event := range fetchAuditEvents(cmd, query) {
+			printAuditEvent(event)
+			lastID = event.ID
+		}
+	}
+}
+
+func searchAudit(cmd *cobra.Command, args []string) {
+	query := url.Values{}
+	for _, name := range []string{"actor", "actor_id", "action", "target_type", "target_id", "request_id", "since", "until"} {
+		if value, _ := cmd.Flags().GetString(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	page, _ := cmd.Flags().GetInt("page")
+	perPage, _ := cmd.Flags().GetInt("per_page")
+	query.Set("page", fmt.Sprint(page))
+	query.Set("per_page", fmt.Sprint(perPage))
+
+	for _, event := range fetchAuditEvents(cmd, query) {
+		printAuditEvent(event)
+	}
+}
+
+type auditCheckpoint struct {
+	ID        uint   `json:"id"`
+	EventID   uint   `json:"event_id"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+}
+
+type auditExport struct {
+	Format      string            `json:"format"`
+	PublicKey   string            `json:"public_key"`
+	Events      []auditEvent      `json:"events"`
+	Checkpoints []auditCheckpoint `json:"checkpoints"`
+}
+
+func exportAudit(cmd *cobra.Command, args []string) {
+	output, _ := cmd.Flags().GetString("output")
+
+	responseBody, err := sendRequest("GET", "http://app:8080/audit/export", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var export auditExport
+	if err := json.Unmarshal(responseBody, &export); err != nil || export.Format == "" {
+		log.Fatalf("Error: %s", string(responseBody))
+	}
+
+	if err := ioutil.WriteFile(output, responseBody, 0644); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Printf("%d events and %d checkpoints exported to %s\n", len(export.Events), len(export.Checkpoints), output)
+}
+
+func verifyAudit(cmd *cobra.Command, args []string) {
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		responseBody, err := sendRequest("GET", "http://app:8080/audit/verify", authHeaders(cmd, nil), nil)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Println(string(responseBody))
+		return
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var export auditExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		log.Fatalf("Error: invalid export: %v", err)
+	}
+	if export.Format != "audit-export/v1" {
+		log.Fatalf("Error: unsupported export format %q", export.Format)
+	}
+
+	// la clé de l'export ne prouve rien: qui réécrit l'export peut le signer avec sa propre clé
+	encodedKey, _ := cmd.Flags().GetString("public_key")
+	if encodedKey == "" {
+		encodedKey = os.Getenv("AUDIT_PUBLIC_KEY")
+	}
+	if encodedKey == "" {
+		log.Fatalf("Error: --public_key (or AUDIT_PUBLIC_KEY) is required to verify an export, the one printed by app audit keygen")
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		log.Fatalf("Error: invalid public key")
+	}
+	publicKey := ed25519.PublicKey(key)
+	if export.PublicKey != "" && export.PublicKey != encodedKey {
+		fmt.Println("warning: the export names another public key, checkpoints are verified with the given one")
+	}
+
+	if reason := verifyAuditExport(export, publicKey); reason != "" {
+		fmt.Println(reason)
+		os.Exit(1)
+	}
+	fmt.Printf("audit export OK: %d events, %d checkpoints verified\n", len(export.Events), len(export.Checkpoints))
+	if len(export.Checkpoints) == 0 {
+		fmt.Println("warning: no checkpoint, the events are not covered by a signature")
+	} else if last := export.Checkpoints[len(export.Checkpoints)-1].EventID; len(export.Events) > 0 && export.Events[len(export.Events)-1].ID != last {
+		fmt.Printf("warning: events after %d are not covered by a signature yet\n", last)
+	}
+}
+
+// verifyAuditExport retourne la première rupture de la chaîne, ou "" si l'export est intègre
+func verifyAuditExport(export auditExport, publicKey ed25519.PublicKey) string {
+	hashes := map[uint]string{}
+	prevHash := ""
+	for _, event := range export.Events {
+		if event.PrevHash != prevHash {
+			return fmt.Sprintf("chain broken at event %d: prev_hash does not match the previous event (missing or reordered event)", event.ID)
+		}
+		if auditHash(event) != event.Hash {
+			return fmt.Sprintf("chain broken at event %d: hash does not match the event content (event altered)", event.ID)
+		}
+		prevHash = event.Hash
+		hashes[event.ID] = event.Hash
+	}
+
+	for _, checkpoint := range export.Checkpoints {
+		hash, ok := hashes[checkpoint.EventID]
+		if !ok || hash != checkpoint.Hash {
+			return fmt.Sprintf("checkpoint %d does not match event %d", checkpoint.ID, checkpoint.EventID)
+		}
+		if publicKey == nil {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(checkpoint.Signature)
+		message := []byte(fmt.Sprintf("%d:%s", checkpoint.EventID, checkpoint.Hash))
+		if err != nil || !ed25519.Verify(publicKey, message, signature) {
+			return fmt.Sprintf("checkpoint %d has an invalid signature", checkpoint.ID)
+		}
+	}
+	return ""
+}
+
+// auditHash doit rester identique au calcul de l'API (app/audit_chain.go)
+func auditHash(event auditEvent) string {
+	var diff interface{}
+	if len(event.Diff) > 0 {
+		json.Unmarshal(event.Diff, &diff)
+	}
+	canonical, _ := json.Marshal(struct {
+		ActorID    *uint       `json:"actor_id"`
+		Actor      string      `json:"actor"`
+		Action     string      `json:"action"`
+		TargetType string      `json:"target_type"`
+		TargetID   string      `json:"target_id"`
+		Diff       interface{} `json:"diff"`
+		IP         string      `json:"ip"`
+		UserAgent  string      `json:"user_agent"`
+		RequestID  string      `json:"request_id"`
+		CreatedAt  string      `json:"created_at"`
+	}{
+		event.ActorID, event.Actor, event.Action, event.TargetType, event.TargetID, diff,
+		event.IP, event.UserAgent, event.RequestID, event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(append([]byte(event.PrevHash+"\n"), canonical...))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+type authzDecision struct {
+	UserID   uint   `json:"user_id"`
+	Action   string `json:"action"`
+	Resource string `json:"resource"`
+	Allowed  bool   `json:"allowed"`
+	Reason   string `json:"reason"`
+}
+
+func newAuthzCmd() *cobra.Command {
+	authzCmd := &cobra.Command{
+		Use:   "authz",
+		Short: "Vérifier les autorisations des utilisateurs",
+	}
+
+	// Authz Check
+	checkCmd := &cobra.Command{
+		Use:   "check",
+		Short: "Vérifier si un utilisateur peut faire une action sur une ou plusieurs ressources",
+		Run:   checkAuthz,
+	}
+	checkCmd.Flags().String("user", "", "L'ID ou l'email de l'utilisateur (l'utilisateur du token si vide)")
+	checkCmd.Flags().String("action", "", "L'action (ex: read, update)")
+	checkCmd.Flags().StringSlice("resource", nil, "Les ressources (ex: users,groups/3), vérifiées en un seul lot")
+	authzCmd.AddCommand(checkCmd)
+
+	return authzCmd
+}
+
+// checkAuthz affiche une ligne par décision et sort en erreur si une vérification est refusée
+func checkAuthz(cmd *cobra.Command, args []string) {
+	user, _ := cmd.Flags().GetString("user")
+	action, _ := cmd.Flags().GetString("action")
+	resources, _ := cmd.Flags().GetStringSlice("resource")
+	if action == "" || len(resources) == 0 {
+		log.Fatalf("Error: --action and --resource are required")
+	}
+
+	checks := []map[string]string{}
+	for _, resource := range resources {
+		check := map[string]string{"action": action, "resource": resource}
+		if user != "" {
+			check["user"] = user
+		}
+		checks = append(checks, check)
+	}
+	jsonPayload, _ := json.Marshal(map[string]interface{}{"checks": checks})
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/authz/check", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	var response struct {
+		Results []authzDecision `json:"results"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil || response.Results == nil {
+		log.Fatalf("Error: %s", string(responseBody))
+	}
+
+	denied := false
+	for _, decision := range response.Results {
+		verdict := "allow"
+		if !decision.Allowed {
+			verdict = "deny"
+			denied = true
+		}
+		fmt.Printf("%-5s %s %s: %s\n", verdict, decision.Action, decision.Resource, decision.Reason)
+	}
+	if denied {
+		os.Exit(1)
+	}
+}
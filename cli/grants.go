@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newGrantsCmd() *cobra.Command {
+	grantsCmd := &cobra.Command{
+		Use:   "grants",
+		Short: "Accorder des rôles et des groupes, pour une durée limitée ou non",
+	}
+
+	// Grants List
+	listGrantsCmd := &cobra.Command{
+		Use:   "list [user_id]",
+		Short: "Lister les rôles et groupes accordés à un utilisateur, avec leur période de validité",
+		Args:  cobra.ExactArgs(1),
+		Run:   listGrants,
+	}
+	grantsCmd.AddCommand(listGrantsCmd)
+
+	// Grants Role / Group
+	for _, target := range []struct{ kind, label string }{{"role", "rôle"}, {"group", "groupe"}} {
+		kind := target.kind
+		grantCmd := &cobra.Command{
+			Use:   fmt.Sprintf("%s [user_id] [%s_id]", kind, kind),
+			Short: "Accorder un " + target.label + " (ex: --until 2026-12-01 pour un accès temporaire)",
+			Args:  cobra.ExactArgs(2),
+			Run:   grantTo(kind + "s"),
+		}
+		grantCmd.Flags().String("from", "", "Le début de validité (YYYY-MM-DD ou RFC3339, tout de suite par défaut)")
+		grantCmd.Flags().String("until", "", "La fin de validité (YYYY-MM-DD ou RFC3339, permanent par défaut)")
+		grantCmd.Flags().String("reason", "", "La raison de l'attribution")
+		grantsCmd.AddCommand(grantCmd)
+
+		revokeCmd := &cobra.Command{
+			Use:   fmt.Sprintf("revoke-%s [user_id] [%s_id]", kind, kind),
+			Short: "Retirer un " + target.label + " tout de suite",
+			Args:  cobra.ExactArgs(2),
+			Run:   revokeFrom(kind + "s"),
+		}
+		grantsCmd.AddCommand(revokeCmd)
+	}
+
+	return grantsCmd
+}
+
+////////////////////////////////////////////////////////////////	//////////////////////////////////////////////
+
+// parseGrantDate accepte une date (YYYY-MM-DD, minuit UTC) ou une date RFC3339
+func parseGrantDate(value string) (string, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date.Format(time.RFC3339), nil
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return "", err
+	}
+	return date.Format(time.RFC3339), nil
+}
+
+func listGrants(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/users/%s/grants", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+// grantPayload construit le corps d'un grant à partir des flags --from, --until et --reason
+func grantPayload(cmd *cobra.Command) []byte {
+	payload := map[string]string{}
+	for _, flag := range []string{"from", "until"} {
+		value, _ := cmd.Flags().GetString(flag)
+		if value == "" {
+			continue
+		}
+		date, err := parseGrantDate(value)
+		if err != nil {
+			log.Fatalf("Error: --%s must be YYYY-MM-DD or RFC3339: %v", flag, err)
+		}
+		payload["valid_"+flag] = date
+	}
+	if reason, _ := cmd.Flags().GetString("reason"); reason != "" {
+		payload["reason"] = reason
+	}
+	jsonPayload, _ := json.Marshal(payload)
+	return jsonPayload
+}
+
+func grantTo(collection string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		jsonPayload := grantPayload(cmd)
+
+		headers := authHeaders(cmd, map[string]string{
+			"Content-Type": "application/json",
+		})
+		responseBody, err := sendRequest("PUT", fmt.Sprintf("http://app:8080/users/%s/%s/%s", args[0], collection, args[1]), headers, jsonPayload)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		fmt.Println(string(responseBody))
+	}
+}
+
+func revokeFrom(collection string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/users/%s/%s/%s", args[0], collection, args[1]), authHeaders(cmd, nil), nil)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		fmt.Println(string(responseBody))
+	}
+}
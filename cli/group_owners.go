@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+func newGroupOwnersCmd() *cobra.Command {
+	ownersCmd := &cobra.Command{
+		Use:   "owners",
+		Short: "Gérer les propriétaires d'un groupe, qui administrent ses membres et ses sous-groupes",
+	}
+
+	// Owners List
+	listOwnersCmd := &cobra.Command{
+		Use:   "list [group_id]",
+		Short: "Lister les propriétaires d'un groupe",
+		Args:  cobra.ExactArgs(1),
+		Run:   listGroupOwners,
+	}
+	ownersCmd.AddCommand(listOwnersCmd)
+
+	// Owners Add
+	addOwnerCmd := &cobra.Command{
+		Use:   "add [group_id] [user_id]",
+		Short: "Nommer un utilisateur propriétaire du groupe et de ses sous-groupes",
+		Args:  cobra.ExactArgs(2),
+		Run:   setGroupOwner("PUT"),
+	}
+	ownersCmd.AddCommand(addOwnerCmd)
+
+	// Owners Remove
+	removeOwnerCmd := &cobra.Command{
+		Use:   "remove [group_id] [user_id]",
+		Short: "Retirer un propriétaire du groupe",
+		Args:  cobra.ExactArgs(2),
+		Run:   setGroupOwner("DELETE"),
+	}
+	ownersCmd.AddCommand(removeOwnerCmd)
+
+	return ownersCmd
+}
+
+func newGroupMembersCmd() *cobra.Command {
+	membersCmd := &cobra.Command{
+		Use:   "members",
+		Short: "Gérer les membres d'un groupe (administrateurs et propriétaires du groupe)",
+	}
+
+	// Members List
+	listMembersCmd := &cobra.Command{
+		Use:   "list [group_id]",
+		Short: "Lister les membres directs d'un groupe",
+		Args:  cobra.ExactArgs(1),
+		Run:   listGroupMembers,
+	}
+	membersCmd.AddCommand(listMembersCmd)
+
+	// Members Add
+	addMemberCmd := &cobra.Command{
+		Use:   "add [group_id] [user_id]",
+		Short: "Ajouter un membre au groupe (ex: --until 2026-12-01 pour un accès temporaire)",
+		Args:  cobra.ExactArgs(2),
+		Run:   addGroupMember,
+	}
+	addMemberCmd.Flags().String("from", "", "Le début de validité (YYYY-MM-DD ou RFC3339, tout de suite par défaut)")
+	addMemberCmd.Flags().String("until", "", "La fin de validité (YYYY-MM-DD ou RFC3339, permanent par défaut)")
+	addMemberCmd.Flags().String("reason", "", "La raison de l'ajout")
+	membersCmd.AddCommand(addMemberCmd)
+
+	// Members Remove
+	removeMemberCmd := &cobra.Command{
+		Use:   "remove [group_id] [user_id]",
+		Short: "Retirer un membre du groupe",
+		Args:  cobra.ExactArgs(2),
+		Run:   removeGroupMember,
+	}
+	membersCmd.AddCommand(removeMemberCmd)
+
+	return membersCmd
+}
+
+func newSubgroupCmd() *cobra.Command {
+	subgroupCmd := &cobra.Command{
+		Use:   "subgroup [parent_group_id]",
+		Short: "Créer un sous-groupe (administrateurs et propriétaires du groupe parent)",
+		Args:  cobra.ExactArgs(1),
+		Run:   createSubgroup,
+	}
+	subgroupCmd.Flags().String("name", "", "Le nom du sous-groupe")
+
+	return subgroupCmd
+}
+
+////////////////////////////////////////////////////////////////	//////////////////////////////////////////////
+
+func listGroupOwners(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/groups/%s/owners", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func setGroupOwner(method string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		responseBody, err := sendRequest(method, fmt.Sprintf("http://app:8080/groups/%s/owners/%s", args[0], args[1]), authHeaders(cmd, nil), nil)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		fmt.Println(string(responseBody))
+	}
+}
+
+func listGroupMembers(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/groups/%s/members", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func addGroupMember(cmd *cobra.Command, args []string) {
+	jsonPayload := grantPayload(cmd)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("PUT", fmt.Sprintf("http://app:8080/groups/%s/members/%s", args[0], args[1]), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func removeGroupMember(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/groups/%s/members/%s", args[0], args[1]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func createSubgroup(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	if name == "" {
+		log.Fatalf("Error: --name is required")
+	}
+	jsonPayload, _ := json.Marshal(map[string]string{"name": name})
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/groups/%s/subgroups", args[0]), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+func newPreviewRuleCmd() *cobra.Command {
+	previewRuleCmd := &cobra.Command{
+		Use:   "preview-rule [rule]",
+		Short: "Voir quels utilisateurs vérifient une règle d'appartenance avant de l'enregistrer",
+		Args:  cobra.ExactArgs(1),
+		Run:   previewRule,
+	}
+	previewRuleCmd.Flags().String("group", "", "L'ID d'un groupe existant, pour voir les membres ajoutés et retirés")
+
+	return previewRuleCmd
+}
+
+////////////////////////////////////////////////////////////////	//////////////////////////////////////////////
+
+func previewRule(cmd *cobra.Command, args []string) {
+	payload := map[string]interface{}{"membership_rule": args[0]}
+	if group, _ := cmd.Flags().GetString("group"); group != "" {
+		id, err := strconv.Atoi(group)
+		if err != nil {
+			log.Fatalf("Error: invalid group ID %q", group)
+		}
+		payload["group_id"] = id
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/groups/rule-preview", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
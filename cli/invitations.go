@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newInviteCmd() *cobra.Command {
+	inviteCmd := &cobra.Command{
+		Use:   "invite",
+		Short: "Inviter un utilisateur par email: il choisira son mot de passe en acceptant l'invitation",
+		Run:   invite,
+	}
+	inviteCmd.Flags().String("email", "", "L'adresse email de l'invité")
+	inviteCmd.Flags().String("name", "", "Le nom de l'invité")
+	inviteCmd.Flags().IntSlice("roles", nil, "Les IDs des rôles accordés à l'acceptation")
+	inviteCmd.Flags().IntSlice("groups", nil, "Les IDs des groupes rejoints à l'acceptation")
+	inviteCmd.Flags().Duration("expires", 0, "La durée de validité de l'invitation (ex: 72h, 7 jours par défaut)")
+	return inviteCmd
+}
+
+func newInvitationsCmd() *cobra.Command {
+	invitationsCmd := &cobra.Command{
+		Use:   "invitations",
+		Short: "Lister, révoquer et accepter les invitations",
+	}
+
+	// Invitations List
+	listInvitationsCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lister les invitations en attente",
+		Run:   listInvitations,
+	}
+	invitationsCmd.AddCommand(listInvitationsCmd)
+
+	// Invitations Revoke
+	revokeInvitationCmd := &cobra.Command{
+		Use:   "revoke [invitation_id]",
+		Short: "Révoquer une invitation en attente",
+		Args:  cobra.ExactArgs(1),
+		Run:   revokeInvitation,
+	}
+	invitationsCmd.AddCommand(revokeInvitationCmd)
+
+	// Invitations Accept
+	acceptInvitationCmd := &cobra.Command{
+		Use:   "accept [token]",
+		Short: "Accepter une invitation et créer son compte",
+		Args:  cobra.ExactArgs(1),
+		Run:   acceptInvitation,
+	}
+	acceptInvitationCmd.Flags().String("password", "", "Le mot de passe du compte")
+	acceptInvitationCmd.Flags().String("name", "", "Le nom de l'utilisateur (celui de l'invitation par défaut)")
+	invitationsCmd.AddCommand(acceptInvitationCmd)
+
+	return invitationsCmd
+}
+
+func invite(cmd *cobra.Command, args []string) {
+	email, _ := cmd.Flags().GetString("email")
+	name, _ := cmd.Flags().GetString("name")
+	roles, _ := cmd.Flags().GetIntSlice("roles")
+	groups, _ := cmd.Flags().GetIntSlice("groups")
+	expires, _ := cmd.Flags().GetDuration("expires")
+
+	payload := map[string]interface{}{
+		"email":  email,
+		"name":   name,
+		"roles":  roles,
+		"groups": groups,
+	}
+	if expires > 0 {
+		payload["expires_at"] = time.Now().Add(expires).Format(time.RFC3339)
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/invitations/", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func listInvitations(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/invitations/", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func revokeInvitation(cmd *cobra.Command, args []string) {
+	invitationID := args[0]
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/invitations/%s", invitationID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func acceptInvitation(cmd *cobra.Command, args []string) {
+	token := args[0]
+	password, _ := cmd.Flags().GetString("password")
+	name, _ := cmd.Flags().GetString("name")
+
+	payload := map[string]string{
+		"password": password,
+		"name":     name,
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/invitations/%s/accept", token), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
@@ -21,6 +21,8 @@ func main() {
 			fmt.Println("Use a subcommand to interact with the API. Run ' --help' for usage.")
 		},
 	}
+	rootCmd.PersistentFlags().String("token", "", "Le jeton JWT renvoyé par login (par défaut la variable API_TOKEN)")
+	rootCmd.PersistentFlags().String("org", "", "L'ID de l'organisation ciblée, pour un administrateur multi-organisations (par défaut la variable ORG_ID)")
 
 	serverCmd := &cobra.Command{
 		Use:   "server",
@@ -37,6 +39,7 @@ func main() {
 	}
 	loginCmd.Flags().String("email", "", "L'adresse email de l'utilisateur")
 	loginCmd.Flags().String("password", "", "Le mot de passe de l'utilisateur")
+	loginCmd.Flags().String("device", "cli", "Le nom de l'appareil, affiché dans la liste des sessions")
 	rootCmd.AddCommand(loginCmd)
 
 	// Refresh
@@ -71,6 +74,7 @@ func main() {
 		Short: "Lister tous les utilisateurs",
 		Run:   listUsers,
 	}
+	listUsersCmd.Flags().StringArray("attr", nil, "Ne garder que les utilisateurs avec cet attribut (key=value, répétable)")
 	usersCmd.AddCommand(listUsersCmd)
 
 	// Users Get
@@ -93,6 +97,8 @@ func main() {
 	createUserCmd.Flags().String("password", "", "Le mot de passe de l'utilisateur")
 	createUserCmd.Flags().StringSlice("roles", nil, "Les rôles de l'utilisateur (potentiellement vide)")
 	createUserCmd.Flags().StringSlice("groups", nil, "Les groupes de l'utilisateur (potentiellement vide)")
+	createUserCmd.Flags().StringArray("attr", nil, "Un attribut personnalisé key=value (répétable, ex: --attr department=Sales)")
+	createUserCmd.Flags().String("manager", "", "L'ID du manager direct de l'utilisateur")
 	usersCmd.AddCommand(createUserCmd)
 
 	// Users Update
@@ -107,6 +113,8 @@ func main() {
 	updateUserCmd.Flags().String("password", "", "Le nouveau mot de passe de l'utilisateur")
 	updateUserCmd.Flags().StringSlice("roles", nil, "Les nouveaux rôles de l'utilisateur")
 	updateUserCmd.Flags().StringSlice("groups", nil, "Les nouveaux groupes de l'utilisateur")
+	updateUserCmd.Flags().StringArray("attr", nil, "Un attribut à modifier key=value (répétable, key= pour le retirer)")
+	updateUserCmd.Flags().String("manager", "", "L'ID du nouveau manager direct (--manager= pour le retirer)")
 	usersCmd.AddCommand(updateUserCmd)
 
 	// Users Delete
@@ -118,6 +126,51 @@ func main() {
 	}
 	usersCmd.AddCommand(deleteUserCmd)
 
+	// Users Impersonate
+	impersonateUserCmd := &cobra.Command{
+		Use:   "impersonate [user_id]",
+		Short: "Obtenir un jeton court au nom d'un utilisateur (administrateurs)",
+		Args:  cobra.ExactArgs(1),
+		Run:   impersonateUser,
+	}
+	impersonateUserCmd.Flags().String("reason", "", "La raison de l'impersonation, enregistrée dans l'audit")
+	usersCmd.AddCommand(impersonateUserCmd)
+
+	// Users Suspend
+	suspendUserCmd := &cobra.Command{
+		Use:   "suspend [user_id]",
+		Short: "Suspendre un compte: il ne peut plus se connecter jusqu'à sa réactivation",
+		Args:  cobra.ExactArgs(1),
+		Run:   suspendUser,
+	}
+	suspendUserCmd.Flags().String("reason", "", "La raison de la suspension")
+	usersCmd.AddCommand(suspendUserCmd)
+
+	// Users Deactivate
+	deactivateUserCmd := &cobra.Command{
+		Use:   "deactivate [user_id]",
+		Short: "Désactiver un compte tout de suite, ou à une date donnée",
+		Args:  cobra.ExactArgs(1),
+		Run:   deactivateUser,
+	}
+	deactivateUserCmd.Flags().String("reason", "", "La raison de la désactivation")
+	deactivateUserCmd.Flags().String("at", "", "La date de désactivation programmée (RFC3339, ex: 2026-12-31T18:00:00Z)")
+	usersCmd.AddCommand(deactivateUserCmd)
+
+	// Users Reactivate
+	reactivateUserCmd := &cobra.Command{
+		Use:   "reactivate [user_id]",
+		Short: "Réactiver un compte et annuler sa désactivation programmée",
+		Args:  cobra.ExactArgs(1),
+		Run:   reactivateUser,
+	}
+	usersCmd.AddCommand(reactivateUserCmd)
+
+	// Users Reports, Managers & Org chart
+	usersCmd.AddCommand(newReportsCmd())
+	usersCmd.AddCommand(newManagersCmd())
+	usersCmd.AddCommand(newOrgChartCmd())
+
 	// Roles
 	rolesCmd := &cobra.Command{
 		Use:   "roles",
@@ -150,6 +203,7 @@ func main() {
 	}
 	createRoleCmd.Flags().String("name", "", "Le nom du rôle")
 	createRoleCmd.Flags().String("description", "", "La description du rôle")
+	createRoleCmd.Flags().StringSlice("permissions", nil, "Les permissions action:ressource (ex: read:*,update:groups/*)")
 	rolesCmd.AddCommand(createRoleCmd)
 
 	// Roles Update
@@ -204,6 +258,7 @@ func main() {
 	}
 	createGroupCmd.Flags().String("name", "", "Le nom du groupe")
 	createGroupCmd.Flags().String("parent_group_id", "", "L'ID du groupe parent")
+	createGroupCmd.Flags().String("rule", "", "La règle d'appartenance CEL d'un groupe dynamique (ex: user.email.endsWith(\"@sales.example.com\"))")
 	groupsCmd.AddCommand(createGroupCmd)
 
 	// Groups Update
@@ -224,8 +279,58 @@ func main() {
 	rolesCmd.AddCommand(deleteGroupCmd)
 
 	updateGroupCmd.Flags().String("name", "", "Le nouveau nom du groupe")
+	updateGroupCmd.Flags().String("rule", "", "La nouvelle règle d'appartenance (\"\" pour un groupe statique)")
 	groupsCmd.AddCommand(updateGroupCmd)
 
+	// Groups Owners / Members / Subgroup (administration déléguée)
+	groupsCmd.AddCommand(newGroupOwnersCmd())
+	groupsCmd.AddCommand(newGroupMembersCmd())
+	groupsCmd.AddCommand(newSubgroupCmd())
+
+	// Groups Preview Rule (groupes dynamiques)
+	groupsCmd.AddCommand(newPreviewRuleCmd())
+
+	// Attributes
+	rootCmd.AddCommand(newAttributesCmd())
+
+	// Audit
+	rootCmd.AddCommand(newAuditCmd())
+
+	// Webhooks
+	rootCmd.AddCommand(newWebhooksCmd())
+
+	// Watch
+	rootCmd.AddCommand(newWatchCmd())
+
+	// Authz
+	rootCmd.AddCommand(newAuthzCmd())
+
+	// Policies
+	rootCmd.AddCommand(newPoliciesCmd())
+
+	// Me
+	rootCmd.AddCommand(newWhoamiCmd())
+	rootCmd.AddCommand(newMeCmd())
+
+	// Sessions
+	rootCmd.AddCommand(newSessionsCmd())
+
+	// Organizations
+	rootCmd.AddCommand(newOrgsCmd())
+
+	// Invitations
+	rootCmd.AddCommand(newInviteCmd())
+	rootCmd.AddCommand(newInvitationsCmd())
+
+	// Grants
+	rootCmd.AddCommand(newGrantsCmd())
+
+	// Access requests
+	rootCmd.AddCommand(newAccessCmd())
+
+	// Access reviews
+	rootCmd.AddCommand(newReviewsCmd())
+
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -261,13 +366,37 @@ func sendRequest(method, url string, headers map[string]string, body []byte) ([]
 	return responseBody, nil
 }
 
+// authHeaders ajoute le cookie Authorization attendu par requireAuth (flag --token ou variable API_TOKEN)
+func authHeaders(cmd *cobra.Command, headers map[string]string) map[string]string {
+	token, _ := cmd.Flags().GetString("token")
+	if token == "" {
+		token = os.Getenv("API_TOKEN")
+	}
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if token != "" {
+		headers["Cookie"] = fmt.Sprintf("Authorization=%s", token)
+	}
+	org, _ := cmd.Flags().GetString("org")
+	if org == "" {
+		org = os.Getenv("ORG_ID")
+	}
+	if org != "" {
+		headers["X-Org-ID"] = org
+	}
+	return headers
+}
+
 func login(cmd *cobra.Command, args []string) {
 	email, _ := cmd.Flags().GetString("email")
 	password, _ := cmd.Flags().GetString("password")
+	device, _ := cmd.Flags().GetString("device")
 
 	payload := map[string]string{
 		"email":    email,
 		"password": password,
+		"device":   device,
 	}
 	jsonPayload, _ := json.Marshal(payload)
 
@@ -318,7 +447,7 @@ func logout(cmd *cobra.Command, args []string) {
 }
 
 func listUsers(cmd *cobra.Command, args []string) {
-	responseBody, err := sendRequest("GET", "http://app:8080/users/", nil, nil)
+	responseBody, err := sendRequest("GET", "http://app:8080/users/"+attrQuery(cmd), authHeaders(cmd, nil), nil)
 	if err != nil {
 		log.Fatalf("Error: %v", err)
 	}
@@ -328,20 +457,25 @@ func listUsers(cmd *cobra.Command, args []string) {
 
 func updateUser(cmd *cobra.Command, args []string) {
 	userId := args[0]
-	email, _ := cmd.Flags().GetString("email")
-	password, _ := cmd.Flags().GetString("password")
-	name, _ := cmd.Flags().GetString("name")
 
-	payload := map[string]string{
-		"email":    email,
-		"password": password,
-		"name":     name,
+	// seuls les champs passés en flag sont modifiés
+	payload := map[string]interface{}{}
+	for _, flag := range []string{"email", "password", "name"} {
+		if cmd.Flags().Changed(flag) {
+			payload[flag], _ = cmd.Flags().GetString(flag)
+		}
+	}
+	if attributes := attrFlags(cmd); attributes != nil {
+		payload["attributes"] = attributes
+	}
+	if cmd.Flags().Changed("manager") {
+		payload["manager_id"] = managerFlag(cmd)
 	}
 	jsonPayload, _ := json.Marshal(payload)
 
-	headers := map[string]string{
+	headers := authHeaders(cmd, map[string]string{
 		"Content-Type": "application/json",
-	}
+	})
 	responseBody, err := sendRequest("PUT", fmt.Sprintf("http://app:8080/users/%s", userId), headers, jsonPayload)
 	if err != nil {
 		log.Fatalf("Error: %v", err)
@@ -365,16 +499,22 @@ func createUser(cmd *cobra.Command, args []string) {
 	password, _ := cmd.Flags().GetString("password")
 	name, _ := cmd.Flags().GetString("name")
 
-	payload := map[string]string{
+	payload := map[string]interface{}{
 		"email":    email,
 		"password": password,
 		"name":     name,
 	}
+	if attributes := attrFlags(cmd); attributes != nil {
+		payload["attributes"] = attributes
+	}
+	if manager := managerFlag(cmd); manager != nil {
+		payload["manager_id"] = manager
+	}
 	jsonPayload, _ := json.Marshal(payload)
 
-	headers := map[string]string{
+	headers := authHeaders(cmd, map[string]string{
 		"Content-Type": "application/json",
-	}
+	})
 	responseBody, err := sendRequest("POST", "http://app:8080/users/", headers, jsonPayload)
 	if err != nil {
 		log.Fatalf("Error: %v", err)
@@ -392,6 +532,79 @@ func deleteUser(cmd *cobra.Command, args []string) {
 	fmt.Println(string(responseBody))
 }
 
+func impersonateUser(cmd *cobra.Command, args []string) {
+	userId := args[0]
+	reason, _ := cmd.Flags().GetString("reason")
+	if reason == "" {
+		log.Fatalf("Error: --reason is required")
+	}
+	jsonPayload, _ := json.Marshal(map[string]string{"reason": reason})
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/users/%s/impersonate", userId), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func suspendUser(cmd *cobra.Command, args []string) {
+	userId := args[0]
+	reason, _ := cmd.Flags().GetString("reason")
+	if reason == "" {
+		log.Fatalf("Error: --reason is required")
+	}
+	jsonPayload, _ := json.Marshal(map[string]string{"reason": reason})
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/users/%s/suspend", userId), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func deactivateUser(cmd *cobra.Command, args []string) {
+	userId := args[0]
+	reason, _ := cmd.Flags().GetString("reason")
+	at, _ := cmd.Flags().GetString("at")
+
+	payload := map[string]string{"reason": reason}
+	if at != "" {
+		if _, err := time.Parse(time.RFC3339, at); err != nil {
+			log.Fatalf("Error: --at must be an RFC3339 date: %v", err)
+		}
+		payload["at"] = at
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/users/%s/deactivate", userId), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func reactivateUser(cmd *cobra.Command, args []string) {
+	userId := args[0]
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/users/%s/reactivate", userId), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
 func listRoles(cmd *cobra.Command, args []string) {
 	responseBody, err := sendRequest("GET", "http://app:8080/roles/", nil, nil)
 	if err != nil {
@@ -414,10 +627,12 @@ func getRole(cmd *cobra.Command, args []string) {
 func createRole(cmd *cobra.Command, args []string) {
 	name, _ := cmd.Flags().GetString("name")
 	description, _ := cmd.Flags().GetString("description")
+	permissions, _ := cmd.Flags().GetStringSlice("permissions")
 
-	payload := map[string]string{
+	payload := map[string]interface{}{
 		"name":        name,
 		"description": description,
+		"permissions": permissions,
 	}
 	jsonPayload, _ := json.Marshal(payload)
 
@@ -497,16 +712,18 @@ func deleteGroup(cmd *cobra.Command, args []string) {
 func createGroup(cmd *cobra.Command, args []string) {
 	name, _ := cmd.Flags().GetString("name")
 	description, _ := cmd.Flags().GetString("description")
+	rule, _ := cmd.Flags().GetString("rule")
 
 	payload := map[string]string{
-		"name":        name,
-		"description": description,
+		"name":            name,
+		"description":     description,
+		"membership_rule": rule,
 	}
 	jsonPayload, _ := json.Marshal(payload)
 
-	headers := map[string]string{
+	headers := authHeaders(cmd, map[string]string{
 		"Content-Type": "application/json",
-	}
+	})
 	responseBody, err := sendRequest("POST", "http://app:8080/groups", headers, jsonPayload)
 	if err != nil {
 		log.Fatalf("Error: %v", err)
@@ -516,19 +733,20 @@ func createGroup(cmd *cobra.Command, args []string) {
 }
 
 func updateGroup(cmd *cobra.Command, args []string) {
-	groupID, _ := cmd.Flags().GetString("id")
-	name, _ := cmd.Flags().GetString("name")
-	description, _ := cmd.Flags().GetString("description")
+	groupID := args[0]
 
-	payload := map[string]string{
-		"name":        name,
-		"description": description,
+	// seuls les champs passés en flag sont modifiés
+	payload := map[string]string{}
+	for flag, field := range map[string]string{"name": "name", "description": "description", "rule": "membership_rule"} {
+		if cmd.Flags().Changed(flag) {
+			payload[field], _ = cmd.Flags().GetString(flag)
+		}
 	}
 	jsonPayload, _ := json.Marshal(payload)
 
-	headers := map[string]string{
+	headers := authHeaders(cmd, map[string]string{
 		"Content-Type": "application/json",
-	}
+	})
 	endpoint := fmt.Sprintf("http://app:8080/groups/%s", groupID)
 	responseBody, err := sendRequest("PUT", endpoint, headers, jsonPayload)
 	if err != nil {
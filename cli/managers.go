@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// orgChartNode est un nœud de GET /users/:id/org-chart
+type orgChartNode struct {
+	ID      uint            `json:"id"`
+	Name    string          `json:"name"`
+	Email   string          `json:"email"`
+	Status  string          `json:"status"`
+	Reports []*orgChartNode `json:"reports"`
+}
+
+func newOrgChartCmd() *cobra.Command {
+	orgChartCmd := &cobra.Command{
+		Use:   "org-chart [user_id]",
+		Short: "Afficher l'organigramme sous un utilisateur, en arbre ou en Graphviz DOT (ex: org-chart 1 --format dot | dot -Tpng > org.png)",
+		Args:  cobra.ExactArgs(1),
+		Run:   orgChart,
+	}
+	orgChartCmd.Flags().String("format", "tree", "Le format de sortie: tree, dot ou json")
+	orgChartCmd.Flags().Int("depth", 0, "Le nombre de niveaux sous l'utilisateur (0 pour tous)")
+
+	return orgChartCmd
+}
+
+func newReportsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "reports [user_id]",
+		Short: "Lister les collaborateurs directs d'un utilisateur",
+		Args:  cobra.ExactArgs(1),
+		Run:   listReports,
+	}
+}
+
+func newManagersCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "managers [user_id]",
+		Short: "Afficher la chaîne hiérarchique d'un utilisateur, du manager direct au sommet",
+		Args:  cobra.ExactArgs(1),
+		Run:   listManagers,
+	}
+}
+
+////////////////////////////////////////////////////////////////	//////////////////////////////////////////////
+
+// managerFlag lit --manager: un ID, ou une valeur vide pour retirer le manager (null)
+func managerFlag(cmd *cobra.Command) interface{} {
+	manager, _ := cmd.Flags().GetString("manager")
+	if manager == "" {
+		return nil
+	}
+	id, err := strconv.Atoi(manager)
+	if err != nil {
+		log.Fatalf("Error: invalid manager ID %q", manager)
+	}
+	return id
+}
+
+func orgChart(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	depth, _ := cmd.Flags().GetInt("depth")
+	if format != "tree" && format != "dot" && format != "json" {
+		log.Fatalf("Error: unknown format %q (tree, dot or json)", format)
+	}
+
+	url := fmt.Sprintf("http://app:8080/users/%s/org-chart?depth=%d", args[0], depth)
+	responseBody, err := sendRequest("GET", url, authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var root orgChartNode
+	if err := json.Unmarshal(responseBody, &root); err != nil || root.ID == 0 {
+		log.Fatalf("Error: %s", string(responseBody))
+	}
+
+	switch format {
+	case "json":
+		fmt.Println(string(responseBody))
+	case "dot":
+		fmt.Print(orgChartDOT(&root))
+	default:
+		fmt.Println(orgChartLabel(&root))
+		printOrgChart(root.Reports, "")
+	}
+}
+
+func orgChartLabel(node *orgChartNode) string {
+	label := fmt.Sprintf("%s <%s> #%d", node.Name, node.Email, node.ID)
+	if node.Status != "" && node.Status != "active" {
+		label += " (" + node.Status + ")"
+	}
+	return label
+}
+
+// printOrgChart affiche les collaborateurs avec les traits de l'arbre (├── └──)
+func printOrgChart(reports []*orgChartNode, prefix string) {
+	for i, report := range reports {
+		branch, indent := "├── ", "│   "
+		if i == len(reports)-1 {
+			branch, indent = "└── ", "    "
+		}
+		fmt.Println(prefix + branch + orgChartLabel(report))
+		printOrgChart(report.Reports, prefix+indent)
+	}
+}
+
+// orgChartDOT génère le graphe Graphviz: un nœud par utilisateur, une flèche du manager vers chaque collaborateur
+func orgChartDOT(root *orgChartNode) string {
+	var b strings.Builder
+	b.WriteString("digraph org_chart {\n")
+	b.WriteString("  rankdir=TB;\n")
+	b.WriteString("  node [shape=box, style=rounded];\n")
+	var walk func(node *orgChartNode)
+	walk = func(node *orgChartNode) {
+		lines := []string{dotEscape(node.Name), dotEscape(node.Email)}
+		if node.Status != "" && node.Status != "active" {
+			lines = append(lines, "("+dotEscape(node.Status)+")")
+		}
+		fmt.Fprintf(&b, "  u%d [label=\"%s\"];\n", node.ID, strings.Join(lines, `\n`))
+		for _, report := range node.Reports {
+			fmt.Fprintf(&b, "  u%d -> u%d;\n", node.ID, report.ID)
+			walk(report)
+		}
+	}
+	walk(root)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dotEscape échappe une valeur pour un libellé DOT entre guillemets
+func dotEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+func listReports(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/users/%s/reports", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func listManagers(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/users/%s/managers", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
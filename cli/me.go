@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+func newWhoamiCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "whoami",
+		Short: "Afficher le profil de l'utilisateur du token",
+		Run:   whoami,
+	}
+}
+
+func newMeCmd() *cobra.Command {
+	meCmd := &cobra.Command{
+		Use:   "me",
+		Short: "Gérer son propre compte",
+	}
+
+	// Me Update
+	updateMeCmd := &cobra.Command{
+		Use:   "update",
+		Short: "Mettre à jour son nom ou son email",
+		Run:   updateMe,
+	}
+	updateMeCmd.Flags().String("name", "", "Le nouveau nom")
+	updateMeCmd.Flags().String("email", "", "La nouvelle adresse email")
+	meCmd.AddCommand(updateMeCmd)
+
+	return meCmd
+}
+
+func whoami(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/me", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func updateMe(cmd *cobra.Command, args []string) {
+	// seuls les champs passés en flag sont envoyés
+	payload := map[string]string{}
+	if cmd.Flags().Changed("name") {
+		payload["name"], _ = cmd.Flags().GetString("name")
+	}
+	if cmd.Flags().Changed("email") {
+		payload["email"], _ = cmd.Flags().GetString("email")
+	}
+	if len(payload) == 0 {
+		log.Fatalf("Error: --name or --email is required")
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("PATCH", "http://app:8080/me", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
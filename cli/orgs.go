@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+func newOrgsCmd() *cobra.Command {
+	orgsCmd := &cobra.Command{
+		Use:   "orgs",
+		Short: "Gérer les organisations (administrateurs multi-organisations)",
+	}
+
+	// Orgs List
+	listOrgsCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lister toutes les organisations",
+		Run:   listOrgs,
+	}
+	orgsCmd.AddCommand(listOrgsCmd)
+
+	// Orgs Get
+	getOrgCmd := &cobra.Command{
+		Use:   "get [org_id]",
+		Short: "Récupérer une organisation spécifique",
+		Args:  cobra.ExactArgs(1),
+		Run:   getOrg,
+	}
+	orgsCmd.AddCommand(getOrgCmd)
+
+	// Orgs Create
+	createOrgCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Créer une organisation (avec un rôle Admin)",
+		Run:   createOrg,
+	}
+	createOrgCmd.Flags().String("name", "", "Le nom de l'organisation")
+	createOrgCmd.Flags().String("slug", "", "L'identifiant unique de l'organisation (ex: acme)")
+	orgsCmd.AddCommand(createOrgCmd)
+
+	// Orgs Update
+	updateOrgCmd := &cobra.Command{
+		Use:   "update [org_id]",
+		Short: "Renommer une organisation",
+		Args:  cobra.ExactArgs(1),
+		Run:   updateOrg,
+	}
+	updateOrgCmd.Flags().String("name", "", "Le nouveau nom de l'organisation")
+	updateOrgCmd.Flags().String("slug", "", "Le nouvel identifiant de l'organisation")
+	orgsCmd.AddCommand(updateOrgCmd)
+
+	// Orgs Delete
+	deleteOrgCmd := &cobra.Command{
+		Use:   "delete [org_id]",
+		Short: "Supprimer une organisation sans utilisateur",
+		Args:  cobra.ExactArgs(1),
+		Run:   deleteOrg,
+	}
+	orgsCmd.AddCommand(deleteOrgCmd)
+
+	// Orgs Admins
+	adminsCmd := &cobra.Command{
+		Use:   "admins",
+		Short: "Accorder ou retirer le privilège multi-organisations",
+	}
+	adminsCmd.AddCommand(&cobra.Command{
+		Use:   "grant [user_id]",
+		Short: "Accorder le privilège multi-organisations à un utilisateur",
+		Args:  cobra.ExactArgs(1),
+		Run:   grantCrossTenantAdmin,
+	})
+	adminsCmd.AddCommand(&cobra.Command{
+		Use:   "revoke [user_id]",
+		Short: "Retirer le privilège multi-organisations à un utilisateur",
+		Args:  cobra.ExactArgs(1),
+		Run:   revokeCrossTenantAdmin,
+	})
+	orgsCmd.AddCommand(adminsCmd)
+
+	return orgsCmd
+}
+
+func listOrgs(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/orgs/", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func getOrg(cmd *cobra.Command, args []string) {
+	orgID := args[0]
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/orgs/%s", orgID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func createOrg(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	slug, _ := cmd.Flags().GetString("slug")
+
+	payload := map[string]string{
+		"name": name,
+		"slug": slug,
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/orgs/", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func updateOrg(cmd *cobra.Command, args []string) {
+	orgID := args[0]
+
+	// seuls les champs passés en flag sont envoyés
+	payload := map[string]string{}
+	if cmd.Flags().Changed("name") {
+		payload["name"], _ = cmd.Flags().GetString("name")
+	}
+	if cmd.Flags().Changed("slug") {
+		payload["slug"], _ = cmd.Flags().GetString("slug")
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("PUT", fmt.Sprintf("http://app:8080/orgs/%s", orgID), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func deleteOrg(cmd *cobra.Command, args []string) {
+	orgID := args[0]
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/orgs/%s", orgID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func grantCrossTenantAdmin(cmd *cobra.Command, args []string) {
+	userID := args[0]
+	responseBody, err := sendRequest("PUT", fmt.Sprintf("http://app:8080/orgs/admins/%s", userID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func revokeCrossTenantAdmin(cmd *cobra.Command, args []string) {
+	userID := args[0]
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/orgs/admins/%s", userID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+func newPoliciesCmd() *cobra.Command {
+	policiesCmd := &cobra.Command{
+		Use:   "policies",
+		Short: "Gérer les politiques d'accès (conditions CEL)",
+	}
+
+	// Policies List
+	listPoliciesCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lister toutes les politiques",
+		Run:   listPolicies,
+	}
+	policiesCmd.AddCommand(listPoliciesCmd)
+
+	// Policies Get
+	getPolicyCmd := &cobra.Command{
+		Use:   "get [policy_id]",
+		Short: "Récupérer une politique spécifique",
+		Args:  cobra.ExactArgs(1),
+		Run:   getPolicy,
+	}
+	policiesCmd.AddCommand(getPolicyCmd)
+
+	// Policies Create
+	createPolicyCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Créer une politique à partir d'un fichier JSON",
+		Run:   createPolicy,
+	}
+	createPolicyCmd.Flags().String("file", "", "Le fichier JSON de la politique")
+	policiesCmd.AddCommand(createPolicyCmd)
+
+	// Policies Delete
+	deletePolicyCmd := &cobra.Command{
+		Use:   "delete [policy_id]",
+		Short: "Supprimer une politique existante",
+		Args:  cobra.ExactArgs(1),
+		Run:   deletePolicy,
+	}
+	policiesCmd.AddCommand(deletePolicyCmd)
+
+	// Policies Test
+	testPoliciesCmd := &cobra.Command{
+		Use:   "test",
+		Short: "Évaluer des cas de test sur les politiques actives ou sur un brouillon",
+		Run:   testPolicies,
+	}
+	testPoliciesCmd.Flags().String("file", "", "Le fichier JSON des cas ({\"cases\": [...]})")
+	testPoliciesCmd.Flags().String("policies", "", "Un fichier JSON de politiques à tester à la place des politiques actives")
+	policiesCmd.AddCommand(testPoliciesCmd)
+
+	return policiesCmd
+}
+
+func listPolicies(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/policies/", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func getPolicy(cmd *cobra.Command, args []string) {
+	policyID := args[0]
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/policies/%s", policyID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func createPolicy(cmd *cobra.Command, args []string) {
+	file, _ := cmd.Flags().GetString("file")
+	if file == "" {
+		log.Fatalf("Error: --file is required")
+	}
+	jsonPayload, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/policies/", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func deletePolicy(cmd *cobra.Command, args []string) {
+	policyID := args[0]
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/policies/%s", policyID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+// testPolicies affiche une ligne par cas et sort en erreur si un résultat diffère de "expect"
+func testPolicies(cmd *cobra.Command, args []string) {
+	file, _ := cmd.Flags().GetString("file")
+	policiesFile, _ := cmd.Flags().GetString("policies")
+	if file == "" {
+		log.Fatalf("Error: --file is required")
+	}
+
+	var payload map[string]interface{}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		log.Fatalf("Error: %s: %v", file, err)
+	}
+	if policiesFile != "" {
+		var draft []interface{}
+		data, err := ioutil.ReadFile(policiesFile)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := json.Unmarshal(data, &draft); err != nil {
+			log.Fatalf("Error: %s: %v", policiesFile, err)
+		}
+		payload["policies"] = draft
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/policies/test", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	var response struct {
+		Results []struct {
+			Name     string        `json:"name"`
+			Decision authzDecision `json:"decision"`
+			Pass     *bool         `json:"pass"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(responseBody, &response); err != nil || response.Results == nil {
+		log.Fatalf("Error: %s", string(responseBody))
+	}
+
+	failed := 0
+	for i, result := range response.Results {
+		status := "-"
+		if result.Pass != nil && *result.Pass {
+			status = "PASS"
+		} else if result.Pass != nil {
+			status = "FAIL"
+			failed++
+		}
+		verdict := "allow"
+		if !result.Decision.Allowed {
+			verdict = "deny"
+		}
+		name := result.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i+1)
+		}
+		fmt.Printf("%-4s %s: %-5s %s %s: %s\n", status, name, verdict, result.Decision.Action, result.Decision.Resource, result.Decision.Reason)
+	}
+	fmt.Printf("%d cases, %d failed\n", len(response.Results), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// reviewItem est un grant à certifier ou révoquer dans une campagne
+type reviewItem struct {
+	ID         int        `json:"id"`
+	Kind       string     `json:"kind"`
+	UserID     int        `json:"user_id"`
+	UserEmail  string     `json:"user_email"`
+	TargetID   int        `json:"target_id"`
+	TargetName string     `json:"target_name"`
+	ValidFrom  time.Time  `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
+	Reason     string     `json:"reason"`
+	Decision   string     `json:"decision"`
+	Comment    string     `json:"comment"`
+}
+
+func newReviewsCmd() *cobra.Command {
+	reviewsCmd := &cobra.Command{
+		Use:   "reviews",
+		Short: "Campagnes de revue des accès: certifier ou révoquer les rôles et groupes accordés",
+	}
+
+	// Reviews List
+	listReviewsCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lister les campagnes avec leur avancement",
+		Run:   listReviews,
+	}
+	reviewsCmd.AddCommand(listReviewsCmd)
+
+	// Reviews Assigned
+	assignedReviewsCmd := &cobra.Command{
+		Use:   "assigned",
+		Short: "Lister les campagnes ouvertes où vous avez des grants à relire",
+		Run:   assignedReviews,
+	}
+	reviewsCmd.AddCommand(assignedReviewsCmd)
+
+	// Reviews Get
+	getReviewCmd := &cobra.Command{
+		Use:   "get [review_id]",
+		Short: "Récupérer une campagne et son avancement",
+		Args:  cobra.ExactArgs(1),
+		Run:   getReview,
+	}
+	reviewsCmd.AddCommand(getReviewCmd)
+
+	// Reviews Create
+	createReviewCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Ouvrir une campagne sur les grants des rôles et groupes donnés (tous par défaut)",
+		Run:   createReview,
+	}
+	createReviewCmd.Flags().String("name", "", "Le nom de la campagne (ex: Q4 2026)")
+	createReviewCmd.Flags().IntSlice("roles", nil, "Les IDs des rôles à relire")
+	createReviewCmd.Flags().IntSlice("groups", nil, "Les IDs des groupes à relire")
+	createReviewCmd.Flags().IntSlice("reviewers", nil, "Les IDs des relecteurs, qui se partagent les grants")
+	createReviewCmd.Flags().String("due", "", "La date limite (YYYY-MM-DD ou RFC3339)")
+	reviewsCmd.AddCommand(createReviewCmd)
+
+	// Reviews Items
+	itemsReviewCmd := &cobra.Command{
+		Use:   "items [review_id]",
+		Short: "Lister les grants que vous relisez dans une campagne",
+		Args:  cobra.ExactArgs(1),
+		Run:   listReviewItems,
+	}
+	itemsReviewCmd.Flags().String("decision", "", "Ne garder que les grants pending, certified ou revoked")
+	reviewsCmd.AddCommand(itemsReviewCmd)
+
+	// Reviews Certify / Revoke
+	for _, decision := range []struct{ name, short string }{
+		{"certify", "Certifier qu'un grant est toujours nécessaire"},
+		{"revoke", "Demander la révocation d'un grant (appliquée à la clôture)"},
+	} {
+		decideCmd := &cobra.Command{
+			Use:   decision.name + " [review_id] [item_id]",
+			Short: decision.short,
+			Args:  cobra.ExactArgs(2),
+			Run:   decideReviewItem(decision.name),
+		}
+		decideCmd.Flags().String("comment", "", "Un commentaire")
+		reviewsCmd.AddCommand(decideCmd)
+	}
+
+	// Reviews Run
+	runReviewCmd := &cobra.Command{
+		Use:   "run [review_id]",
+		Short: "Relire un par un les grants en attente: [c]ertifier, [r]évoquer, [s]auter ou [q]uitter",
+		Args:  cobra.ExactArgs(1),
+		Run:   runReview,
+	}
+	reviewsCmd.AddCommand(runReviewCmd)
+
+	// Reviews Close
+	closeReviewCmd := &cobra.Command{
+		Use:   "close [review_id]",
+		Short: "Clore une campagne et appliquer les révocations",
+		Args:  cobra.ExactArgs(1),
+		Run:   closeReview,
+	}
+	closeReviewCmd.Flags().Bool("revoke-unreviewed", false, "Révoquer aussi les grants sans décision")
+	reviewsCmd.AddCommand(closeReviewCmd)
+
+	// Reviews Report
+	reportReviewCmd := &cobra.Command{
+		Use:   "report [review_id]",
+		Short: "Exporter le rapport d'une campagne",
+		Args:  cobra.ExactArgs(1),
+		Run:   reportReview,
+	}
+	reportReviewCmd.Flags().String("format", "json", "Le format du rapport: json ou csv")
+	reportReviewCmd.Flags().String("output", "", "Le fichier de sortie (access-review-<id>.<format> par défaut)")
+	reviewsCmd.AddCommand(reportReviewCmd)
+
+	return reviewsCmd
+}
+
+////////////////////////////////////////////////////////////////	//////////////////////////////////////////////
+
+func listReviews(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/access-reviews/", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func assignedReviews(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/access-reviews/assigned", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func getReview(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/access-reviews/%s", args[0]), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func createReview(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	roles, _ := cmd.Flags().GetIntSlice("roles")
+	groups, _ := cmd.Flags().GetIntSlice("groups")
+	reviewers, _ := cmd.Flags().GetIntSlice("reviewers")
+	if name == "" || len(reviewers) == 0 {
+		log.Fatalf("Error: --name and --reviewers are required")
+	}
+
+	payload := map[string]interface{}{"name": name, "role_ids": roles, "group_ids": groups, "reviewer_ids": reviewers}
+	if due, _ := cmd.Flags().GetString("due"); due != "" {
+		date, err := parseGrantDate(due)
+		if err != nil {
+			log.Fatalf("Error: --due must be YYYY-MM-DD or RFC3339: %v", err)
+		}
+		payload["due_at"] = date
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/access-reviews/", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func fetchReviewItems(cmd *cobra.Command, reviewId, decision string) []reviewItem {
+	url := fmt.Sprintf("http://app:8080/access-reviews/%s/items", reviewId)
+	if decision != "" {
+		url += "?decision=" + decision
+	}
+	responseBody, err := sendRequest("GET", url, authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	var items []reviewItem
+	if err := json.Unmarshal(responseBody, &items); err != nil {
+		log.Fatalf("Error: %s", string(responseBody))
+	}
+	return items
+}
+
+func printReviewItem(item reviewItem) {
+	until := "no end"
+	if item.ValidUntil != nil {
+		until = "until " + item.ValidUntil.Format("2006-01-02")
+	}
+	fmt.Printf("#%d %s has %s %q (since %s, %s)", item.ID, item.UserEmail, item.Kind, item.TargetName, item.ValidFrom.Format("2006-01-02"), until)
+	if item.Reason != "" {
+		fmt.Printf(" reason: %s", item.Reason)
+	}
+	if item.Decision != "pending" {
+		fmt.Printf(" [%s]", item.Decision)
+	}
+	fmt.Println()
+}
+
+func listReviewItems(cmd *cobra.Command, args []string) {
+	decision, _ := cmd.Flags().GetString("decision")
+	for _, item := range fetchReviewItems(cmd, args[0], decision) {
+		printReviewItem(item)
+	}
+}
+
+// sendReviewDecision envoie une décision et retourne la réponse du serveur en cas d'erreur
+func sendReviewDecision(cmd *cobra.Command, reviewId, itemId, decision, comment string) (string, bool) {
+	jsonPayload, _ := json.Marshal(map[string]string{"decision": decision, "comment": comment})
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/access-reviews/%s/items/%s", reviewId, itemId), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	var result struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(responseBody, &result)
+	return string(responseBody), result.Error == ""
+}
+
+func decideReviewItem(decision string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		comment, _ := cmd.Flags().GetString("comment")
+		response, _ := sendReviewDecision(cmd, args[0], args[1], decision, comment)
+		fmt.Println(response)
+	}
+}
+
+func runReview(cmd *cobra.Command, args []string) {
+	items := fetchReviewItems(cmd, args[0], "pending")
+	if len(items) == 0 {
+		fmt.Println("Nothing to review.")
+		return
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	certified, revoked := 0, 0
+	for i, item := range items {
+		fmt.Printf("[%d/%d] ", i+1, len(items))
+		printReviewItem(item)
+
+		var decision string
+		for decision == "" {
+			fmt.Print("[c]ertify, [r]evoke, [s]kip, [q]uit? ")
+			answer, err := reader.ReadString('\n')
+			if err != nil {
+				answer = "q"
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "c":
+				decision = "certify"
+			case "r":
+				decision = "revoke"
+			case "s":
+				decision = "skip"
+			case "q":
+				fmt.Printf("%d certified, %d revoked.\n", certified, revoked)
+				return
+			}
+		}
+		if decision == "skip" {
+			continue
+		}
+
+		comment := ""
+		if decision == "revoke" {
+			fmt.Print("Comment (optional): ")
+			comment, _ = reader.ReadString('\n')
+			comment = strings.TrimSpace(comment)
+		}
+		response, ok := sendReviewDecision(cmd, args[0], fmt.Sprint(item.ID), decision, comment)
+		if !ok {
+			fmt.Println(response)
+			continue
+		}
+		if decision == "certify" {
+			certified++
+		} else {
+			revoked++
+		}
+	}
+	fmt.Printf("%d certified, %d revoked.\n", certified, revoked)
+}
+
+func closeReview(cmd *cobra.Command, args []string) {
+	revokeUnreviewed, _ := cmd.Flags().GetBool("revoke-unreviewed")
+	jsonPayload, _ := json.Marshal(map[string]bool{"revoke_unreviewed": revokeUnreviewed})
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", fmt.Sprintf("http://app:8080/access-reviews/%s/close", args[0]), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func reportReview(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "json" && format != "csv" {
+		log.Fatalf("Error: --format must be json or csv")
+	}
+	output, _ := cmd.Flags().GetString("output")
+	if output == "" {
+		output = fmt.Sprintf("access-review-%s.%s", args[0], format)
+	}
+
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/access-reviews/%s/report?format=%s", args[0], format), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if strings.HasPrefix(string(responseBody), `{"error"`) {
+		log.Fatalf("Error: %s", string(responseBody))
+	}
+
+	if err := ioutil.WriteFile(output, responseBody, 0644); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Printf("Report exported to %s\n", output)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+func newSessionsCmd() *cobra.Command {
+	sessionsCmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Lister et révoquer les sessions ouvertes",
+	}
+
+	// Sessions List
+	listSessionsCmd := &cobra.Command{
+		Use:   "list [user_id]",
+		Short: "Lister les sessions actives d'un utilisateur (les siennes si aucun ID n'est donné)",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   listSessions,
+	}
+	sessionsCmd.AddCommand(listSessionsCmd)
+
+	// Sessions Revoke
+	revokeSessionCmd := &cobra.Command{
+		Use:   "revoke [session_id]",
+		Short: "Révoquer une session: ses jetons sont refusés immédiatement",
+		Args:  cobra.ExactArgs(1),
+		Run:   revokeSession,
+	}
+	sessionsCmd.AddCommand(revokeSessionCmd)
+
+	return sessionsCmd
+}
+
+func listSessions(cmd *cobra.Command, args []string) {
+	url := "http://app:8080/me/sessions"
+	if len(args) == 1 {
+		url = fmt.Sprintf("http://app:8080/users/%s/sessions", args[0])
+	}
+	responseBody, err := sendRequest("GET", url, authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func revokeSession(cmd *cobra.Command, args []string) {
+	sessionID := args[0]
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/sessions/%s", sessionID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newWatchCmd() *cobra.Command {
+	watchCmd := &cobra.Command{
+		Use:       "watch [users|groups|roles]...",
+		Short:     "Suivre en direct les modifications des utilisateurs, groupes et rôles",
+		ValidArgs: []string{"users", "groups", "roles"},
+		Args:      cobra.OnlyValidArgs,
+		Run:       watch,
+	}
+	watchCmd.Flags().String("last_event_id", "", "Reprendre après cet ID d'événement")
+	return watchCmd
+}
+
+// watch lit le flux SSE /events/stream et se reconnecte avec Last-Event-ID en cas de coupure
+func watch(cmd *cobra.Command, args []string) {
+	var entityTypes []string
+	for _, arg := range args {
+		entityTypes = append(entityTypes, strings.TrimSuffix(arg, "s"))
+	}
+	lastEventID, _ := cmd.Flags().GetString("last_event_id")
+
+	for {
+		var err error
+		lastEventID, err = readEventStream(cmd, entityTypes, lastEventID)
+		if err != nil {
+			log.Printf("Error: %v, reconnecting...", err)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func readEventStream(cmd *cobra.Command, entityTypes []string, lastEventID string) (string, error) {
+	req, err := http.NewRequest("GET", "http://app:8080/events/stream?entity_types="+strings.Join(entityTypes, ","), nil)
+	if err != nil {
+		return lastEventID, err
+	}
+	for key, value := range authHeaders(cmd, map[string]string{"Accept": "text/event-stream"}) {
+		req.Header.Set(key, value)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return lastEventID, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("Error: %s", resp.Status)
+	}
+
+	var id, event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if data != "" {
+				fmt.Printf("#%s %s %s\n", id, event, data)
+				lastEventID = id
+			}
+			id, event, data = "", "", ""
+		case strings.HasPrefix(line, "id:"):
+			id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	return lastEventID, scanner.Err()
+}
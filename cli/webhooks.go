@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+func newWebhooksCmd() *cobra.Command {
+	webhooksCmd := &cobra.Command{
+		Use:   "webhooks",
+		Short: "Gérer les abonnements webhook",
+	}
+
+	// Webhooks List
+	listWebhooksCmd := &cobra.Command{
+		Use:   "list",
+		Short: "Lister tous les webhooks",
+		Run:   listWebhooks,
+	}
+	webhooksCmd.AddCommand(listWebhooksCmd)
+
+	// Webhooks Get
+	getWebhookCmd := &cobra.Command{
+		Use:   "get [webhook_id]",
+		Short: "Récupérer un webhook spécifique",
+		Args:  cobra.ExactArgs(1),
+		Run:   getWebhook,
+	}
+	webhooksCmd.AddCommand(getWebhookCmd)
+
+	// Webhooks Create
+	createWebhookCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Créer un nouveau webhook",
+		Run:   createWebhook,
+	}
+	createWebhookCmd.Flags().String("url", "", "L'URL appelée pour chaque événement")
+	createWebhookCmd.Flags().StringSlice("events", nil, "Les types d'événements (ex: user.*,group.members_changed), tous si vide")
+	createWebhookCmd.Flags().String("description", "", "La description du webhook")
+	webhooksCmd.AddCommand(createWebhookCmd)
+
+	// Webhooks Update
+	updateWebhookCmd := &cobra.Command{
+		Use:   "update [webhook_id]",
+		Short: "Mettre à jour un webhook existant",
+		Args:  cobra.ExactArgs(1),
+		Run:   updateWebhook,
+	}
+	updateWebhookCmd.Flags().String("url", "", "La nouvelle URL du webhook")
+	updateWebhookCmd.Flags().StringSlice("events", nil, "Les nouveaux types d'événements")
+	updateWebhookCmd.Flags().String("description", "", "La nouvelle description du webhook")
+	updateWebhookCmd.Flags().Bool("active", true, "Activer ou désactiver le webhook")
+	webhooksCmd.AddCommand(updateWebhookCmd)
+
+	// Webhooks Delete
+	deleteWebhookCmd := &cobra.Command{
+		Use:   "delete [webhook_id]",
+		Short: "Supprimer un webhook existant",
+		Args:  cobra.ExactArgs(1),
+		Run:   deleteWebhook,
+	}
+	webhooksCmd.AddCommand(deleteWebhookCmd)
+
+	// Webhooks Deliveries
+	deliveriesCmd := &cobra.Command{
+		Use:   "deliveries [webhook_id]",
+		Short: "Lister les livraisons d'un webhook",
+		Args:  cobra.ExactArgs(1),
+		Run:   listWebhookDeliveries,
+	}
+	deliveriesCmd.Flags().String("status", "", "Filtrer par status (pending, retrying, delivered, dead)")
+	webhooksCmd.AddCommand(deliveriesCmd)
+
+	// Webhooks Replay
+	replayCmd := &cobra.Command{
+		Use:   "replay [webhook_id]",
+		Short: "Relancer les livraisons en échec (dead) d'un webhook",
+		Args:  cobra.ExactArgs(1),
+		Run:   replayWebhookDeliveries,
+	}
+	replayCmd.Flags().String("delivery", "", "Relancer uniquement cette livraison")
+	webhooksCmd.AddCommand(replayCmd)
+
+	return webhooksCmd
+}
+
+func listWebhooks(cmd *cobra.Command, args []string) {
+	responseBody, err := sendRequest("GET", "http://app:8080/webhooks/", authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func getWebhook(cmd *cobra.Command, args []string) {
+	webhookID := args[0]
+	responseBody, err := sendRequest("GET", fmt.Sprintf("http://app:8080/webhooks/%s", webhookID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func createWebhook(cmd *cobra.Command, args []string) {
+	url, _ := cmd.Flags().GetString("url")
+	events, _ := cmd.Flags().GetStringSlice("events")
+	description, _ := cmd.Flags().GetString("description")
+
+	payload := map[string]interface{}{
+		"url":         url,
+		"event_types": events,
+		"description": description,
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("POST", "http://app:8080/webhooks/", headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func updateWebhook(cmd *cobra.Command, args []string) {
+	webhookID := args[0]
+
+	// seuls les champs passés en flag sont envoyés
+	payload := map[string]interface{}{}
+	if cmd.Flags().Changed("url") {
+		payload["url"], _ = cmd.Flags().GetString("url")
+	}
+	if cmd.Flags().Changed("events") {
+		payload["event_types"], _ = cmd.Flags().GetStringSlice("events")
+	}
+	if cmd.Flags().Changed("description") {
+		payload["description"], _ = cmd.Flags().GetString("description")
+	}
+	if cmd.Flags().Changed("active") {
+		payload["active"], _ = cmd.Flags().GetBool("active")
+	}
+	jsonPayload, _ := json.Marshal(payload)
+
+	headers := authHeaders(cmd, map[string]string{
+		"Content-Type": "application/json",
+	})
+	responseBody, err := sendRequest("PUT", fmt.Sprintf("http://app:8080/webhooks/%s", webhookID), headers, jsonPayload)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func deleteWebhook(cmd *cobra.Command, args []string) {
+	webhookID := args[0]
+	responseBody, err := sendRequest("DELETE", fmt.Sprintf("http://app:8080/webhooks/%s", webhookID), authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func listWebhookDeliveries(cmd *cobra.Command, args []string) {
+	webhookID := args[0]
+	status, _ := cmd.Flags().GetString("status")
+
+	endpoint := fmt.Sprintf("http://app:8080/webhooks/%s/deliveries", webhookID)
+	if status != "" {
+		endpoint += "?status=" + status
+	}
+	responseBody, err := sendRequest("GET", endpoint, authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
+
+func replayWebhookDeliveries(cmd *cobra.Command, args []string) {
+	webhookID := args[0]
+	deliveryID, _ := cmd.Flags().GetString("delivery")
+
+	endpoint := fmt.Sprintf("http://app:8080/webhooks/%s/replay", webhookID)
+	if deliveryID != "" {
+		endpoint = fmt.Sprintf("http://app:8080/webhooks/%s/deliveries/%s/replay", webhookID, deliveryID)
+	}
+	responseBody, err := sendRequest("POST", endpoint, authHeaders(cmd, nil), nil)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	fmt.Println(string(responseBody))
+}
@@ -1,33 +1,62 @@
 -- Create the tables
+-- Création de la table Organization (tenant: chaque utilisateur, rôle et groupe appartient à une organisation)
+CREATE TABLE organizations (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL,
+    deleted_at TIMESTAMP NULL
+);
+
+-- L'organisation 1 reçoit les inscriptions et les données existantes
+INSERT INTO organizations (name, slug, created_at) VALUES ('Default', 'default', NOW());
+
 CREATE TABLE users (
   id SERIAL PRIMARY KEY,
+  organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
   name VARCHAR(255) NOT NULL,
   email VARCHAR(255) UNIQUE NOT NULL,
   password VARCHAR(255) NOT NULL,
+  cross_tenant_admin BOOLEAN NOT NULL DEFAULT FALSE,
+  status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'deactivated', 'expired')),
+  status_reason TEXT NOT NULL DEFAULT '',
+  status_changed_at TIMESTAMP NULL,
+  deactivate_at TIMESTAMP NULL,
+  attributes JSONB NOT NULL DEFAULT '{}',
+  manager_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
   updated_at TIMESTAMP NULL,
   deleted_at TIMESTAMP NULL
 );
+CREATE INDEX users_attributes_idx ON users USING GIN (attributes jsonb_path_ops);
+CREATE INDEX users_manager_id_idx ON users (manager_id);
 
 -- Création de la table Role
 CREATE TABLE roles (
     id SERIAL PRIMARY KEY,
-    name VARCHAR(255) UNIQUE NOT NULL,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    name VARCHAR(255) NOT NULL,
     description TEXT,
+    permissions TEXT[] NULL DEFAULT '{}',
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NULL,
-    deleted_at TIMESTAMP NULL
+    deleted_at TIMESTAMP NULL,
+    UNIQUE (organization_id, name)
 );
 
 -- Création de la table Group
 CREATE TABLE groups (
     id SERIAL PRIMARY KEY,
-    name VARCHAR(255) UNIQUE NOT NULL,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    name VARCHAR(255) NOT NULL,
     parent_group_id INT NULL,
     child_group_ids INTEGER[] NULL,
+    membership_rule TEXT NOT NULL DEFAULT '',
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NULL,
     deleted_at TIMESTAMP NULL,
+    UNIQUE (organization_id, name),
     FOREIGN KEY (parent_group_id) REFERENCES groups(id)
 );
 
@@ -53,31 +82,313 @@ CREATE TABLE refresh_tokens (
 CREATE TABLE user_roles (
     user_id INT NOT NULL,
     role_id INT NOT NULL,
+    valid_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    valid_until TIMESTAMP NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    granted_by_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
     PRIMARY KEY (user_id, role_id),
     FOREIGN KEY (user_id) REFERENCES users(id),
-    FOREIGN KEY (role_id) REFERENCES roles(id)
+    FOREIGN KEY (role_id) REFERENCES roles(id),
+    CHECK (valid_until IS NULL OR valid_until > valid_from)
 );
+CREATE INDEX user_roles_valid_until_idx ON user_roles (valid_until) WHERE valid_until IS NOT NULL;
 
 -- Création de la table UserGroup
 CREATE TABLE user_groups (
     user_id INT NOT NULL,
     group_id INT NOT NULL,
+    valid_from TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    valid_until TIMESTAMP NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    granted_by_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
+    rule_derived BOOLEAN NOT NULL DEFAULT FALSE,
     PRIMARY KEY (user_id, group_id),
     FOREIGN KEY (user_id) REFERENCES users(id),
-    FOREIGN KEY (group_id) REFERENCES groups(id)
+    FOREIGN KEY (group_id) REFERENCES groups(id),
+    CHECK (valid_until IS NULL OR valid_until > valid_from)
+);
+CREATE INDEX user_groups_valid_until_idx ON user_groups (valid_until) WHERE valid_until IS NOT NULL;
+CREATE INDEX user_groups_rule_derived_idx ON user_groups (group_id) WHERE rule_derived;
+
+-- Création de la table GroupRole (rôles accordés aux membres d'un groupe et de ses sous-groupes)
+CREATE TABLE group_roles (
+    group_id INT NOT NULL,
+    role_id INT NOT NULL,
+    PRIMARY KEY (group_id, role_id),
+    FOREIGN KEY (group_id) REFERENCES groups(id),
+    FOREIGN KEY (role_id) REFERENCES roles(id)
+);
+
+-- Création de la table GroupOwner (propriétaires qui administrent un groupe et ses sous-groupes)
+CREATE TABLE group_owners (
+    group_id INT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    granted_by_id INT NULL REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX group_owners_user_id_idx ON group_owners (user_id);
+
+-- Création de la table SyncRun (exécutions du job de synchronisation d'annuaire)
+CREATE TABLE sync_runs (
+    id SERIAL PRIMARY KEY,
+    source VARCHAR(50) NOT NULL,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    created INT NOT NULL DEFAULT 0,
+    updated INT NOT NULL DEFAULT 0,
+    deactivated INT NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL
+);
+
+-- Création de la table SyncState (lien entre une entrée de l'annuaire externe et l'entité locale)
+CREATE TABLE sync_states (
+    id SERIAL PRIMARY KEY,
+    source VARCHAR(50) NOT NULL,
+    entity_type VARCHAR(50) NOT NULL,
+    external_id VARCHAR(1024) NOT NULL,
+    local_id INT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    run_id INT NULL,
+    synced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (source, entity_type, external_id)
+);
+
+-- Création de la table AuditEvent (journal d'audit append-only)
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id INT NULL,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(100) NOT NULL,
+    target_type VARCHAR(50) NOT NULL,
+    target_id VARCHAR(255) NOT NULL,
+    diff JSONB NULL,
+    ip VARCHAR(64),
+    user_agent TEXT,
+    request_id VARCHAR(64),
+    prev_hash VARCHAR(64) NOT NULL DEFAULT '',
+    hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX audit_events_target_idx ON audit_events (target_type, target_id);
+CREATE INDEX audit_events_created_at_idx ON audit_events (created_at);
+
+-- Création de la table AuditCheckpoint (signatures périodiques de la chaîne d'audit)
+CREATE TABLE audit_checkpoints (
+    id SERIAL PRIMARY KEY,
+    event_id BIGINT NOT NULL REFERENCES audit_events(id),
+    hash VARCHAR(64) NOT NULL,
+    signature TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Le journal d'audit ne peut pas être modifié ni supprimé
+CREATE FUNCTION audit_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_append_only();
+
+CREATE TRIGGER audit_checkpoints_append_only
+    BEFORE UPDATE OR DELETE ON audit_checkpoints
+    FOR EACH ROW EXECUTE FUNCTION audit_append_only();
+
+-- Création de la table OutboxEvent (événements écrits dans la transaction de la modification)
+CREATE TABLE outbox_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id INT NOT NULL,
+    payload JSONB NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP NULL,
+    dispatch_seq BIGINT NULL UNIQUE -- ordre de distribution (ID des événements SSE)
+);
+
+CREATE INDEX outbox_events_pending_idx ON outbox_events (id) WHERE dispatched_at IS NULL;
+CREATE SEQUENCE outbox_dispatch_seq;
+
+-- Création de la table Webhook
+CREATE TABLE webhooks (
+    id SERIAL PRIMARY KEY,
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types TEXT[] NULL,
+    description TEXT,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL,
+    deleted_at TIMESTAMP NULL
+);
+
+-- Création de la table WebhookDelivery
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INT NOT NULL REFERENCES webhooks(id),
+    outbox_event_id BIGINT NOT NULL REFERENCES outbox_events(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    response_status INT NOT NULL DEFAULT 0,
+    delivered_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status IN ('pending', 'retrying');
+
+-- Création de la table Policy (règles d'accès avec condition CEL)
+CREATE TABLE policies (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    effect VARCHAR(10) NOT NULL CHECK (effect IN ('allow', 'deny')),
+    actions TEXT[] NULL DEFAULT '{}',
+    resources TEXT[] NULL DEFAULT '{}',
+    condition TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL
+);
+
+-- Création de la table Session (une par login, référencée par le claim sid des JWT)
+CREATE TABLE sessions (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id),
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    device VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    impersonator_id INT NULL REFERENCES users(id)
+);
+
+-- Comptes dont la désactivation est programmée (job d'expiration)
+CREATE INDEX users_deactivate_at_idx ON users (deactivate_at) WHERE deactivate_at IS NOT NULL;
+
+CREATE INDEX sessions_user_idx ON sessions (user_id) WHERE revoked_at IS NULL;
+
+-- Création de la table Invitation (comptes créés par l'invité avec le lien reçu par email)
+CREATE TABLE invitations (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    email VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL DEFAULT '',
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    role_ids INTEGER[] NOT NULL DEFAULT '{}',
+    group_ids INTEGER[] NOT NULL DEFAULT '{}',
+    invited_by_id INT NULL REFERENCES users(id),
+    user_id INT NULL REFERENCES users(id),
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Création de la table email_changes (nouvel email demandé par PATCH /me, appliqué une fois confirmé)
+CREATE TABLE email_changes (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Création de la table access_requests (demandes de rôles et de groupes, décidées par un approbateur)
+CREATE TABLE access_requests (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    requester_id INT NOT NULL REFERENCES users(id),
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('role', 'group')),
+    target_id INT NOT NULL,
+    justification TEXT NOT NULL,
+    valid_until TIMESTAMP NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied', 'cancelled')),
+    decided_by_id INT NULL REFERENCES users(id),
+    decision_comment TEXT NOT NULL DEFAULT '',
+    decided_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+-- une seule demande en attente par utilisateur et par cible
+CREATE UNIQUE INDEX access_requests_pending_idx ON access_requests (requester_id, kind, target_id) WHERE status = 'pending';
+
+-- Création des tables access_reviews et access_review_items (campagnes de certification des grants)
+CREATE TABLE access_reviews (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    name VARCHAR(255) NOT NULL,
+    role_ids INTEGER[] NOT NULL DEFAULT '{}',
+    group_ids INTEGER[] NOT NULL DEFAULT '{}',
+    reviewer_ids INTEGER[] NOT NULL DEFAULT '{}',
+    created_by_id INT NOT NULL REFERENCES users(id),
+    due_at TIMESTAMP NULL,
+    closed_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE access_review_items (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    review_id INT NOT NULL REFERENCES access_reviews(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('role', 'group')),
+    user_id INT NOT NULL REFERENCES users(id),
+    target_id INT NOT NULL,
+    valid_from TIMESTAMP NOT NULL,
+    valid_until TIMESTAMP NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    reviewer_id INT NULL REFERENCES users(id),
+    decision VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (decision IN ('pending', 'certified', 'revoked')),
+    comment TEXT NOT NULL DEFAULT '',
+    decided_by_id INT NULL REFERENCES users(id),
+    decided_at TIMESTAMP NULL,
+    applied_at TIMESTAMP NULL
+);
+CREATE INDEX access_review_items_review_idx ON access_review_items (review_id, decision);
+CREATE INDEX access_review_items_reviewer_idx ON access_review_items (reviewer_id) WHERE decision = 'pending';
+
+-- Création de la table AttributeDefinition (attributs personnalisés des utilisateurs, valeurs dans users.attributes)
+CREATE TABLE attribute_definitions (
+    id SERIAL PRIMARY KEY,
+    organization_id INT NOT NULL DEFAULT 1 REFERENCES organizations(id),
+    key VARCHAR(63) NOT NULL,
+    label VARCHAR(255) NOT NULL DEFAULT '',
+    type VARCHAR(20) NOT NULL CHECK (type IN ('string', 'number', 'boolean', 'date')),
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    "unique" BOOLEAN NOT NULL DEFAULT FALSE,
+    pattern TEXT NOT NULL DEFAULT '',
+    default_value JSONB NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NULL,
+    UNIQUE (organization_id, key)
 );
 
--- Insert sample data into the users table
-INSERT INTO users (name, email, password, created_at) VALUES
-('Alice', 'alice@example.com', 'alice_password', NOW()),
-('Bob', 'bob@example.com', 'bob_password', NOW()),
-('Carol', 'carol@example.com', 'carol_password', NOW());
+-- Insert sample data into the users table (Alice administre toutes les organisations)
+INSERT INTO users (name, email, password, cross_tenant_admin, created_at) VALUES
+('Alice', 'alice@example.com', 'alice_password', TRUE, NOW()),
+('Bob', 'bob@example.com', 'bob_password', FALSE, NOW()),
+('Carol', 'carol@example.com', 'carol_password', FALSE, NOW());
 
 -- Insert sample data into the roles table
-INSERT INTO roles (name, description, created_at) VALUES
-('Admin', 'Administrator with full access', NOW()),
-('Editor', 'Can edit and manage content', NOW()),
-('Viewer', 'Can view content only', NOW());
+INSERT INTO roles (name, description, permissions, created_at) VALUES
+('Admin', 'Administrator with full access', '{"*:*"}', NOW()),
+('Editor', 'Can edit and manage content', '{"read:*", "create:*", "update:*"}', NOW()),
+('Viewer', 'Can view content only', '{"read:*"}', NOW());
 
 -- Insert sample data into the groups table
 INSERT INTO groups (name, parent_group_id, child_group_ids, created_at) VALUES